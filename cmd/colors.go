@@ -21,3 +21,6 @@ var LevelColors = map[int]string{
 	50: Red,     // Error
 	60: Red,     // Fatal
 }
+
+// SourceColors are the colors of the Kubernetes sources, each pod gets one of them
+var SourceColors = []string{Blue, Magenta, Cyan, Green, Yellow}
@@ -54,13 +54,22 @@ func InitializeConfiguration(cmd *cobra.Command) (err error) {
 
 	_ = viper.BindPFlag("color", RootCmd.PersistentFlags().Lookup("color"))
 	_ = viper.BindPFlag("follow", RootCmd.PersistentFlags().Lookup("follow"))
+	_ = viper.BindPFlag("k8s.column", RootCmd.PersistentFlags().Lookup("k8s-column"))
+	_ = viper.BindPFlag("k8s.labels", RootCmd.PersistentFlags().Lookup("k8s-labels"))
 	_ = viper.BindPFlag("obfuscationKey", RootCmd.PersistentFlags().Lookup("key"))
+	_ = viper.BindPFlag("obfuscation.keyring", RootCmd.PersistentFlags().Lookup("keyring"))
 	_ = viper.BindPFlag("output", RootCmd.PersistentFlags().Lookup("output"))
 	_ = viper.BindPFlag("timezone", RootCmd.PersistentFlags().Lookup("time"))
 	viper.SetDefault("color", true)
+	viper.SetDefault("dedup.ignore", []string{"reqid", "req_id", "request_id", "trace_id", "span_id", "parent_span_id"})
 	viper.SetDefault("follow", false)
+	viper.SetDefault("k8s.column", false)
+	viper.SetDefault("k8s.labels", []string{"app", "app.kubernetes.io/name"})
 	viper.SetDefault("output", "long")
 	viper.SetDefault("timezone", "local")
+	viper.SetDefault("trace.keys", []string{"reqid", "req_id", "request_id", "trace_id", "traceId", "span_id"})
+	viper.SetDefault("trace.span", "span_id")
+	viper.SetDefault("trace.parent", "parent_span_id")
 
 	viper.SetEnvPrefix("LV")
 	viper.AutomaticEnv() // read in environment variables that match
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+// Deduplicator collapses repeated log entries into one line with a counter
+//
+// Entries are repeated when they have the same source, level, topic, scope, message, and fields (except the ignored ones).
+// Without Window, only consecutive entries are collapsed, otherwise repeats are collapsed within the time window.
+//
+// When following, the first entry of a group is written immediately.
+// If the output is a terminal (InPlace), its counter is then updated in place, otherwise the counter is written when the group closes.
+// Everything written to the output while following must go through the Deduplicator, so the lines to move up are counted.
+type Deduplicator struct {
+	Window  time.Duration
+	Ignore  []string
+	Follow  bool
+	InPlace bool
+	Height  int // The height of the terminal, lines above cannot be updated in place
+	Width   int // The width of the terminal, to count the lines that wrap
+	Options *OutputOptions
+	output  io.Writer
+	pending []*dedupGroup
+	groups  map[string]*dedupGroup
+	lines   int
+}
+
+type dedupGroup struct {
+	key     string
+	text    string
+	count   int64
+	first   time.Time
+	last    time.Time
+	line    int  // The line where the group was written when following
+	written bool // The group was written when following
+	stale   bool // The counter could not be updated in place
+}
+
+// NewDeduplicator creates a new Deduplicator that writes to the given io.Writer output
+func NewDeduplicator(output io.Writer, options *OutputOptions, window time.Duration, ignore []string) *Deduplicator {
+	return &Deduplicator{
+		Window:  window,
+		Ignore:  ignore,
+		Options: options,
+		output:  output,
+		groups:  map[string]*dedupGroup{},
+	}
+}
+
+// Add adds the given LogEntry read from the given source and its formatted text
+func (dedup *Deduplicator) Add(source string, entry LogEntry, text string) {
+	key := dedup.key(source, entry)
+	dedup.expire(entry.Time, key)
+
+	if group, found := dedup.groups[key]; found {
+		group.count++
+		if entry.Time.Before(group.first) {
+			group.first = entry.Time
+		}
+		if entry.Time.After(group.last) {
+			group.last = entry.Time
+		}
+		if dedup.Follow {
+			dedup.update(group)
+		}
+		return
+	}
+	group := &dedupGroup{key: key, text: text, count: 1, first: entry.Time, last: entry.Time}
+	dedup.groups[key] = group
+	dedup.pending = append(dedup.pending, group)
+	if dedup.Follow {
+		group.line = dedup.lines
+		group.written = true
+		dedup.write(group.text)
+	}
+}
+
+// Passthrough writes the given text that is not a log entry, after the pending groups
+func (dedup *Deduplicator) Passthrough(text string) {
+	dedup.Flush()
+	dedup.write(text)
+}
+
+// Write writes the given text that is not a log entry (like a notice) in order with the groups, without closing them
+//
+// implements io.Writer
+func (dedup *Deduplicator) Write(text []byte) (int, error) {
+	line := strings.TrimSuffix(string(text), "\n")
+	if dedup.Follow {
+		dedup.write(line)
+	} else {
+		dedup.pending = append(dedup.pending, &dedupGroup{text: line, count: 1}) // it is never repeated, as it is not in groups
+	}
+	return len(text), nil
+}
+
+// Flush closes and writes all the pending groups
+func (dedup *Deduplicator) Flush() {
+	for _, group := range dedup.pending {
+		dedup.close(group)
+	}
+	dedup.pending = nil
+	dedup.groups = map[string]*dedupGroup{}
+}
+
+// expire closes the groups that cannot receive repeats anymore
+func (dedup *Deduplicator) expire(now time.Time, key string) {
+	kept := dedup.pending[:0]
+	for _, group := range dedup.pending {
+		expired := group.key != key
+		if dedup.Window > 0 {
+			expired = now.Sub(group.first) > dedup.Window
+		}
+		if expired && dedup.groups[group.key] == group {
+			delete(dedup.groups, group.key) // the group must not receive repeats anymore
+		}
+		// groups are written in order, so a group cannot be closed before the previous ones unless it was already written
+		if expired && (dedup.Follow || len(kept) == 0) {
+			dedup.close(group)
+			continue
+		}
+		kept = append(kept, group)
+	}
+	dedup.pending = kept
+}
+
+func (dedup *Deduplicator) close(group *dedupGroup) {
+	if !group.written {
+		dedup.write(dedup.withCounter(group))
+		return
+	}
+	if group.count > 1 && (!dedup.InPlace || group.stale) {
+		dedup.write(dedup.counter(group, "  ↑ "))
+	}
+}
+
+// update rewrites the first line of the group with its counter
+func (dedup *Deduplicator) update(group *dedupGroup) {
+	distance := dedup.lines - group.line
+	if !dedup.InPlace || group.stale || (dedup.Height > 0 && distance >= dedup.Height) {
+		group.stale = true
+		return
+	}
+	firstLine, _, _ := strings.Cut(dedup.withCounter(group), "\n")
+	if written, _, _ := strings.Cut(group.text, "\n"); dedup.rows(firstLine) != dedup.rows(written) {
+		group.stale = true // the counter makes the line wrap, the lines below would be overwritten
+		return
+	}
+	_, _ = fmt.Fprintf(dedup.output, "\0337\033[%dA\r\033[2K%s\0338", distance, firstLine)
+}
+
+func (dedup *Deduplicator) write(text string) {
+	_, _ = fmt.Fprintln(dedup.output, text)
+	dedup.lines += dedup.rows(text)
+}
+
+// escapeSequence matches the terminal escape sequences (like the colors), they do not take room on the terminal
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// rows computes how many lines of the terminal the given text takes, as long lines wrap
+func (dedup Deduplicator) rows(text string) (rows int) {
+	for _, line := range strings.Split(text, "\n") {
+		columns := 0
+		for _, r := range escapeSequence.ReplaceAllString(line, "") {
+			switch width.LookupRune(r).Kind() {
+			case width.EastAsianWide, width.EastAsianFullwidth:
+				columns += 2
+			default:
+				columns++
+			}
+		}
+		if dedup.Width > 0 && columns > dedup.Width {
+			rows += (columns + dedup.Width - 1) / dedup.Width
+		} else {
+			rows++
+		}
+	}
+	return rows
+}
+
+// withCounter returns the text of the group with its counter at the end of the first line
+func (dedup Deduplicator) withCounter(group *dedupGroup) string {
+	if group.count < 2 {
+		return group.text
+	}
+	firstLine, rest, multiline := strings.Cut(group.text, "\n")
+	if multiline {
+		return firstLine + dedup.counter(group, " ") + "\n" + rest
+	}
+	return firstLine + dedup.counter(group, " ")
+}
+
+func (dedup Deduplicator) counter(group *dedupGroup, prefix string) string {
+	counter := fmt.Sprintf("%s×%d over %s", prefix, group.count, group.last.Sub(group.first).Round(time.Millisecond))
+	if dedup.Options != nil && dedup.Options.UseColors {
+		return Gray + counter + Reset
+	}
+	return counter
+}
+
+// key computes the key of the entry read from the given source, repeated entries have the same key
+//
+// The parts of the key are encoded in JSON, so values that contain separators cannot collide
+func (dedup Deduplicator) key(source string, entry LogEntry) string {
+	fields := make(map[string]any, len(entry.Fields))
+	for name, value := range entry.Fields {
+		if !slices.Contains(dedup.Ignore, name) {
+			fields[name] = value
+		}
+	}
+	key, err := json.Marshal([]any{source, entry.Level, entry.Topic, entry.Scope, entry.Message, fields})
+	if err != nil {
+		return fmt.Sprintf("%q %d %q %q %q %v", source, entry.Level, entry.Topic, entry.Scope, entry.Message, fields)
+	}
+	return string(key)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gildas/lv/cmd/docker"
+)
+
+// DockerBlob is the blob of the log entries read from Docker that describes their source (e.g. .docker.container, .docker.stream)
+const DockerBlob = "docker"
+
+// streamDocker streams the logs of the Docker container or Compose service of the streamer to the given io.Writer output
+//
+// Each line is prefixed with its container (e.g. [docker:shop-api-1]).
+// Without follow, the lines of the containers are sorted by time.
+func streamDocker(ctx context.Context, streamer *docker.Streamer, output io.Writer, options *OutputOptions) error {
+	if streamer.Follow {
+		return streamer.Stream(ctx, func(line docker.Line) {
+			writeDockerLine(output, line, options)
+		})
+	}
+	var lines []docker.Line
+	if err := streamer.Stream(ctx, func(line docker.Line) { lines = append(lines, line) }); err != nil {
+		return err
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	for _, line := range lines {
+		writeDockerLine(output, line, options)
+	}
+	return nil
+}
+
+// writeDockerLine writes a line read from a Docker container, or a banner, to the given io.Writer output
+func writeDockerLine(output io.Writer, line docker.Line, options *OutputOptions) {
+	source := "docker:" + line.Source.Container
+	var banner, color string
+
+	switch line.Banner {
+	case docker.AttachedBanner:
+		banner, color = "attached "+source, Green
+	case docker.DetachedBanner:
+		banner, color = "detached "+source, Yellow
+	default:
+		_, _ = fmt.Fprintf(output, "[%s] %s\n", source, withDockerMetadata(line.Text, line))
+		return
+	}
+	if len(line.Text) > 0 {
+		banner += " (" + line.Text + ")"
+	}
+	if options.UseColors {
+		_, _ = fmt.Fprintf(output, "%s--- %s ---%s\n", color, banner, Reset)
+	} else {
+		_, _ = fmt.Fprintf(output, "--- %s ---\n", banner)
+	}
+}
+
+// dockerMetadata gets the metadata of the container and the stream of the given line
+func dockerMetadata(line docker.Line) map[string]any {
+	metadata := map[string]any{}
+	for key, value := range map[string]string{"container": line.Source.Container, "id": line.Source.ID[:min(12, len(line.Source.ID))], "service": line.Source.Service, "project": line.Source.Project, "stream": line.Stream} {
+		if len(value) > 0 {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
+
+// withDockerMetadata adds the metadata of the container to the given line if it is a JSON object
+//
+// The metadata is written first, so a docker key already in the line wins
+func withDockerMetadata(text string, line docker.Line) string {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") || !strings.HasSuffix(trimmed, "}") {
+		return text
+	}
+	payload, err := json.Marshal(map[string]any{DockerBlob: dockerMetadata(line)})
+	if err != nil {
+		return text
+	}
+	if rest := strings.TrimSpace(trimmed[1:]); rest != "}" {
+		return string(payload[:len(payload)-1]) + "," + rest
+	}
+	return string(payload)
+}
@@ -0,0 +1,214 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// DefaultHost is the Docker Engine API used when DOCKER_HOST is not set
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// Client talks to the Docker Engine API, over its unix socket or over TCP
+type Client struct {
+	Host   string // the address of the API (e.g. unix:///var/run/docker.sock, tcp://localhost:2375)
+	base   string
+	client *http.Client
+}
+
+// Container is a container as listed by the Docker Engine API
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// ContainerInfo is a container as inspected by the Docker Engine API
+type ContainerInfo struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Tty    bool              `json:"Tty"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status     string    `json:"Status"`
+		Running    bool      `json:"Running"`
+		ExitCode   int       `json:"ExitCode"`
+		StartedAt  time.Time `json:"StartedAt"`
+		FinishedAt time.Time `json:"FinishedAt"`
+	} `json:"State"`
+}
+
+// Event is an event of the Docker Engine API
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// NewClient creates a new Client for the Docker Engine API given by DOCKER_HOST, or for its default unix socket
+func NewClient() (*Client, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if len(host) == 0 {
+		host = DefaultHost
+	}
+	address, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.ArgumentInvalid.With("DOCKER_HOST", host)
+	}
+	client := &Client{Host: host}
+	switch address.Scheme {
+	case "unix":
+		socket := address.Path
+		client.base = "http://docker"
+		client.client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}}
+	case "tcp", "http":
+		client.base = "http://" + address.Host
+		client.client = &http.Client{Transport: &http.Transport{}}
+	default:
+		return nil, errors.Unsupported.With("DOCKER_HOST", host)
+	}
+	return client, nil
+}
+
+// Containers gets the containers matching the given filters (e.g. {"label": ["com.docker.compose.service=api"]})
+//
+// The stopped containers are listed too if all is true
+func (client *Client) Containers(ctx context.Context, filters map[string][]string, all bool) ([]Container, error) {
+	query := url.Values{}
+	if all {
+		query.Set("all", "1")
+	}
+	if len(filters) > 0 {
+		payload, err := json.Marshal(filters)
+		if err != nil {
+			return nil, err
+		}
+		query.Set("filters", string(payload))
+	}
+	var containers []Container
+	if err := client.getJSON(ctx, "/containers/json", query, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// Inspect gets the details of the given container (ID or name)
+func (client *Client) Inspect(ctx context.Context, container string) (*ContainerInfo, error) {
+	var info ContainerInfo
+	if err := client.getJSON(ctx, "/containers/"+url.PathEscape(container)+"/json", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Logs opens the logs of the given container with the given query (follow, since, tail, ...)
+//
+// Unless the container has a TTY, the stdout and stderr streams are multiplexed, see Demultiplex
+func (client *Client) Logs(ctx context.Context, container string, query url.Values) (io.ReadCloser, error) {
+	res, err := client.get(ctx, "/containers/"+url.PathEscape(container)+"/logs", query)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Events streams the events matching the given filters, until the context is done or the API closes the stream
+//
+// If since is not zero, the events that happened since then are streamed first
+func (client *Client) Events(ctx context.Context, filters map[string][]string, since time.Time, handle func(event Event)) error {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+	if len(filters) > 0 {
+		payload, err := json.Marshal(filters)
+		if err != nil {
+			return err
+		}
+		query.Set("filters", string(payload))
+	}
+	res, err := client.get(ctx, "/events", query)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var event Event
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		handle(event)
+	}
+}
+
+// Name gets the name of the container, without its leading slash
+func (container Container) Name() string {
+	if len(container.Names) == 0 {
+		return container.ID[:min(12, len(container.ID))]
+	}
+	return strings.TrimPrefix(container.Names[0], "/")
+}
+
+// getJSON gets the given path of the API and decodes its JSON response into result
+func (client *Client) getJSON(ctx context.Context, path string, query url.Values, result any) error {
+	res, err := client.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// get sends a GET request to the given path of the API, the error message of the API is returned if the response is not a success
+func (client *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	address := client.base + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.client.Do(req)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("Failed to connect to Docker at %s", client.Host), err)
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer func() { _ = res.Body.Close() }()
+	var message struct {
+		Message string `json:"message"`
+	}
+	payload, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err := json.Unmarshal(payload, &message); err != nil || len(message.Message) == 0 {
+		message.Message = strings.TrimSpace(string(payload))
+	}
+	return nil, errors.Join(errors.FromHTTPStatusCode(res.StatusCode), errors.New(message.Message))
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+
+	"github.com/gildas/go-errors"
+)
+
+// demultiplexMaxSize is the largest frame accepted, and the longest partial line kept, to not allocate garbage sizes
+const demultiplexMaxSize = 1024 * 1024
+
+// Demultiplex reads the lines of the stdout and stderr streams of a container from its logs
+//
+// Unless the container has a TTY, the Docker Engine multiplexes the streams in frames:
+// a header of 8 bytes (the stream: 1 for stdout, 2 for stderr, 3 for an error of the engine, 3 bytes of padding, and the size of the payload, 32-bit big endian), followed by the payload.
+// A line can be split across frames, so each stream keeps its partial line until its end, or until it is longer than demultiplexMaxSize.
+// A frame larger than demultiplexMaxSize is an error.
+// With a TTY, there is only one raw stream, given as stdout.
+func Demultiplex(reader io.Reader, tty bool, handle func(stream, text string)) error {
+	if tty {
+		buffered := bufio.NewReader(reader)
+		for {
+			text, err := buffered.ReadString('\n')
+			if len(text) > 0 {
+				handle("stdout", strings.TrimRight(text, "\r\n"))
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	partials := map[byte]*bytes.Buffer{1: {}, 2: {}}
+	flush := func(kind byte, all bool) {
+		partial := partials[kind]
+		for {
+			line, err := partial.ReadBytes('\n')
+			if err != nil { // no end of line, the line is kept for the next frame unless all is true
+				if all && len(line) > 0 {
+					handle(streamName(kind), strings.TrimRight(string(line), "\r"))
+				} else if len(line) > 0 {
+					partial.Reset()
+					partial.Write(line)
+				}
+				return
+			}
+			handle(streamName(kind), strings.TrimRight(string(line), "\r\n"))
+		}
+	}
+
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			flush(1, true)
+			flush(2, true)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		kind, size := header[0], binary.BigEndian.Uint32(header[4:])
+		if size > demultiplexMaxSize {
+			return errors.ArgumentInvalid.With("frame size", size)
+		}
+		switch kind {
+		case 0, 1, 2:
+			if kind == 0 {
+				kind = 1 // stdin is not multiplexed in the logs, but the engine can use it for stdout
+			}
+			if _, err := io.CopyN(partials[kind], reader, int64(size)); err != nil {
+				return err
+			}
+			flush(kind, partials[kind].Len() > demultiplexMaxSize)
+		case 3:
+			message, _ := io.ReadAll(io.LimitReader(reader, int64(size)))
+			return errors.New(strings.TrimSpace(string(message)))
+		default:
+			return errors.ArgumentInvalid.With("stream", kind)
+		}
+	}
+}
+
+func streamName(kind byte) string {
+	if kind == 2 {
+		return "stderr"
+	}
+	return "stdout"
+}
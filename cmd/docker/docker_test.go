@@ -0,0 +1,295 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type DockerSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestDockerSuite(t *testing.T) {
+	suite.Run(t, new(DockerSuite))
+}
+
+func (suite *DockerSuite) SetupSuite() {
+	suite.Name = "Docker"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// frame multiplexes the given text in a frame of the given stream
+func frame(kind byte, text string) []byte {
+	header := make([]byte, 8)
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[4:], uint32(len(text)))
+	return append(header, text...)
+}
+
+// fakeEngine is a Docker Engine API with the containers of a Compose service
+//
+// The logs of a running container are followed until the container stops or restarts.
+type fakeEngine struct {
+	containers map[string]*ContainerInfo
+	logs       map[string][]string      // the lines of the current instance of the containers
+	stopped    map[string]chan struct{} // closed when the current instance stops
+	events     chan Event
+	lock       sync.Mutex
+}
+
+func newFakeEngine() *fakeEngine {
+	return &fakeEngine{
+		containers: map[string]*ContainerInfo{},
+		logs:       map[string][]string{},
+		stopped:    map[string]chan struct{}{},
+		events:     make(chan Event, 10),
+	}
+}
+
+// start starts a new instance of the given container of the api service with the given log lines
+func (engine *fakeEngine) start(id, name string, lines ...string) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	info := &ContainerInfo{ID: id, Name: "/" + name}
+	info.Config.Labels = map[string]string{ComposeServiceLabel: "api", ComposeProjectLabel: "shop"}
+	info.State.Status, info.State.Running, info.State.StartedAt = "running", true, time.Now()
+	engine.containers[id] = info
+	engine.logs[id] = lines
+	engine.stopped[id] = make(chan struct{})
+}
+
+// restart stops the current instance of the given container and starts a new one with the given log lines, at once
+func (engine *fakeEngine) restart(id string, lines ...string) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	info := *engine.containers[id]
+	info.State.StartedAt = time.Now()
+	close(engine.stopped[id])
+	engine.containers[id] = &info
+	engine.logs[id] = lines
+	engine.stopped[id] = make(chan struct{})
+}
+
+// stop stops the current instance of the given container with the given exit code
+func (engine *fakeEngine) stop(id string, exitCode int) {
+	engine.lock.Lock()
+	defer engine.lock.Unlock()
+	info := engine.containers[id]
+	info.State.Status, info.State.Running, info.State.ExitCode = "exited", false, exitCode
+	close(engine.stopped[id])
+}
+
+func (engine *fakeEngine) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	engine.lock.Lock()
+	path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.URL.Path == "/containers/json":
+		containers := []Container{}
+		for _, info := range engine.containers {
+			containers = append(containers, Container{ID: info.ID, Names: []string{info.Name}, Labels: info.Config.Labels})
+		}
+		engine.lock.Unlock()
+		_ = json.NewEncoder(res).Encode(containers)
+	case len(path) == 3 && path[2] == "json":
+		info, found := engine.containers[path[1]]
+		engine.lock.Unlock()
+		if !found {
+			res.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(res, `{"message": "No such container: %s"}`, path[1])
+			return
+		}
+		_ = json.NewEncoder(res).Encode(info)
+	case len(path) == 3 && path[2] == "logs":
+		lines, stopped, running := engine.logs[path[1]], engine.stopped[path[1]], engine.containers[path[1]].State.Running
+		engine.lock.Unlock()
+		for index, line := range lines {
+			_, _ = res.Write(frame(byte(1+index%2), time.Now().Format(time.RFC3339Nano)+" "+line+"\n"))
+		}
+		res.(http.Flusher).Flush()
+		if req.URL.Query().Get("follow") == "1" && running {
+			select {
+			case <-stopped:
+			case <-req.Context().Done():
+			}
+		}
+	case req.URL.Path == "/events":
+		engine.lock.Unlock()
+		res.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-engine.events:
+				_ = json.NewEncoder(res).Encode(event)
+				res.(http.Flusher).Flush()
+			case <-req.Context().Done():
+				return
+			}
+		}
+	default:
+		engine.lock.Unlock()
+		res.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serve serves the engine on a unix socket given by DOCKER_HOST
+func (suite *DockerSuite) serve(engine *fakeEngine) {
+	dir, err := os.MkdirTemp("", "lv-docker") // the path of a unix socket must be short
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	suite.Require().NoError(err)
+
+	server := httptest.NewUnstartedServer(engine)
+	_ = server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	suite.T().Cleanup(server.Close)
+	suite.T().Setenv("DOCKER_HOST", "unix://"+socket)
+}
+
+func (suite *DockerSuite) TestCanDemultiplexLinesSplitAcrossFrames() {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "first li"))
+	stream.Write(frame(2, "error\nsecond "))
+	stream.Write(frame(1, "ne\r\nsecond line\nno end"))
+	stream.Write(frame(2, "error\n"))
+
+	lines := []string{}
+	err := Demultiplex(&stream, false, func(kind, text string) { lines = append(lines, kind+": "+text) })
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{
+		"stderr: error",
+		"stdout: first line",
+		"stdout: second line",
+		"stderr: second error",
+		"stdout: no end",
+	}, lines)
+}
+
+func (suite *DockerSuite) TestShouldFailWithEngineErrorFrame() {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "line\n"))
+	stream.Write(frame(3, "container is gone\n"))
+	stream.Write(frame(1, "never read\n"))
+
+	lines := []string{}
+	err := Demultiplex(&stream, false, func(kind, text string) { lines = append(lines, text) })
+	suite.Require().Error(err)
+	suite.Assert().Equal("container is gone", err.Error())
+	suite.Assert().Equal([]string{"line"}, lines)
+}
+
+func (suite *DockerSuite) TestShouldRejectTooLargeFrame() {
+	header := make([]byte, 8)
+	header[0] = 1
+	binary.BigEndian.PutUint32(header[4:], demultiplexMaxSize+1)
+	err := Demultiplex(bytes.NewReader(header), false, func(kind, text string) {})
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+}
+
+func (suite *DockerSuite) TestCanReadTTYStream() {
+	lines := []string{}
+	err := Demultiplex(strings.NewReader("first\r\nsecond"), true, func(kind, text string) { lines = append(lines, kind+": "+text) })
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"stdout: first", "stdout: second"}, lines)
+}
+
+func (suite *DockerSuite) TestCanStreamContainer() {
+	engine := newFakeEngine()
+	engine.start("a1", "shop-api-1", "hello", "oops")
+	engine.stop("a1", 1)
+	suite.serve(engine)
+
+	streamer, err := NewStreamer("docker://a1")
+	suite.Require().NoError(err)
+	lines := []Line{}
+	err = streamer.Stream(suite.ctx, func(line Line) { lines = append(lines, line) })
+	suite.Require().NoError(err)
+	suite.Require().Len(lines, 2)
+	suite.Assert().Equal("hello", lines[0].Text, "The timestamp of the engine should be removed")
+	suite.Assert().Equal("stdout", lines[0].Stream)
+	suite.Assert().Equal("stderr", lines[1].Stream)
+	suite.Assert().False(lines[0].Time.IsZero())
+	suite.Assert().Equal(Source{Container: "shop-api-1", ID: "a1", Service: "api", Project: "shop"}, lines[0].Source)
+
+	streamer, err = NewStreamer("docker://unknown")
+	suite.Require().NoError(err)
+	err = streamer.Stream(suite.ctx, func(line Line) {})
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.HTTPNotFound)
+	suite.Assert().Contains(err.Error(), "No such container: unknown")
+}
+
+func (suite *DockerSuite) TestCanFollowRestartedComposeService() {
+	engine := newFakeEngine()
+	engine.start("a1", "shop-api-1", "first instance")
+	suite.serve(engine)
+
+	streamer, err := NewStreamer("compose://shop/api")
+	suite.Require().NoError(err)
+	streamer.Follow = true
+
+	ctx, cancel := context.WithCancel(suite.ctx)
+	defer cancel()
+	received := make(chan Line, 20)
+	done := make(chan error, 1)
+	go func() { done <- streamer.Stream(ctx, func(line Line) { received <- line }) }()
+	next := func() Line {
+		select {
+		case line := <-received:
+			return line
+		case <-time.After(5 * time.Second):
+			suite.FailNow("No line received")
+			return Line{}
+		}
+	}
+
+	suite.Assert().Equal(AttachedBanner, next().Banner)
+	suite.Assert().Equal("first instance", next().Text)
+
+	// the container restarts: its stream ends, and it is attached again
+	engine.restart("a1", "second instance")
+	detached := next()
+	suite.Assert().Equal(DetachedBanner, detached.Banner)
+	suite.Assert().Equal("restarted", detached.Text)
+	suite.Assert().Equal(AttachedBanner, next().Banner)
+	suite.Assert().Equal("second instance", next().Text)
+
+	// a new container of the service starts
+	engine.start("a2", "shop-api-2", "new container")
+	engine.events <- Event{Type: "container", Action: "start", Actor: struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	}{ID: "a2"}}
+	attached := next()
+	suite.Assert().Equal(AttachedBanner, attached.Banner)
+	suite.Assert().Equal("shop-api-2", attached.Source.Container)
+	suite.Assert().Equal("new container", next().Text)
+
+	engine.stop("a2", 0)
+	detached = next()
+	suite.Assert().Equal(DetachedBanner, detached.Banner)
+	suite.Assert().Equal("exited, exit code 0", detached.Text)
+
+	cancel()
+	suite.Require().NoError(<-done)
+}
@@ -0,0 +1,241 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+)
+
+// ComposeServiceLabel and ComposeProjectLabel are the labels Docker Compose sets on the containers of its services
+const (
+	ComposeServiceLabel = "com.docker.compose.service"
+	ComposeProjectLabel = "com.docker.compose.project"
+)
+
+// Source describes the container a log line comes from
+type Source struct {
+	Container string `json:"container"`
+	ID        string `json:"id"`
+	Service   string `json:"service,omitempty"`
+	Project   string `json:"project,omitempty"`
+}
+
+// Line is a log line read from a container, or a banner when a container is attached or detached
+type Line struct {
+	Source Source    `json:"source"`
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream,omitempty"` // stdout or stderr
+	Text   string    `json:"text,omitempty"`
+	Banner Banner    `json:"banner,omitempty"`
+}
+
+// Banner tells if a Line is a banner and which one
+type Banner int
+
+const (
+	// NoBanner is used for log lines
+	NoBanner Banner = iota
+	// AttachedBanner is used when a container starts being streamed
+	AttachedBanner
+	// DetachedBanner is used when a container stops being streamed
+	DetachedBanner
+)
+
+// Streamer streams the logs of a Docker container, or of the containers of a Docker Compose service
+type Streamer struct {
+	Client     *Client
+	Container  string // the container to stream (docker://<container>)
+	Service    string // the Compose service to stream (compose://[<project>/]<service>)
+	Project    string // the Compose project of the service, any project if empty
+	Follow     bool
+	Tail       int64     // the number of lines to show from the end of the logs, all if negative
+	Since      time.Time // the lines before are not shown, if not zero
+	Timestamps bool      // keeps the timestamps of the Docker Engine at the start of the lines
+	lock       sync.Mutex
+}
+
+// IsTarget tells if the given argument is a Docker container (docker://<container>) or a Compose service (compose://[<project>/]<service>)
+func IsTarget(arg string) bool {
+	return strings.HasPrefix(arg, "docker://") || strings.HasPrefix(arg, "compose://")
+}
+
+// NewStreamer creates a new Streamer for the given target (docker://<container> or compose://[<project>/]<service>)
+func NewStreamer(target string) (*Streamer, error) {
+	client, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	streamer := &Streamer{Client: client, Tail: -1}
+	if container, found := strings.CutPrefix(target, "docker://"); found {
+		if len(container) == 0 || strings.Contains(container, "/") {
+			return nil, errors.ArgumentInvalid.With("container", target)
+		}
+		streamer.Container = container
+		return streamer, nil
+	}
+	if service, found := strings.CutPrefix(target, "compose://"); found {
+		if project, name, found := strings.Cut(service, "/"); found {
+			streamer.Project, service = project, name
+		}
+		if len(service) == 0 || strings.Contains(service, "/") {
+			return nil, errors.ArgumentInvalid.With("service", target)
+		}
+		streamer.Service = service
+		return streamer, nil
+	}
+	return nil, errors.ArgumentInvalid.With("target", target)
+}
+
+// String gets the target of the streamer
+func (streamer *Streamer) String() string {
+	if len(streamer.Container) > 0 {
+		return "docker://" + streamer.Container
+	}
+	if len(streamer.Project) > 0 {
+		return "compose://" + streamer.Project + "/" + streamer.Service
+	}
+	return "compose://" + streamer.Service
+}
+
+// Stream streams the logs of the containers to the given handle
+//
+// Without Follow, the logs of every container (running or not) are read until their end.
+// With Follow, the containers are attached and detached as they start and stop, until the context is done.
+func (streamer *Streamer) Stream(ctx context.Context, handle func(line Line)) error {
+	if streamer.Follow {
+		return streamer.watch(ctx, handle)
+	}
+	containers, err := streamer.containers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		if err := streamer.streamContainer(ctx, container, streamer.query(time.Time{}), handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containers gets the containers to stream, sorted by name
+func (streamer *Streamer) containers(ctx context.Context) ([]*ContainerInfo, error) {
+	if len(streamer.Container) > 0 {
+		info, err := streamer.Client.Inspect(ctx, streamer.Container)
+		if err != nil {
+			return nil, err
+		}
+		return []*ContainerInfo{info}, nil
+	}
+	list, err := streamer.Client.Containers(ctx, map[string][]string{"label": streamer.labels()}, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, errors.NotFound.With("service", streamer.String())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	containers := make([]*ContainerInfo, 0, len(list))
+	for _, container := range list {
+		info, err := streamer.Client.Inspect(ctx, container.ID)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, info)
+	}
+	return containers, nil
+}
+
+// labels gets the label filters of the Compose service
+func (streamer *Streamer) labels() []string {
+	labels := []string{ComposeServiceLabel + "=" + streamer.Service}
+	if len(streamer.Project) > 0 {
+		labels = append(labels, ComposeProjectLabel+"="+streamer.Project)
+	}
+	return labels
+}
+
+// eventFilters gets the filters of the start events of the containers to stream
+func (streamer *Streamer) eventFilters() map[string][]string {
+	filters := map[string][]string{"type": {"container"}, "event": {"start"}}
+	if len(streamer.Container) > 0 {
+		filters["container"] = []string{streamer.Container}
+	} else {
+		filters["label"] = streamer.labels()
+	}
+	return filters
+}
+
+// query gets the query of the logs of a container
+//
+// If since is not zero, the logs are read from then instead of with the Tail and Since of the streamer
+func (streamer *Streamer) query(since time.Time) url.Values {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "timestamps": {"1"}, "tail": {"all"}}
+	if streamer.Follow {
+		query.Set("follow", "1")
+	}
+	if since.IsZero() {
+		since = streamer.Since
+		if streamer.Tail >= 0 {
+			query.Set("tail", strconv.FormatInt(streamer.Tail, 10))
+		}
+	}
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+	return query
+}
+
+// source gets the source of the lines of the given container
+func source(info *ContainerInfo) Source {
+	return Source{
+		Container: strings.TrimPrefix(info.Name, "/"),
+		ID:        info.ID,
+		Service:   info.Config.Labels[ComposeServiceLabel],
+		Project:   info.Config.Labels[ComposeProjectLabel],
+	}
+}
+
+// streamContainer streams the logs of the given container until their end
+func (streamer *Streamer) streamContainer(ctx context.Context, info *ContainerInfo, query url.Values, handle func(line Line)) error {
+	source := source(info)
+	log := logger.Must(logger.FromContext(ctx)).Child("docker", "stream", "container", source.Container)
+
+	log.Infof("Streaming logs from container %s", source.Container)
+	stream, err := streamer.Client.Logs(ctx, info.ID, query)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }()
+
+	err = Demultiplex(stream, info.Config.Tty, func(kind, text string) {
+		line := Line{Source: source, Stream: kind, Text: text}
+		if timestamp, rest, found := strings.Cut(text, " "); found {
+			if parsed, perr := time.Parse(time.RFC3339Nano, timestamp); perr == nil {
+				line.Time = parsed
+				if !streamer.Timestamps {
+					line.Text = rest
+				}
+			}
+		}
+		streamer.emit(handle, line)
+	})
+	if err != nil && ctx.Err() == nil {
+		return err
+	}
+	log.Infof("End of logs from container %s", source.Container)
+	return nil
+}
+
+func (streamer *Streamer) emit(handle func(line Line), line Line) {
+	streamer.lock.Lock()
+	defer streamer.lock.Unlock()
+	handle(line)
+}
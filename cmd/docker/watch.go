@@ -0,0 +1,149 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-logger"
+)
+
+// containerWatcher keeps track of the containers being streamed
+type containerWatcher struct {
+	streamer *Streamer
+	handle   func(line Line)
+	waiter   sync.WaitGroup
+	streams  map[string]*containerStream // the containers being streamed by ID
+	ended    chan streamEnd
+}
+
+type containerStream struct {
+	source    Source
+	startedAt time.Time
+	cancel    context.CancelFunc
+}
+
+type streamEnd struct {
+	id  string
+	err error
+}
+
+// watch streams the containers and attaches them again as they start
+//
+// The containers found at start are streamed with Tail and Since, the containers that start (restarted, or new containers of the service) are streamed from their start.
+// The start events are read from before the containers are listed, so no container is missed.
+func (streamer *Streamer) watch(ctx context.Context, handle func(line Line)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("docker", "watch")
+
+	ctx, cancel := context.WithCancel(ctx)
+	watcher := &containerWatcher{
+		streamer: streamer,
+		handle:   handle,
+		streams:  map[string]*containerStream{},
+		ended:    make(chan streamEnd),
+	}
+	defer func() {
+		cancel()
+		watcher.waiter.Wait()
+	}()
+
+	since := time.Now()
+	containers, err := streamer.containers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, container := range containers {
+		watcher.attach(ctx, container, true)
+	}
+
+	events := make(chan Event)
+	eventsEnded := make(chan error, 1)
+	go func() {
+		eventsEnded <- streamer.Client.Events(ctx, streamer.eventFilters(), since, func(event Event) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-eventsEnded:
+			if err != nil {
+				return err
+			}
+			log.Infof("The Docker events of %s ended", streamer)
+			return nil
+		case event := <-events:
+			if _, streaming := watcher.streams[event.Actor.ID]; streaming {
+				continue // the stream of the previous instance has not ended yet, the container is attached again then
+			}
+			info, err := streamer.Client.Inspect(ctx, event.Actor.ID)
+			if err != nil {
+				log.Warnf("Failed to inspect container %s: %s", event.Actor.ID, err)
+				continue
+			}
+			watcher.attach(ctx, info, false)
+		case end := <-watcher.ended:
+			watcher.end(ctx, end)
+		}
+	}
+}
+
+// attach starts streaming the given container
+//
+// The containers found at start are streamed with Tail and Since, the other ones from their start
+func (watcher *containerWatcher) attach(ctx context.Context, info *ContainerInfo, initial bool) {
+	streamer := watcher.streamer
+	query := streamer.query(time.Time{})
+	if !initial {
+		query = streamer.query(info.State.StartedAt)
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream := &containerStream{source: source(info), startedAt: info.State.StartedAt, cancel: cancel}
+	watcher.streams[info.ID] = stream
+	streamer.emit(watcher.handle, Line{Source: stream.source, Time: time.Now(), Banner: AttachedBanner})
+
+	watcher.waiter.Add(1)
+	go func() {
+		defer watcher.waiter.Done()
+		err := streamer.streamContainer(streamCtx, info, query, watcher.handle)
+		select {
+		case watcher.ended <- streamEnd{id: info.ID, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// end detaches the container whose stream ended, and attaches it again if it restarted meanwhile
+func (watcher *containerWatcher) end(ctx context.Context, end streamEnd) {
+	stream, found := watcher.streams[end.id]
+	if !found {
+		return
+	}
+	stream.cancel()
+	delete(watcher.streams, end.id)
+
+	reason := "container removed"
+	info, err := watcher.streamer.Client.Inspect(ctx, end.id)
+	restarted := err == nil && info.State.Running && info.State.StartedAt.After(stream.startedAt)
+	if restarted {
+		reason = "restarted"
+	} else if err == nil {
+		reason = ""
+		if !info.State.Running {
+			reason = fmt.Sprintf("%s, exit code %d", info.State.Status, info.State.ExitCode)
+		}
+	}
+	if end.err != nil {
+		reason = end.err.Error()
+	}
+	watcher.streamer.emit(watcher.handle, Line{Source: stream.source, Time: time.Now(), Banner: DetachedBanner, Text: reason})
+	if restarted {
+		watcher.attach(ctx, info, false)
+	}
+}
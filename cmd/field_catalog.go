@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FieldStats contains the statistics of a field observed in log entries
+type FieldStats struct {
+	Path     string
+	Types    map[string]int64
+	Count    int64 // The number of entries where the field is present
+	Nulls    int64 // The number of entries where the field is null
+	Values   map[string]struct{}
+	Examples []string
+}
+
+// FieldCatalog collects the fields observed in log entries
+type FieldCatalog struct {
+	Entries     int64
+	MaxExamples int
+	fields      map[string]*FieldStats
+}
+
+// MaxCardinality is the maximum number of distinct values counted per field
+const MaxCardinality = 10000
+
+// NewFieldCatalog creates a new FieldCatalog
+func NewFieldCatalog() *FieldCatalog {
+	return &FieldCatalog{
+		MaxExamples: 3,
+		fields:      map[string]*FieldStats{},
+	}
+}
+
+// Add collects the fields of the given LogEntry
+func (catalog *FieldCatalog) Add(entry LogEntry) {
+	catalog.Entries++
+	seen := map[string]bool{}
+	entry.Walk(func(path string, value any) {
+		stats, ok := catalog.fields[path]
+		if !ok {
+			stats = &FieldStats{Path: path, Types: map[string]int64{}, Values: map[string]struct{}{}}
+			catalog.fields[path] = stats
+		}
+		stats.Types[typeOf(value)]++
+		if seen[path] {
+			return // array elements are counted once per entry
+		}
+		seen[path] = true
+		stats.Count++
+		if value == nil {
+			stats.Nulls++
+			return
+		}
+		if !isLiteral(value) {
+			return
+		}
+		literal := fmt.Sprintf("%v", value)
+		if _, found := stats.Values[literal]; !found && len(stats.Values) <= MaxCardinality {
+			stats.Values[literal] = struct{}{} // one more value than MaxCardinality tells there are more
+			if len(stats.Examples) < catalog.MaxExamples {
+				stats.Examples = append(stats.Examples, literal)
+			}
+		}
+	})
+}
+
+// Fields returns the statistics of the collected fields sorted by path
+func (catalog FieldCatalog) Fields() []*FieldStats {
+	fields := make([]*FieldStats, 0, len(catalog.fields))
+	for _, stats := range catalog.fields {
+		fields = append(fields, stats)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+	return fields
+}
+
+// Paths returns the paths of the collected fields that can be used in filters
+func (catalog FieldCatalog) Paths() []string {
+	paths := make([]string, 0, len(catalog.fields))
+	for path, stats := range catalog.fields {
+		if strings.Contains(path, "[]") {
+			continue
+		}
+		if !stats.HasLiterals() {
+			continue // containers cannot be compared in filters
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// HasLiterals tells if the field was observed with literal values (string, number, boolean, null)
+func (stats FieldStats) HasLiterals() bool {
+	for name := range stats.Types {
+		if name != "object" && name != "array" {
+			return true
+		}
+	}
+	return false
+}
+
+// Cardinality returns the number of distinct values of the field
+//
+// If the field has more than MaxCardinality distinct values, MaxCardinality is returned
+func (stats FieldStats) Cardinality() int {
+	return min(len(stats.Values), MaxCardinality)
+}
+
+// Write writes the statistics of the field to the given io.Writer output
+func (stats FieldStats) Write(output io.Writer, options *OutputOptions, entries int64) {
+	types := make([]string, 0, len(stats.Types))
+	for name := range stats.Types {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+
+	cardinality := fmt.Sprintf("%d", stats.Cardinality())
+	if len(stats.Values) > MaxCardinality {
+		cardinality = ">" + cardinality
+	}
+	nullRate := 0.0
+	if stats.Count > 0 {
+		nullRate = 100 * float64(stats.Nulls) / float64(stats.Count)
+	}
+	presence := 0.0
+	if entries > 0 {
+		presence = 100 * float64(stats.Count) / float64(entries)
+	}
+
+	if options.UseColors {
+		_, _ = output.Write([]byte(Green))
+	}
+	_, _ = fmt.Fprintf(output, "%-40s", stats.Path)
+	if options.UseColors {
+		_, _ = output.Write([]byte(Reset))
+	}
+	_, _ = fmt.Fprintf(output, " %-20s %7.1f%% %7.1f%% %11s ", strings.Join(types, ","), presence, nullRate, cardinality)
+	if options.UseColors {
+		_, _ = output.Write([]byte(Cyan))
+	}
+	_, _ = output.Write([]byte(strings.Join(stats.Examples, ", ")))
+	if options.UseColors {
+		_, _ = output.Write([]byte(Reset))
+	}
+}
+
+// Walk calls visit for every field of the LogEntry, including the nested values of blobs
+//
+// Nested paths are dotted (e.g. "user.id"), array elements are visited with the "[]" suffix (e.g. "items[].id")
+func (entry LogEntry) Walk(visit func(path string, value any)) {
+	if !entry.Time.IsZero() {
+		visit("time", entry.Time.Format(time.RFC3339Nano))
+	}
+	if entry.Level != 0 {
+		visit("level", float64(entry.Level))
+	}
+	for name, value := range map[string]string{"hostname": entry.Hostname, "name": entry.Name, "topic": entry.Topic, "scope": entry.Scope, "msg": entry.Message} {
+		if len(value) > 0 {
+			visit(name, value)
+		}
+	}
+	if entry.PID != 0 {
+		visit("pid", float64(entry.PID))
+	}
+	if entry.TaskID != 0 {
+		visit("tid", float64(entry.TaskID))
+	}
+	for key, value := range entry.Fields {
+		walkValue(key, value, visit)
+	}
+	for key, value := range entry.Blobs {
+		walkValue(key, value, visit)
+	}
+}
+
+func walkValue(path string, value any, visit func(path string, value any)) {
+	visit(path, value)
+	switch actual := value.(type) {
+	case map[string]any:
+		for key, child := range actual {
+			walkValue(path+"."+key, child, visit)
+		}
+	case []any:
+		for _, element := range actual {
+			walkValue(path+"[]", element, visit)
+		}
+	}
+}
+
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
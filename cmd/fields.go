@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+)
+
+var fieldsCmd = &cobra.Command{
+	Use:   "fields [flags] [file]",
+	Short: "list the fields found in log entries",
+	Long: `Lists every field found in the log entries, including the nested fields of blobs, with their types, presence, null rate, cardinality, and some example values.
+Nested fields are shown with a dotted path (e.g. user.id) that can be used in filters.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runFieldsCommand,
+}
+
+// MaxCompletionEntries is the maximum number of log entries scanned to complete filters
+const MaxCompletionEntries = 1000
+
+func init() {
+	RootCmd.AddCommand(fieldsCmd)
+}
+
+// runFieldsCommand executes the fields Command
+func runFieldsCommand(cmd *cobra.Command, args []string) (err error) {
+	log := logger.Must(logger.FromContext(cmd.Context())).Child("fields", "run")
+
+	if err = initializeOutputOptions(cmd); err != nil {
+		return err
+	}
+
+	reader, closeInput, err := openInput(cmd, args)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	catalog := NewFieldCatalog()
+	if err = readEntries(cmd.Context(), reader, catalog.Add); err != nil {
+		log.Fatalf("Failed to read from input", err)
+		return err
+	}
+
+	_, _ = fmt.Fprintf(os.Stdout, "%-40s %-20s %8s %8s %11s %s\n", "FIELD", "TYPES", "PRESENT", "NULLS", "CARDINALITY", "EXAMPLES")
+	for _, stats := range catalog.Fields() {
+		output := strings.Builder{}
+		stats.Write(&output, &CmdOptions.OutputOptions, catalog.Entries)
+		_, _ = fmt.Fprintln(os.Stdout, output.String())
+	}
+	return nil
+}
+
+// validFilterArgs completes the field names in the filter expression being typed
+//
+// The fields are collected from the first entries of the file given in args
+func validFilterArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	log := logger.Must(logger.FromContext(cmd.Context())).Child("completion", "filter")
+
+	if len(args) == 0 {
+		log.Debugf("No file to collect fields from")
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// The field being completed starts at the last dot that follows a separator
+	start := -1
+	for index := len(toComplete) - 1; index >= 0; index-- {
+		if toComplete[index] == '.' && (index == 0 || strings.ContainsRune(" (!&|=", rune(toComplete[index-1]))) {
+			start = index
+			break
+		}
+		if strings.ContainsRune(" ()!&|=~\"/", rune(toComplete[index])) {
+			break
+		}
+	}
+	if start < 0 && len(strings.TrimSpace(toComplete)) > 0 && !strings.HasSuffix(toComplete, " ") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	prefix, partial := toComplete, ""
+	if start >= 0 {
+		prefix, partial = toComplete[:start], toComplete[start+1:]
+	}
+
+	catalog, err := collectFields(cmd.Context(), args[0], MaxCompletionEntries)
+	if err != nil {
+		log.Errorf("Failed to collect fields from %s", args[0], err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	completions := []string{}
+	for _, path := range catalog.Paths() {
+		if strings.HasPrefix(path, partial) {
+			completions = append(completions, prefix+"."+path)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// collectFields collects the fields of the first maxEntries log entries of the given file
+func collectFields(context context.Context, filename string, maxEntries int64) (*FieldCatalog, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	catalog := NewFieldCatalog()
+	reader := untilReader{reader: bufio.NewReader(file), done: func() bool { return catalog.Entries >= maxEntries }}
+	return catalog, readEntries(context, reader, catalog.Add)
+}
+
+// untilReader reads from its reader until done tells there is nothing more to read
+type untilReader struct {
+	reader io.Reader
+	done   func() bool
+}
+
+// Read reads from the reader, or returns io.EOF once done
+//
+// implements io.Reader
+func (reader untilReader) Read(buffer []byte) (int, error) {
+	if reader.done() {
+		return 0, io.EOF
+	}
+	return reader.reader.Read(buffer)
+}
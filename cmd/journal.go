@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/lv/cmd/listen"
+)
+
+// JournalBlob is the blob of the log entries read from the systemd journal with their trusted fields, without their leading underscore (e.g. .journal.systemd_unit)
+const JournalBlob = "journal"
+
+// JournalTimestampField is the field of the journal entries with their time, in microseconds since the epoch
+const JournalTimestampField = "__REALTIME_TIMESTAMP"
+
+// journalExportStart matches the first line of the journal export format (journalctl -o export)
+var journalExportStart = regexp.MustCompile(`^__(CURSOR|REALTIME_TIMESTAMP|MONOTONIC_TIMESTAMP|SEQNUM)=`)
+
+// journalMaxFieldSize is the largest binary field accepted in the journal export format, to not allocate garbage sizes
+const journalMaxFieldSize = 64 * 1024 * 1024
+
+// isJournalExport tells if the reader starts with the journal export format, without consuming it
+//
+// Only the first line is peeked, so a followed journal is not blocked
+func isJournalExport(reader *bufio.Reader) bool {
+	for size := 1; size <= reader.Size(); size++ {
+		peek, err := reader.Peek(size)
+		if err != nil {
+			return false
+		}
+		if peek[size-1] == '\n' {
+			return journalExportStart.Match(peek)
+		}
+	}
+	return false
+}
+
+// newJournalExportReader converts the journal export format read from the given reader into JSON lines, like journalctl -o json
+func newJournalExportReader(reader *bufio.Reader) *io.PipeReader {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.CloseWithError(convertJournalExport(reader, pipeWriter))
+	}()
+	return pipeReader
+}
+
+// convertJournalExport converts the entries of the journal export format into JSON lines
+//
+// The entries are separated by an empty line, each field is either "NAME=value\n"
+// or, for binary fields, "NAME\n" followed by the size of the value (64-bit little endian), the value, and "\n".
+// The values that are not UTF-8 are written as arrays of bytes, like journalctl -o json does.
+func convertJournalExport(reader *bufio.Reader, output io.Writer) error {
+	entry := map[string]any{}
+	repeated := map[string]bool{}
+	flush := func() error {
+		if len(entry) == 0 {
+			return nil
+		}
+		payload, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		entry, repeated = map[string]any{}, map[string]bool{}
+		_, err = output.Write(append(payload, '\n'))
+		return err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			return flush()
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		if len(line) == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if name, value, found := bytes.Cut(line, []byte("=")); found {
+			addJournalField(entry, repeated, string(name), value)
+			continue
+		}
+		var size uint64
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			return errors.Join(errors.ArgumentInvalid.With("journal field", string(line)), err)
+		}
+		if size > journalMaxFieldSize {
+			return errors.ArgumentInvalid.With("journal field size", size)
+		}
+		value := make([]byte, size)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return errors.Join(errors.ArgumentInvalid.With("journal field", string(line)), err)
+		}
+		if newline, err := reader.ReadByte(); err != nil || newline != '\n' {
+			return errors.ArgumentInvalid.With("journal field", string(line))
+		}
+		addJournalField(entry, repeated, string(line), value)
+	}
+}
+
+// addJournalField adds the value of a field to the entry
+//
+// The values of a field given more than once are gathered in an array, repeated tells which fields already have an array.
+func addJournalField(entry map[string]any, repeated map[string]bool, name string, data []byte) {
+	var value any = string(data)
+	if !utf8.Valid(data) {
+		bytes := make([]any, 0, len(data))
+		for _, b := range data {
+			bytes = append(bytes, int(b))
+		}
+		value = bytes
+	}
+	current, found := entry[name]
+	switch {
+	case !found:
+		entry[name] = value
+	case repeated[name]:
+		entry[name] = append(current.([]any), value)
+	default:
+		entry[name] = []any{current, value}
+		repeated[name] = true
+	}
+}
+
+// journalFields converts the fields of a journal entry (from journalctl -o json) into the fields of a bunyan entry
+//
+// __REALTIME_TIMESTAMP becomes the time, PRIORITY the level, and _HOSTNAME, SYSLOG_IDENTIFIER (or _COMM), and _PID the header.
+// If the MESSAGE is a JSON object, it is parsed as a bunyan entry whose fields win over the journal ones.
+// The trusted fields (starting with _) go in the journal blob, the user fields are kept as they are.
+func journalFields(data map[string]any) map[string]any {
+	fields := map[string]any{"level": float64(30)}
+	journal := map[string]any{}
+
+	for key, value := range data {
+		switch key {
+		case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER", "SYSLOG_PID", "SYSLOG_TIMESTAMP", "SYSLOG_RAW", "_HOSTNAME", "_PID":
+		case "SYSLOG_FACILITY":
+			if facility, err := strconv.Atoi(journalString(value)); err == nil && facility >= 0 && facility < len(listen.SyslogFacilities) {
+				fields["facility"] = listen.SyslogFacilities[facility]
+			}
+		default:
+			if strings.HasPrefix(key, "__") {
+				continue // the address fields (cursor, timestamps, ...)
+			} else if strings.HasPrefix(key, "_") {
+				journal[strings.ToLower(key[1:])] = value
+			} else {
+				fields[key] = value
+			}
+		}
+	}
+	if microseconds, err := strconv.ParseInt(journalString(data[JournalTimestampField]), 10, 64); err == nil {
+		fields["time"] = time.UnixMicro(microseconds).UTC().Format(time.RFC3339Nano)
+	}
+	if priority, err := strconv.Atoi(journalString(data["PRIORITY"])); err == nil && priority >= 0 && priority < len(listen.SyslogSeverityLevels) {
+		fields["level"] = float64(listen.SyslogSeverityLevels[priority])
+	}
+	if hostname := journalString(data["_HOSTNAME"]); len(hostname) > 0 {
+		fields["hostname"] = hostname
+	}
+	if name := journalString(data["SYSLOG_IDENTIFIER"]); len(name) > 0 {
+		fields["name"] = name
+	} else if name := journalString(data["_COMM"]); len(name) > 0 {
+		fields["name"] = name
+	}
+	for _, key := range []string{"_PID", "SYSLOG_PID"} {
+		if pid, err := strconv.Atoi(journalString(data[key])); err == nil {
+			fields["pid"] = float64(pid)
+			break
+		}
+	}
+	if len(journal) > 0 {
+		fields[JournalBlob] = journal
+	}
+
+	message := journalString(data["MESSAGE"])
+	fields["msg"] = message
+	if trimmed := strings.TrimSpace(message); strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(trimmed), &payload); err == nil {
+			if _, found := payload["msg"]; !found {
+				delete(fields, "msg")
+			}
+			for key, value := range payload {
+				fields[key] = value
+			}
+		}
+	}
+	return fields
+}
+
+// journalString gets the value of a journal field as a string
+//
+// Binary values are arrays of bytes, and the first value is used for the fields given more than once
+func journalString(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case []any:
+		if len(value) == 0 {
+			return ""
+		}
+		if _, ok := value[0].(float64); !ok {
+			return journalString(value[0])
+		}
+		data := make([]byte, 0, len(value))
+		for _, b := range value {
+			if number, ok := b.(float64); ok {
+				data = append(data, byte(number))
+			}
+		}
+		return string(data)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type JournalSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestJournalSuite(t *testing.T) {
+	suite.Run(t, new(JournalSuite))
+}
+
+func (suite *JournalSuite) SetupSuite() {
+	suite.Name = "Journal"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// convert converts the given journal export into JSON lines, and decodes them
+func (suite *JournalSuite) convert(export []byte) []map[string]any {
+	var output bytes.Buffer
+	suite.Require().NoError(convertJournalExport(bufio.NewReader(bytes.NewReader(export)), &output))
+	entries := []map[string]any{}
+	for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+		var entry map[string]any
+		suite.Require().NoError(json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// fixture reads the given file of the testdata folder
+func (suite *JournalSuite) fixture(name string) []byte {
+	content, err := os.ReadFile("testdata/" + name)
+	suite.Require().NoError(err)
+	return content
+}
+
+func (suite *JournalSuite) TestCanRecognizeJournalExport() {
+	suite.Assert().True(isJournalExport(bufio.NewReader(bytes.NewReader(suite.fixture("journal.export")))))
+	suite.Assert().True(isJournalExport(bufio.NewReader(strings.NewReader("__REALTIME_TIMESTAMP=1\n"))))
+	suite.Assert().False(isJournalExport(bufio.NewReader(strings.NewReader(`{"__REALTIME_TIMESTAMP": "1"}` + "\n"))))
+	suite.Assert().False(isJournalExport(bufio.NewReader(strings.NewReader("__CURSOR=without new line"))))
+}
+
+func (suite *JournalSuite) TestCanConvertJournalExport() {
+	entries := suite.convert(suite.fixture("journal.export"))
+	suite.Require().Len(entries, 5)
+
+	suite.Assert().Equal("first line\nsecond line", entries[0]["MESSAGE"], "A binary field should be read with its size")
+	suite.Assert().Equal("1760781600123456", entries[0][JournalTimestampField])
+	suite.Assert().Equal("api.service", entries[0]["_SYSTEMD_UNIT"])
+
+	suite.Assert().Equal([]any{"a", "b", "c"}, entries[1]["TAG"], "The repeated fields should be gathered")
+	suite.Assert().Equal("tagged", entries[1]["MESSAGE"])
+
+	suite.Assert().Equal([]any{float64('c'), float64('a'), float64('f'), float64(0xe9)}, entries[2]["MESSAGE"], "The values that are not UTF-8 should be arrays of bytes")
+	suite.Assert().Equal([]any{float64(0xff), float64(0xfe)}, entries[2]["DATA"])
+
+	suite.Assert().Equal(`{"msg": "from json", "level": 50, "user": "bob"}`, entries[3]["MESSAGE"])
+	suite.Assert().Equal(`{"event": "login"}`, entries[4]["MESSAGE"], "The last entry should be written without an empty line after it")
+}
+
+func (suite *JournalSuite) TestCanReadJournalEntries() {
+	var output bytes.Buffer
+	suite.Require().NoError(convertJournalExport(bufio.NewReader(bytes.NewReader(suite.fixture("journal.export"))), &output))
+	entries := []LogEntry{}
+	for _, line := range strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n") {
+		var entry LogEntry
+		suite.Require().NoError(json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+	suite.Require().Len(entries, 5)
+
+	entry := entries[0]
+	suite.Assert().Equal(time.Date(2025, 10, 18, 10, 0, 0, 123456000, time.UTC), entry.Time.UTC())
+	suite.Assert().Equal(LogLevel(50), entry.Level)
+	suite.Assert().Equal("web-1", entry.Hostname)
+	suite.Assert().Equal("api", entry.Name)
+	suite.Assert().Equal(int64(42), entry.PID)
+	suite.Assert().Equal("first line\nsecond line", entry.Message)
+	suite.Assert().Equal("daemon", entry.Fields["facility"])
+	suite.Assert().Equal(map[string]any{"systemd_unit": "api.service"}, entry.Blobs[JournalBlob])
+	suite.Assert().Equal("api.service", entry.GetField("journal.systemd_unit"))
+	suite.Assert().NotContains(entry.Fields, "PRIORITY")
+
+	entry = entries[1]
+	suite.Assert().Equal("worker", entry.Name, "The command should name the entries without a syslog identifier")
+	suite.Assert().Equal(LogLevel(30), entry.Level)
+	suite.Assert().Equal([]any{"a", "b", "c"}, entry.Blobs["TAG"])
+
+	entry = entries[2]
+	suite.Assert().Equal("caf\xe9", entry.Message, "A binary message should be given as its bytes")
+	suite.Assert().Equal(LogLevel(40), entry.Level)
+	suite.Assert().Equal([]any{float64(0xff), float64(0xfe)}, entry.Blobs["DATA"])
+
+	entry = entries[3]
+	suite.Assert().Equal("from json", entry.Message, "The fields of a JSON message should be merged")
+	suite.Assert().Equal(LogLevel(50), entry.Level, "The level of a JSON message should win over the priority")
+	suite.Assert().Equal("bob", entry.Fields["user"])
+	suite.Assert().Equal("api", entry.Name)
+
+	entry = entries[4]
+	suite.Assert().Empty(entry.Message, "A JSON message without msg should not be kept as the message")
+	suite.Assert().Equal("login", entry.Fields["event"])
+	suite.Assert().Equal(LogLevel(30), entry.Level)
+}
+
+func (suite *JournalSuite) TestShouldRejectInvalidBinaryFields() {
+	size := func(value uint64) string { return string(binary.LittleEndian.AppendUint64(nil, value)) }
+	for name, export := range map[string]string{
+		"truncated size":   "__CURSOR=1\nMESSAGE\n\x05\x00",
+		"truncated value":  "__CURSOR=1\nMESSAGE\n" + size(10) + "short\n",
+		"no new line":      "__CURSOR=1\nMESSAGE\n" + size(2) + "abX",
+		"size too large":   "__CURSOR=1\nMESSAGE\n" + size(journalMaxFieldSize+1),
+		"size is negative": "__CURSOR=1\nMESSAGE\n" + size(1<<63),
+	} {
+		var output bytes.Buffer
+		err := convertJournalExport(bufio.NewReader(strings.NewReader(export)), &output)
+		suite.Require().Error(err, name)
+		suite.Assert().ErrorIs(err, errors.ArgumentInvalid, name)
+		suite.Assert().Empty(output.String(), name)
+	}
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/gildas/go-errors"
+	"github.com/spf13/viper"
+)
+
+// Keyring contains the keys used to decrypt the obfuscated strings of the log entries (!ENC!:{...}), they are tried in order
+//
+// The first key is the one used to obfuscate strings.
+type Keyring struct {
+	Name    string
+	ciphers []cipher.AEAD
+}
+
+// obfuscatedRex matches the obfuscated strings, as written by go-logger's Obfuscate
+var obfuscatedRex = regexp.MustCompile(`!ENC!:\{([^}]+)\}`)
+
+// LoadObfuscationKey loads an obfuscation key from the given source:
+//
+//	file:<path>      the content of the file (~ is the home directory)
+//	env:<variable>   the value of the environment variable
+//	cmd:<command>    the output of the command, run by the shell (e.g. cmd:pass show lv/prod)
+//	<key>            the key itself
+//
+// The trailing new lines of files and commands are removed.
+func LoadObfuscationKey(ctx context.Context, source string) ([]byte, error) {
+	kind, value, _ := strings.Cut(source, ":")
+	switch kind {
+	case "file":
+		if rest, found := strings.CutPrefix(value, "~/"); found {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			value = filepath.Join(home, rest)
+		}
+		content, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(string(content), "\r\n")), nil
+	case "env":
+		key, found := os.LookupEnv(value)
+		if !found || len(key) == 0 {
+			return nil, errors.EnvironmentMissing.With(value)
+		}
+		return []byte(key), nil
+	case "cmd":
+		shell, flag := "sh", "-c"
+		if runtime.GOOS == "windows" {
+			shell, flag = "cmd", "/C"
+		}
+		command := exec.CommandContext(ctx, shell, flag, value)
+		command.Stdin, command.Stderr = os.Stdin, os.Stderr // the command can prompt for a passphrase
+		output, err := command.Output()
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("Failed to run %s", value), err)
+		}
+		return []byte(strings.TrimRight(string(output), "\r\n")), nil
+	}
+	return []byte(source), nil
+}
+
+// NewKeyring creates a new Keyring with the keys loaded from the given sources (see LoadObfuscationKey)
+func NewKeyring(ctx context.Context, name string, sources []string) (*Keyring, error) {
+	keyring := &Keyring{Name: name}
+	for index, source := range sources {
+		key, err := LoadObfuscationKey(ctx, source)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("Failed to load obfuscation key %s", describeKeySource(source, index)), err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("Invalid obfuscation key %s, it must be 16, 24, or 32 bytes long", describeKeySource(source, index)), err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		keyring.ciphers = append(keyring.ciphers, gcm)
+	}
+	return keyring, nil
+}
+
+// LoadKeyring loads the keyring configured with --key (obfuscationKey) and --keyring (obfuscation.keyring)
+//
+// The key of --key is tried first, then the keys of the keyring (obfuscation.keyrings.<name>) in order.
+// The keyring is empty if none are configured.
+func LoadKeyring(ctx context.Context) (*Keyring, error) {
+	sources := []string{}
+	if key := viper.GetString("obfuscationKey"); len(key) > 0 {
+		sources = append(sources, key)
+	}
+	name := viper.GetString("obfuscation.keyring")
+	if len(name) > 0 {
+		keys := viper.GetStringSlice("obfuscation.keyrings." + name)
+		if len(keys) == 0 {
+			return nil, errors.NotFound.With("keyring", name)
+		}
+		sources = append(sources, keys...)
+	}
+	return NewKeyring(ctx, name, sources)
+}
+
+// IsEmpty tells if the keyring has no key
+func (keyring *Keyring) IsEmpty() bool {
+	return keyring == nil || len(keyring.ciphers) == 0
+}
+
+// Unobfuscate decrypts the obfuscated strings of the given value with the first key that can
+//
+// The strings that cannot be decrypted are left as they are, an error tells how many there are.
+func (keyring *Keyring) Unobfuscate(value string) (string, error) {
+	if keyring.IsEmpty() || !strings.Contains(value, "!ENC!:{") {
+		return value, nil
+	}
+	failures := 0
+	unobfuscated := obfuscatedRex.ReplaceAllStringFunc(value, func(segment string) string {
+		decrypted, err := keyring.decrypt(obfuscatedRex.FindStringSubmatch(segment)[1])
+		if err != nil {
+			failures++
+			return segment
+		}
+		return string(decrypted)
+	})
+	if failures > 0 {
+		return unobfuscated, errors.ArgumentInvalid.With("obfuscated strings", failures)
+	}
+	return unobfuscated, nil
+}
+
+// Obfuscate encrypts the given value with the first key of the keyring
+func (keyring *Keyring) Obfuscate(value string) (string, error) {
+	if keyring.IsEmpty() {
+		return "", errors.ArgumentMissing.With("obfuscation key")
+	}
+	gcm := keyring.ciphers[0]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return "!ENC!:{" + base64.URLEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)) + "}", nil
+}
+
+// decrypt decrypts the content of an obfuscated string (the base64 of the nonce and the sealed value) with the first key that can
+func (keyring *Keyring) decrypt(content string) (decrypted []byte, err error) {
+	decoded, err := base64.URLEncoding.DecodeString(content)
+	if err != nil {
+		return nil, err
+	}
+	for _, gcm := range keyring.ciphers {
+		if len(decoded) < gcm.NonceSize() {
+			return nil, errors.ArgumentInvalid.With("obfuscated string", content)
+		}
+		if decrypted, err = gcm.Open(nil, decoded[:gcm.NonceSize()], decoded[gcm.NonceSize():], nil); err == nil {
+			return decrypted, nil
+		}
+	}
+	return nil, err
+}
+
+// describeKeySource describes the source of a key in the messages, without showing the key itself
+func describeKeySource(source string, index int) string {
+	for _, prefix := range []string{"file:", "env:", "cmd:"} {
+		if strings.HasPrefix(source, prefix) {
+			return source
+		}
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+)
+
+type KeyringSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestKeyringSuite(t *testing.T) {
+	suite.Run(t, new(KeyringSuite))
+}
+
+func (suite *KeyringSuite) SetupSuite() {
+	suite.Name = "Keyring"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+const (
+	oldKey   = "old-key-0123456789abcdef-0123456" // 32 bytes
+	olderKey = "older-key-0123456789abcdef"       // 26 bytes, invalid
+	otherKey = "other-key-0123456789abcdef-01234"
+	newKey   = "new-key-0123456789abcdef" // 24 bytes
+)
+
+// configure sets the obfuscation keys of the configuration, they are cleared at the end of the test
+func (suite *KeyringSuite) configure(key, keyring string, keyrings map[string]any) {
+	suite.T().Cleanup(func() {
+		viper.Set("obfuscationKey", "")
+		viper.Set("obfuscation.keyring", "")
+		viper.Set("obfuscation.keyrings", map[string]any{})
+	})
+	viper.Set("obfuscationKey", key)
+	viper.Set("obfuscation.keyring", keyring)
+	viper.Set("obfuscation.keyrings", keyrings)
+}
+
+// keyring creates a keyring with the given keys
+func (suite *KeyringSuite) keyring(keys ...string) *Keyring {
+	keyring, err := NewKeyring(suite.ctx, "test", keys)
+	suite.Require().NoError(err)
+	return keyring
+}
+
+// obfuscate obfuscates the given value with the first key of the given keyring
+func (suite *KeyringSuite) obfuscate(keyring *Keyring, value string) string {
+	obfuscated, err := keyring.Obfuscate(value)
+	suite.Require().NoError(err)
+	return obfuscated
+}
+
+func (suite *KeyringSuite) TestCanLoadObfuscationKey() {
+	home := suite.T().TempDir()
+	suite.T().Setenv("HOME", home)
+	suite.Require().NoError(os.WriteFile(filepath.Join(home, "lv.key"), []byte(oldKey+"\r\n"), 0o600))
+	suite.T().Setenv("LV_TEST_KEY", oldKey)
+
+	for _, source := range []string{
+		oldKey,
+		"file:" + filepath.Join(home, "lv.key"),
+		"file:~/lv.key",
+		"env:LV_TEST_KEY",
+		"cmd:echo '" + oldKey + "'",
+	} {
+		key, err := LoadObfuscationKey(suite.ctx, source)
+		suite.Require().NoError(err, source)
+		suite.Assert().Equal(oldKey, string(key), source)
+	}
+}
+
+func (suite *KeyringSuite) TestShouldFailToLoadMissingKey() {
+	_, err := LoadObfuscationKey(suite.ctx, "file:"+filepath.Join(suite.T().TempDir(), "missing.key"))
+	suite.Assert().ErrorIs(err, os.ErrNotExist)
+
+	suite.T().Setenv("LV_TEST_EMPTY_KEY", "")
+	_, err = LoadObfuscationKey(suite.ctx, "env:LV_TEST_EMPTY_KEY")
+	suite.Assert().ErrorIs(err, errors.EnvironmentMissing)
+	_, err = LoadObfuscationKey(suite.ctx, "env:LV_TEST_UNKNOWN_KEY")
+	suite.Assert().ErrorIs(err, errors.EnvironmentMissing)
+
+	_, err = LoadObfuscationKey(suite.ctx, "cmd:exit 3")
+	suite.Require().Error(err)
+	suite.Assert().Contains(err.Error(), "Failed to run exit 3")
+}
+
+func (suite *KeyringSuite) TestShouldRejectInvalidKeyWithoutShowingIt() {
+	_, err := NewKeyring(suite.ctx, "test", []string{oldKey, olderKey})
+	suite.Require().Error(err)
+	suite.Assert().Contains(err.Error(), "#2")
+	suite.Assert().NotContains(err.Error(), olderKey)
+
+	suite.T().Setenv("LV_TEST_KEY", olderKey)
+	_, err = NewKeyring(suite.ctx, "test", []string{"env:LV_TEST_KEY"})
+	suite.Require().Error(err)
+	suite.Assert().Contains(err.Error(), "env:LV_TEST_KEY")
+	suite.Assert().NotContains(err.Error(), olderKey)
+}
+
+func (suite *KeyringSuite) TestCanLoadKeyringFromConfiguration() {
+	suite.T().Setenv("LV_TEST_KEY", otherKey)
+	suite.configure(newKey, "prod", map[string]any{"prod": []string{oldKey, "env:LV_TEST_KEY"}})
+
+	keyring, err := LoadKeyring(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("prod", keyring.Name)
+	for _, key := range []string{newKey, oldKey, otherKey} {
+		unobfuscated, err := keyring.Unobfuscate(suite.obfuscate(suite.keyring(key), "secret"))
+		suite.Require().NoError(err, "Every key of the keyring should be tried")
+		suite.Assert().Equal("secret", unobfuscated)
+	}
+	suite.Assert().Equal(newKey, suite.mustUnobfuscate(newKey, suite.obfuscate(keyring, newKey)), "The key of --key should obfuscate")
+
+	suite.configure(newKey, "unknown", map[string]any{"prod": []string{oldKey}})
+	_, err = LoadKeyring(suite.ctx)
+	suite.Assert().ErrorIs(err, errors.NotFound)
+
+	suite.configure("", "", nil)
+	keyring, err = LoadKeyring(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Assert().True(keyring.IsEmpty())
+}
+
+// mustUnobfuscate unobfuscates the given value with a keyring of only the given key
+func (suite *KeyringSuite) mustUnobfuscate(key, value string) string {
+	unobfuscated, err := suite.keyring(key).Unobfuscate(value)
+	suite.Require().NoError(err)
+	return unobfuscated
+}
+
+func (suite *KeyringSuite) TestCanUnobfuscateStrings() {
+	keyring := suite.keyring(oldKey, otherKey)
+	value := "user " + suite.obfuscate(suite.keyring(oldKey), "bob") + " paid with " + suite.obfuscate(suite.keyring(otherKey), "4111")
+	unobfuscated, err := keyring.Unobfuscate(value)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("user bob paid with 4111", unobfuscated)
+
+	unknown := suite.obfuscate(suite.keyring(newKey), "hidden")
+	unobfuscated, err = keyring.Unobfuscate("a " + unknown + " and !ENC!:{not base64} and " + suite.obfuscate(keyring, "b"))
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+	suite.Assert().Equal("a "+unknown+" and !ENC!:{not base64} and b", unobfuscated, "The strings that cannot be decrypted should be left as they are")
+
+	unobfuscated, err = (&Keyring{}).Unobfuscate(unknown)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(unknown, unobfuscated, "An empty keyring should leave the strings as they are")
+	_, err = (&Keyring{}).Obfuscate("secret")
+	suite.Assert().ErrorIs(err, errors.ArgumentMissing)
+}
+
+func (suite *KeyringSuite) TestCanRotateObfuscation() {
+	oldKeyring := suite.keyring(oldKey, otherKey)
+	undecryptable := suite.obfuscate(suite.keyring(newKey), "lost")
+	input := `{"msg": "user ` + suite.obfuscate(suite.keyring(oldKey), "bob") + `", "card": "` + suite.obfuscate(suite.keyring(otherKey), "4111") + `"}` + "\n" +
+		"plain line\n" +
+		`{"msg": "` + undecryptable + `"}`
+
+	var output bytes.Buffer
+	rotated, failed, err := rotateObfuscation(strings.NewReader(input), &output, oldKeyring, suite.keyring(newKey))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(2, rotated)
+	suite.Assert().Equal(1, failed)
+
+	lines := strings.Split(output.String(), "\n")
+	suite.Require().Len(lines, 3, "The lines should be kept, without adding a new line at the end")
+	suite.Assert().NotContains(lines[0], "bob")
+	suite.Assert().Equal(`{"msg": "user bob", "card": "4111"}`, suite.mustUnobfuscate(newKey, lines[0]), "The new key should decrypt the rotated strings")
+	_, err = oldKeyring.Unobfuscate(lines[0])
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid, "The old keys should not decrypt the rotated strings")
+	suite.Assert().Equal("plain line", lines[1])
+	suite.Assert().Equal(`{"msg": "`+undecryptable+`"}`, lines[2], "The strings that cannot be decrypted should be left as they are")
+}
+
+func (suite *KeyringSuite) TestCanRotateFileInPlace() {
+	defer func() { ObfuscationOptions.NewKey, ObfuscationOptions.InPlace = "", false }()
+	path := filepath.Join(suite.T().TempDir(), "app.log")
+	suite.Require().NoError(os.WriteFile(path, []byte(`{"msg": "`+suite.obfuscate(suite.keyring(oldKey), "secret")+`"}`+"\n"), 0o640))
+	suite.configure(oldKey, "", nil)
+	ObfuscationOptions.NewKey, ObfuscationOptions.InPlace = newKey, true
+
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { _ = os.Stderr.Close(); os.Stderr = stderr }()
+	cmd := &cobra.Command{}
+	cmd.SetContext(suite.ctx)
+	suite.Require().NoError(runObfuscationRotateCommand(cmd, []string{path}))
+
+	content, err := os.ReadFile(path)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(`{"msg": "secret"}`+"\n", suite.mustUnobfuscate(newKey, string(content)))
+	info, err := os.Stat(path)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(os.FileMode(0o640), info.Mode().Perm(), "The permissions of the file should be kept")
+	entries, err := os.ReadDir(filepath.Dir(path))
+	suite.Require().NoError(err)
+	suite.Assert().Len(entries, 1, "No temporary file should be left")
+}
@@ -4,11 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
+	"regexp"
 	"slices"
+	"strings"
 
+	"github.com/gildas/go-errors"
 	"github.com/gildas/go-logger"
 	"github.com/gildas/lv/cmd/common"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
 )
 
 type HelmRelease struct {
@@ -21,29 +29,185 @@ type HelmRelease struct {
 	AppVersion string `json:"app_version"`
 }
 
+// helmWorkload is the part of a workload in a Helm manifest that tells which pods it manages
+type helmWorkload struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Selector *metav1.LabelSelector `json:"selector"`
+		Template helmPodTemplate       `json:"template"`
+	} `json:"spec"`
+}
+
+type helmPodTemplate struct {
+	Metadata struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+}
+
+// chartVersion matches the version at the end of a chart (e.g. "-1.2.3" in "nginx-1.2.3")
+var chartVersion = regexp.MustCompile(`-v?\d+(\.\d+)*([-+][0-9A-Za-z.-]+)?$`)
+
 // GetReleases gets the helm releases for the current context
 func GetReleases(ctx context.Context, cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
 	log := logger.Must(logger.FromContext(ctx)).Child("helm", "releases")
-	var stdout, stderr bytes.Buffer
 
 	kubectlContext, err := GetCurrentContext(ctx, cmd)
 	if err != nil {
 		log.Errorf("Error getting current context: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
 
 	kubectlNamespace, err := GetCurrentNamespace(ctx, cmd, kubectlContext)
 	if err != nil {
 		log.Errorf("Error getting current namespace: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
 
 	log.Debugf("Getting names for completion with args: %s", args)
-	err = NewHelm().Exec(ctx, []string{"list", "--kube-context", kubectlContext, "--namespace", kubectlNamespace, "-o", "json"}, &stdout, &stderr)
+	helmReleases, err := listReleases(ctx, kubectlContext, kubectlNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := []string{}
+	for _, release := range helmReleases {
+		if !slices.Contains(releases, release.Name) {
+			releases = append(releases, release.Name)
+		}
+	}
+
+	return common.FilterValidArgs(releases, args, toComplete), nil
+}
+
+// GetRelease gets the helm release with the given name
+//
+// If kubeContext or namespace are empty, helm uses the current ones
+func GetRelease(ctx context.Context, kubeContext, namespace, name string) (*HelmRelease, error) {
+	releases, err := listReleases(ctx, kubeContext, namespace, "--filter", "^"+regexp.QuoteMeta(name)+"$")
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		if release.Name == name {
+			return &release, nil
+		}
+	}
+	return nil, errors.NotFound.With("release", name)
+}
+
+// GetReleaseChart gets the name of the chart of the given helm release from its metadata
+func GetReleaseChart(ctx context.Context, kubeContext, namespace, name string) (string, error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("helm", "metadata")
+	var stdout, stderr bytes.Buffer
+
+	err := NewHelm().Exec(ctx, helmArgs([]string{"get", "metadata", name, "-o", "json"}, kubeContext, namespace), &stdout, &stderr)
+	if err != nil {
+		log.Errorf("Error getting metadata of release %s: ", name, err)
+		log.Errorf("Stderr: %s", stderr.String())
+		return "", err
+	}
+
+	var metadata struct {
+		Chart string `json:"chart"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &metadata); err != nil {
+		log.Errorf("Error unmarshalling metadata of release %s: ", name, err)
+		return "", errors.JSONUnmarshalError.Wrap(err)
+	}
+	return metadata.Chart, nil
+}
+
+// GetReleaseSelectors gets the label selectors of the pods managed by the workloads of the given helm release
+//
+// The workloads are read from the manifest of the release (deployments, statefulsets, daemonsets, replicasets, jobs, cronjobs, and pods).
+// The pods of the cronjobs are selected by the jobs they own, which are looked for with the given clientset.
+func GetReleaseSelectors(ctx context.Context, clientset kubernetes.Interface, kubeContext, namespace, name string) ([]string, error) {
+	selectors, _, err := releaseSelectors(ctx, clientset, kubeContext, namespace, name)
+	return selectors, err
+}
+
+// releaseSelectors gets the label selectors of the pods managed by the workloads of the given helm release, and the selectors of its cronjobs by name
+func releaseSelectors(ctx context.Context, clientset kubernetes.Interface, kubeContext, namespace, name string) ([]string, map[string]string, error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("helm", "manifest")
+	var stdout, stderr bytes.Buffer
+
+	err := NewHelm().Exec(ctx, helmArgs([]string{"get", "manifest", name}, kubeContext, namespace), &stdout, &stderr)
 	if err != nil {
-		log.Errorf("Error getting names: ", err)
+		log.Errorf("Error getting manifest of release %s: ", name, err)
+		log.Errorf("Stderr: %s", stderr.String())
+		return nil, nil, err
+	}
+
+	selectors := []string{}
+	cronJobs := map[string]string{}
+	decoder := yaml.NewYAMLOrJSONDecoder(&stdout, 4096)
+	for {
+		var workload helmWorkload
+		if err := decoder.Decode(&workload); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			log.Errorf("Error decoding manifest of release %s: ", name, err)
+			return nil, nil, err
+		}
+		selector := workload.selector()
+		if workload.Kind == "CronJob" {
+			if selector, err = cronJobSelector(ctx, clientset, namespace, workload.Metadata.Name); err != nil {
+				log.Debugf("Ignoring cronjob %s: %s", workload.Metadata.Name, err)
+				continue
+			}
+			cronJobs[workload.Metadata.Name] = selector
+		}
+		if len(selector) > 0 && !slices.Contains(selectors, selector) {
+			log.Debugf("Workload %s/%s selects pods with %s", strings.ToLower(workload.Kind), workload.Metadata.Name, selector)
+			selectors = append(selectors, selector)
+		}
+	}
+	if len(selectors) == 0 {
+		return nil, nil, errors.NotFound.With("workloads in release", name)
+	}
+	return selectors, cronJobs, nil
+}
+
+// ChartName returns the name of the chart of the release, without its version
+func (release HelmRelease) ChartName() string {
+	return chartVersion.ReplaceAllString(release.Chart, "")
+}
+
+// selector returns the label selector of the pods managed by the workload, empty if it is not a workload
+func (workload helmWorkload) selector() string {
+	var labelSet map[string]string
+
+	switch workload.Kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		if workload.Spec.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(workload.Spec.Selector)
+			if err != nil {
+				return ""
+			}
+			return selector.String()
+		}
+		labelSet = workload.Spec.Template.Metadata.Labels // Jobs usually get their selector from the API server
+	case "Pod":
+		labelSet = workload.Metadata.Labels
+	}
+	if len(labelSet) == 0 {
+		return ""
+	}
+	return labels.SelectorFromSet(labelSet).String()
+}
+
+// listReleases lists the helm releases, if kubeContext or namespace are empty, helm uses the current ones
+func listReleases(ctx context.Context, kubeContext, namespace string, args ...string) ([]HelmRelease, error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("helm", "releases")
+	var stdout, stderr bytes.Buffer
+
+	err := NewHelm().Exec(ctx, helmArgs(append([]string{"list", "-o", "json"}, args...), kubeContext, namespace), &stdout, &stderr)
+	if err != nil {
+		log.Errorf("Error getting releases: ", err)
 		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
@@ -54,13 +218,16 @@ func GetReleases(ctx context.Context, cmd *cobra.Command, args []string, toCompl
 		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
+	return helmReleases, nil
+}
 
-	releases := []string{}
-	for _, release := range helmReleases {
-		if !slices.Contains(releases, release.Name) {
-			releases = append(releases, release.Name)
-		}
+// helmArgs adds the context and namespace arguments if they are given
+func helmArgs(args []string, kubeContext, namespace string) []string {
+	if len(kubeContext) > 0 {
+		args = append(args, "--kube-context", kubeContext)
 	}
-
-	return common.FilterValidArgs(releases, args, toComplete), nil
+	if len(namespace) > 0 {
+		args = append(args, "--namespace", namespace)
+	}
+	return args
 }
@@ -0,0 +1,422 @@
+package kubectl
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// BundleMetadataFile is the file of a bundle that describes the recorded session
+const BundleMetadataFile = "metadata.json"
+
+// bundleEventsFile is the file of a bundle that contains the events and the banners of the recorded session
+const bundleEventsFile = "events.jsonl"
+
+// bundleVersion is the version of the bundle format
+const bundleVersion = 1
+
+// Bundle describes a Kubernetes session recorded with --record
+//
+// A bundle is a directory (or a tarball of that directory) with:
+//   - metadata.json: this description,
+//   - streams/{context}/{namespace}/{pod}/{container}.log: the lines of each container, prefixed with their time,
+//   - events.jsonl: the events and the banners, as JSON Lines.
+type Bundle struct {
+	Version  int            `json:"version"`
+	Recorded time.Time      `json:"recorded"`
+	Start    time.Time      `json:"start"`
+	End      time.Time      `json:"end"`
+	Prefix   bool           `json:"prefix"`
+	Tagged   bool           `json:"tagged"`
+	Targets  []BundleTarget `json:"targets"`
+	Streams  []BundleStream `json:"streams"`
+}
+
+// BundleTarget describes what was streamed in a context and namespace
+type BundleTarget struct {
+	Context      string   `json:"context"`
+	Namespace    string   `json:"namespace"`
+	Pod          string   `json:"pod,omitempty"`
+	Selector     string   `json:"selector,omitempty"`
+	PodSelectors []string `json:"podSelectors,omitempty"`
+	Release      string   `json:"release,omitempty"`
+}
+
+// BundleStream describes the recorded lines of a container
+type BundleStream struct {
+	Source
+	File  string    `json:"file"`
+	Lines int       `json:"lines"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Recorder records the lines of a Kubernetes session into a bundle
+type Recorder struct {
+	Path   string // The bundle directory or tarball (.tar, .tar.gz, .tgz)
+	dir    string // The directory the bundle is written to, a temporary one for tarballs
+	bundle Bundle
+	files  map[string]*os.File // the stream files by name
+	events *os.File
+	lock   sync.Mutex
+}
+
+// bundleUnsafe matches the characters that are replaced in the file names of a bundle
+var bundleUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// NewRecorder creates a new Recorder that writes the lines of the given streamers to the bundle at the given path
+//
+// If the path ends with .tar, .tar.gz, or .tgz, the bundle is written as a tarball when the Recorder is closed.
+func NewRecorder(bundlePath string, streamers []*Streamer, prefix, tagged bool) (recorder *Recorder, err error) {
+	recorder = &Recorder{
+		Path:  bundlePath,
+		dir:   bundlePath,
+		files: map[string]*os.File{},
+		bundle: Bundle{
+			Version:  bundleVersion,
+			Recorded: time.Now().UTC(),
+			Prefix:   prefix,
+			Tagged:   tagged,
+			Targets:  []BundleTarget{},
+			Streams:  []BundleStream{},
+		},
+	}
+	for _, streamer := range streamers {
+		recorder.bundle.Targets = append(recorder.bundle.Targets, BundleTarget{
+			Context:      streamer.Client.Context,
+			Namespace:    streamer.Client.Namespace,
+			Pod:          streamer.Pod,
+			Selector:     streamer.Selector,
+			PodSelectors: streamer.PodSelectors,
+			Release:      streamer.Release,
+		})
+	}
+	if isTarball(bundlePath) {
+		if recorder.dir, err = os.MkdirTemp("", "lv-bundle-"); err != nil {
+			return nil, err
+		}
+	} else if err = os.MkdirAll(bundlePath, 0o755); err != nil {
+		return nil, err
+	}
+	if recorder.events, err = os.Create(filepath.Join(recorder.dir, bundleEventsFile)); err != nil {
+		return nil, err
+	}
+	return recorder, recorder.writeMetadata()
+}
+
+// Record records the given line
+//
+// Log lines are written to the file of their container, events and banners to the events file
+func (recorder *Recorder) Record(line Line) (err error) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	if !line.Time.IsZero() && (recorder.bundle.Start.IsZero() || line.Time.Before(recorder.bundle.Start)) {
+		recorder.bundle.Start = line.Time
+	}
+	if line.Time.After(recorder.bundle.End) {
+		recorder.bundle.End = line.Time
+	}
+	if line.Event != nil || line.Banner != NoBanner {
+		payload, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		_, err = recorder.events.Write(append(payload, '\n'))
+		return err
+	}
+
+	name := path.Join("streams", bundleName(line.Source.Context), bundleName(line.Source.Namespace), bundleName(line.Source.Pod), bundleName(line.Source.Container)+".log")
+	file, found := recorder.files[name]
+	if !found {
+		if err = os.MkdirAll(filepath.Join(recorder.dir, filepath.FromSlash(path.Dir(name))), 0o755); err != nil {
+			return err
+		}
+		if file, err = os.Create(filepath.Join(recorder.dir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+		recorder.files[name] = file
+		recorder.bundle.Streams = append(recorder.bundle.Streams, BundleStream{Source: line.Source, File: name, Start: line.Time})
+		defer func() {
+			if err == nil {
+				err = recorder.writeMetadata() // so the stream is known even if the session is killed
+			}
+		}()
+	}
+	for index := range recorder.bundle.Streams {
+		if stream := &recorder.bundle.Streams[index]; stream.File == name {
+			stream.Lines++
+			stream.End = line.Time
+		}
+	}
+	_, err = file.WriteString(line.Time.UTC().Format(time.RFC3339Nano) + " " + line.Text + "\n")
+	return err
+}
+
+// Close closes the files of the bundle and writes its metadata, tarballs are written now
+func (recorder *Recorder) Close() error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	var merr errors.MultiError
+
+	for _, file := range recorder.files {
+		merr.Append(file.Close())
+	}
+	merr.Append(recorder.events.Close())
+	merr.Append(recorder.writeMetadata())
+	if isTarball(recorder.Path) {
+		merr.Append(writeTarball(recorder.Path, recorder.dir))
+		merr.Append(os.RemoveAll(recorder.dir))
+	}
+	return merr.AsError()
+}
+
+// writeMetadata writes the metadata file of the bundle
+func (recorder *Recorder) writeMetadata() error {
+	payload, err := json.MarshalIndent(recorder.bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(recorder.dir, BundleMetadataFile), payload, 0o644)
+}
+
+// IsBundle tells if the given path is a bundle recorded with --record (a directory or a tarball with a metadata file)
+func IsBundle(bundlePath string) bool {
+	if isTarball(bundlePath) {
+		return tarballContains(bundlePath, BundleMetadataFile)
+	}
+	info, err := os.Stat(filepath.Join(bundlePath, BundleMetadataFile))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// OpenBundle reads the bundle at the given path and returns its description and its lines sorted by time
+//
+// The files of a tarball are read as they come in the archive, the archive is not loaded in memory.
+func OpenBundle(bundlePath string) (*Bundle, []Line, error) {
+	bundle, err := readBundleMetadata(bundlePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	streams := map[string]BundleStream{}
+	for _, stream := range bundle.Streams {
+		streams[path.Clean(stream.File)] = stream
+	}
+	lines := []Line{}
+	readFile := func(name string, reader io.Reader) error {
+		if name == bundleEventsFile {
+			events, err := readBundleEvents(reader)
+			lines = append(lines, events...)
+			return err
+		}
+		if stream, found := streams[name]; found {
+			delete(streams, name)
+			streamLines, err := readBundleStream(reader, stream)
+			lines = append(lines, streamLines...)
+			return err
+		}
+		return nil
+	}
+
+	if isTarball(bundlePath) {
+		err = walkTarball(bundlePath, func(name string, reader io.Reader) (bool, error) {
+			return false, readFile(name, reader)
+		})
+	} else {
+		names := []string{bundleEventsFile}
+		for _, stream := range bundle.Streams {
+			names = append(names, path.Clean(stream.File))
+		}
+		for _, name := range names {
+			file, ferr := os.Open(filepath.Join(bundlePath, filepath.FromSlash(name)))
+			if name == bundleEventsFile && errors.Is(ferr, os.ErrNotExist) {
+				continue // the events file is optional
+			} else if ferr != nil {
+				err = ferr
+				break
+			}
+			err = readFile(name, file)
+			_ = file.Close()
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, stream := range bundle.Streams {
+		if _, missing := streams[path.Clean(stream.File)]; missing {
+			return nil, nil, errors.NotFound.With("file", stream.File)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	return bundle, lines, nil
+}
+
+// readBundleMetadata reads the metadata file of the bundle at the given path
+func readBundleMetadata(bundlePath string) (*Bundle, error) {
+	var payload []byte
+	var err error
+	if isTarball(bundlePath) {
+		err = walkTarball(bundlePath, func(name string, reader io.Reader) (bool, error) {
+			if name != BundleMetadataFile {
+				return false, nil
+			}
+			payload, err = io.ReadAll(reader)
+			return true, err
+		})
+		if err == nil && payload == nil {
+			err = errors.NotFound.With("file", BundleMetadataFile)
+		}
+	} else {
+		payload, err = os.ReadFile(filepath.Join(bundlePath, BundleMetadataFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle Bundle
+	if err := json.Unmarshal(payload, &bundle); err != nil {
+		return nil, errors.JSONUnmarshalError.Wrap(err)
+	}
+	if bundle.Version > bundleVersion {
+		return nil, errors.Unsupported.With("bundle version", bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// readBundleStream reads the lines of the given stream, prefixed with their time
+func readBundleStream(reader io.Reader, stream BundleStream) ([]Line, error) {
+	lines := []Line{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		timestamp, text, _ := strings.Cut(scanner.Text(), " ")
+		line := Line{Source: stream.Source, Text: text}
+		line.Time, _ = time.Parse(time.RFC3339Nano, timestamp)
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// readBundleEvents reads the events and the banners, as JSON Lines
+func readBundleEvents(reader io.Reader) ([]Line, error) {
+	lines := []Line{}
+	decoder := json.NewDecoder(reader)
+	for {
+		var line Line
+		if err := decoder.Decode(&line); errors.Is(err, io.EOF) {
+			return lines, nil
+		} else if err != nil {
+			return nil, errors.JSONUnmarshalError.Wrap(err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// walkTarball calls the given func with the name and the content of each file of the given tarball, until it tells to stop
+func walkTarball(tarballPath string, walk func(name string, reader io.Reader) (stop bool, err error)) error {
+	archive, closeArchive, err := openTarball(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if stop, err := walk(path.Clean(header.Name), archive); stop || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// tarballContains tells if the tarball at the given path is readable and contains the given file, the contents are not read
+func tarballContains(tarballPath, name string) bool {
+	found := false
+	err := walkTarball(tarballPath, func(entry string, reader io.Reader) (bool, error) {
+		found = entry == name
+		return found, nil
+	})
+	return err == nil && found
+}
+
+// openTarball opens the tarball at the given path, it is decompressed unless it ends with .tar
+func openTarball(tarballPath string) (*tar.Reader, func(), error) {
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.HasSuffix(tarballPath, ".tar") {
+		return tar.NewReader(file), func() { _ = file.Close() }, nil
+	}
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(gzipReader), func() { _ = gzipReader.Close(); _ = file.Close() }, nil
+}
+
+// writeTarball writes the files of the given directory into a tarball, compressed unless it ends with .tar
+func writeTarball(tarballPath, dir string) (err error) {
+	file, err := os.Create(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	var writer io.Writer = file
+	if !strings.HasSuffix(tarballPath, ".tar") {
+		gzipWriter := gzip.NewWriter(file)
+		defer func() {
+			if cerr := gzipWriter.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		writer = gzipWriter
+	}
+	archive := tar.NewWriter(writer)
+	defer func() {
+		if cerr := archive.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	return archive.AddFS(os.DirFS(dir))
+}
+
+// isTarball tells if the given path is a tarball by its extension
+func isTarball(bundlePath string) bool {
+	return strings.HasSuffix(bundlePath, ".tar") || strings.HasSuffix(bundlePath, ".tar.gz") || strings.HasSuffix(bundlePath, ".tgz")
+}
+
+// bundleName converts the given value into a file name
+func bundleName(value string) string {
+	if len(value) == 0 {
+		return "_"
+	}
+	return bundleUnsafe.ReplaceAllString(value, "_")
+}
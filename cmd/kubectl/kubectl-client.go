@@ -0,0 +1,133 @@
+package kubectl
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Client is a Kubernetes client configured from the kubeconfig and the kubectl flags
+type Client struct {
+	Clientset kubernetes.Interface
+	Context   string
+	Namespace string
+}
+
+// NewClient creates a new Client from the kubeconfig and the kubectl flags of the given command
+//
+// The flags --kubeconfig, --context, --cluster, --user, --namespace, --as*, --server, --token, and the TLS flags are honored like kubectl does.
+// If --context or --namespace contain more than one value (or globs), the current ones are used.
+func NewClient(cmd *cobra.Command) (*Client, error) {
+	return NewClientFor(cmd, singleFlagValue(cmd, "context"), singleFlagValue(cmd, "namespace"))
+}
+
+// NewClientFor creates a new Client for the given context and namespace, the other kubectl flags of the given command are honored
+//
+// If kubeContext or namespace are empty, the current ones are used
+func NewClientFor(cmd *cobra.Command, kubeContext, namespace string) (*Client, error) {
+	config := loadClientConfig(cmd, kubeContext, namespace)
+
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	currentNamespace, _, err := config.Namespace()
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := config.RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	currentContext := rawConfig.CurrentContext
+	if len(kubeContext) > 0 {
+		currentContext = kubeContext
+	}
+	return &Client{Clientset: clientset, Context: currentContext, Namespace: currentNamespace}, nil
+}
+
+// loadClientConfig loads the kubeconfig with the given context and namespace, and the overrides given by the kubectl flags of the command
+func loadClientConfig(cmd *cobra.Command, kubeContext, namespace string) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = flagString(cmd, "kubeconfig")
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: kubeContext,
+		Context: clientcmdapi.Context{
+			Cluster:   flagString(cmd, "cluster"),
+			AuthInfo:  flagString(cmd, "user"),
+			Namespace: namespace,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			ClientCertificate: flagString(cmd, "client-certificate"),
+			ClientKey:         flagString(cmd, "client-key"),
+			Token:             flagString(cmd, "token"),
+			Impersonate:       flagString(cmd, "as"),
+			ImpersonateUID:    flagString(cmd, "as-uid"),
+			ImpersonateGroups: flagStringArray(cmd, "as-group"),
+			Username:          flagString(cmd, "username"),
+			Password:          flagString(cmd, "password"),
+		},
+		ClusterInfo: clientcmdapi.Cluster{
+			Server:                flagString(cmd, "server"),
+			TLSServerName:         flagString(cmd, "tls-server-name"),
+			CertificateAuthority:  flagString(cmd, "certificate-authority"),
+			InsecureSkipTLSVerify: flagBool(cmd, "insecure-skip-tls-verify"),
+			DisableCompression:    flagBool(cmd, "disable-compression"),
+		},
+		Timeout: flagString(cmd, "request-timeout"),
+	}
+	for _, extra := range flagStringArray(cmd, "as-user-extra") {
+		if key, value, found := strings.Cut(extra, "="); found {
+			if overrides.AuthInfo.ImpersonateUserExtra == nil {
+				overrides.AuthInfo.ImpersonateUserExtra = map[string][]string{}
+			}
+			overrides.AuthInfo.ImpersonateUserExtra[key] = append(overrides.AuthInfo.ImpersonateUserExtra[key], value)
+		}
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// flagString returns the value of the given flag if it was set in the command line
+func flagString(cmd *cobra.Command, name string) string {
+	if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	return ""
+}
+
+// singleFlagValue returns the value of the given list flag if it was set in the command line with only one value that is not a glob
+func singleFlagValue(cmd *cobra.Command, name string) string {
+	if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+		if list, ok := flag.Value.(*ListFlag); ok {
+			return list.Single()
+		}
+		return flag.Value.String()
+	}
+	return ""
+}
+
+// flagBool returns the value of the given boolean flag if it was set in the command line
+func flagBool(cmd *cobra.Command, name string) bool {
+	if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+		value, _ := cmd.Flags().GetBool(name)
+		return value
+	}
+	return false
+}
+
+// flagStringArray returns the values of the given string array flag if it was set in the command line
+func flagStringArray(cmd *cobra.Command, name string) []string {
+	if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+		values, _ := cmd.Flags().GetStringArray(name)
+		return values
+	}
+	return nil
+}
@@ -1,9 +1,7 @@
 package kubectl
 
 import (
-	"bytes"
 	"context"
-	"strings"
 
 	"github.com/gildas/go-logger"
 	"github.com/gildas/lv/cmd/common"
@@ -13,18 +11,16 @@ import (
 // GetContexts gets the contexts for the current kubeconfig
 func GetContexts(ctx context.Context, cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
 	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "contexts")
-	var stdout, stderr bytes.Buffer
 
 	log.Debugf("Getting contexts for completion with args: %s", args)
-	err := NewKubectl().Exec(ctx, []string{"config", "get-contexts", "-o", "name"}, &stdout, &stderr)
+	rawConfig, err := loadClientConfig(cmd, "", "").RawConfig()
 	if err != nil {
 		log.Errorf("Error getting contexts: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
 
 	contexts := []string{}
-	for context := range strings.FieldsSeq(stdout.String()) {
+	for context := range rawConfig.Contexts {
 		contexts = append(contexts, context)
 	}
 
@@ -35,18 +31,15 @@ func GetContexts(ctx context.Context, cmd *cobra.Command, args []string, toCompl
 func GetCurrentContext(ctx context.Context, cmd *cobra.Command) (string, error) {
 	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "current-context")
 
-	if cmd.Flags().Changed("context") {
-		return cmd.Flags().Lookup("context").Value.String(), nil
+	if value := singleFlagValue(cmd, "context"); len(value) > 0 {
+		return value, nil
 	}
 
-	var stdout, stderr bytes.Buffer
-
 	log.Debugf("Getting current context")
-	err := NewKubectl().Exec(ctx, []string{"config", "current-context"}, &stdout, &stderr)
+	rawConfig, err := loadClientConfig(cmd, "", "").RawConfig()
 	if err != nil {
 		log.Errorf("Error getting current context: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
 		return "", err
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return rawConfig.CurrentContext, nil
 }
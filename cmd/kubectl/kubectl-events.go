@@ -0,0 +1,289 @@
+package kubectl
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-logger"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// eventMergeDelay is how long the lines are held while following, so the events that come late can be merged by time with the log lines
+const eventMergeDelay = 2 * time.Second
+
+// eventMatcher tells if an event is about one of the streamed pods
+type eventMatcher struct {
+	streamer *Streamer
+	pods     map[string]bool // cache of the pods that match the selectors or not
+	streamed map[string]bool // the pods whose lines were streamed, they match even if they are deleted
+	lock     sync.Mutex
+}
+
+// lineMerger holds the lines for eventMergeDelay and inserts the events among the held log lines by time
+type lineMerger struct {
+	handle func(line Line)
+	held   []heldLine
+	lock   sync.Mutex
+}
+
+type heldLine struct {
+	line     Line
+	received time.Time
+}
+
+// streamSorted streams the log lines and the events, then sends them sorted by time to the handler
+//
+// The logs are streamed first, so the events of the streamed pods that were deleted since are kept.
+func (streamer *Streamer) streamSorted(ctx context.Context, handle func(line Line)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "events")
+	matcher := streamer.newEventMatcher()
+
+	lines := []Line{}
+	err := streamer.streamLogs(ctx, matcher.record(func(line Line) { lines = append(lines, line) }))
+	events, _, eventErr := streamer.listEvents(ctx, matcher)
+	if eventErr != nil {
+		log.Errorf("Failed to get the events, only the logs will be shown", eventErr)
+	}
+	lines = append(lines, events...)
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	for _, line := range lines {
+		handle(line)
+	}
+	return err
+}
+
+// streamMerged streams the log lines and the events until the context is done, the events are merged by time with the held log lines
+func (streamer *Streamer) streamMerged(ctx context.Context, handle func(line Line)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	matcher := streamer.newEventMatcher()
+	merger := &lineMerger{handle: handle}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		merger.run(ctx)
+	}()
+	go streamer.streamEvents(ctx, matcher, merger.add)
+	err := streamer.streamLogs(ctx, matcher.record(merger.add))
+	cancel()
+	<-done
+	return err
+}
+
+// streamEvents sends the current events and watches the new ones until the context is done
+func (streamer *Streamer) streamEvents(ctx context.Context, matcher *eventMatcher, handle func(line Line)) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "events")
+
+	lines, version, err := streamer.listEvents(ctx, matcher)
+	if err != nil {
+		log.Errorf("Failed to get the events, only the logs will be shown", err)
+		return
+	}
+	for _, line := range lines {
+		streamer.emit(handle, line)
+	}
+
+	events := streamer.Client.Clientset.CoreV1().Events(streamer.Client.Namespace)
+	for ctx.Err() == nil {
+		log.Debugf("Watching events from resource version %s", version)
+		eventWatch, err := events.Watch(ctx, metav1.ListOptions{FieldSelector: "involvedObject.kind=Pod", ResourceVersion: version})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errorf("Failed to watch the events", err)
+			}
+			return
+		}
+		version = streamer.processEvents(ctx, eventWatch, matcher, handle)
+		eventWatch.Stop()
+		if len(version) == 0 && ctx.Err() == nil {
+			// the resource version is too old, we start again from the current events
+			if _, version, err = streamer.listEvents(ctx, matcher); err != nil {
+				log.Errorf("Failed to get the events", err)
+				return
+			}
+		}
+	}
+}
+
+// processEvents sends the watched events until the watch expires and returns the last resource version
+//
+// If the watch failed, an empty resource version is returned
+func (streamer *Streamer) processEvents(ctx context.Context, eventWatch watch.Interface, matcher *eventMatcher, handle func(line Line)) (version string) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "events")
+
+	for event := range eventWatch.ResultChan() {
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			if item, ok := event.Object.(*corev1.Event); ok {
+				version = item.ResourceVersion
+				if matcher.matches(ctx, item) {
+					streamer.emit(handle, streamer.eventLine(item))
+				}
+			}
+		case watch.Error:
+			log.Warnf("Event watch failed: %v", event.Object)
+			return ""
+		}
+	}
+	return version
+}
+
+// listEvents gets the current events of the streamed pods sorted by time, and the resource version to watch from
+func (streamer *Streamer) listEvents(ctx context.Context, matcher *eventMatcher) (lines []Line, version string, err error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "events")
+
+	log.Debugf("Getting events in namespace %s", streamer.Client.Namespace)
+	list, err := streamer.Client.Clientset.CoreV1().Events(streamer.Client.Namespace).List(ctx, metav1.ListOptions{FieldSelector: "involvedObject.kind=Pod"})
+	if err != nil {
+		return nil, "", err
+	}
+	since := streamer.since()
+	for index := range list.Items {
+		event := &list.Items[index]
+		if line := streamer.eventLine(event); line.Time.After(since) && matcher.matches(ctx, event) {
+			lines = append(lines, line)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	log.Debugf("Found %d events", len(lines))
+	return lines, list.ResourceVersion, nil
+}
+
+// since gets the time from which the events are shown, according to --since and --since-time
+func (streamer *Streamer) since() time.Time {
+	if streamer.LogOptions.SinceSeconds != nil {
+		return time.Now().Add(-time.Duration(*streamer.LogOptions.SinceSeconds) * time.Second)
+	}
+	if streamer.LogOptions.SinceTime != nil {
+		return streamer.LogOptions.SinceTime.Time
+	}
+	return time.Time{}
+}
+
+// eventLine converts the given event into a Line
+func (streamer *Streamer) eventLine(event *corev1.Event) Line {
+	line := Line{
+		Source: Source{
+			Context:   streamer.Client.Context,
+			Namespace: event.InvolvedObject.Namespace,
+			Pod:       event.InvolvedObject.Name,
+			Node:      event.Source.Host,
+		},
+		Time:  event.EventTime.Time,
+		Text:  event.Message,
+		Event: event,
+	}
+	// the field path of container events is like spec.containers{name}
+	if _, container, found := strings.Cut(event.InvolvedObject.FieldPath, "{"); found {
+		line.Source.Container = strings.TrimSuffix(container, "}")
+	}
+	for _, timestamp := range []metav1.Time{event.LastTimestamp, event.FirstTimestamp, event.CreationTimestamp} {
+		if !line.Time.IsZero() {
+			break
+		}
+		line.Time = timestamp.Time
+	}
+	return line
+}
+
+func (streamer *Streamer) newEventMatcher() *eventMatcher {
+	return &eventMatcher{streamer: streamer, pods: map[string]bool{}, streamed: map[string]bool{}}
+}
+
+// record wraps the given handler to remember the pods whose log lines are streamed
+func (matcher *eventMatcher) record(handle func(line Line)) func(line Line) {
+	return func(line Line) {
+		if line.Event == nil && len(line.Source.Pod) > 0 {
+			matcher.lock.Lock()
+			matcher.streamed[line.Source.Pod] = true
+			matcher.lock.Unlock()
+		}
+		handle(line)
+	}
+}
+
+// matches tells if the event is about the streamed pod or a pod matching the selector
+//
+// The pods whose lines were streamed always match, as they may have been deleted since.
+func (matcher *eventMatcher) matches(ctx context.Context, event *corev1.Event) bool {
+	if event.InvolvedObject.Kind != "Pod" {
+		return false
+	}
+	name := event.InvolvedObject.Name
+	if len(matcher.streamer.Pod) > 0 {
+		return name == matcher.streamer.Pod
+	}
+	matcher.lock.Lock()
+	defer matcher.lock.Unlock()
+	if matcher.streamed[name] {
+		return true
+	}
+	if match, found := matcher.pods[name]; found {
+		return match
+	}
+	pod, err := matcher.streamer.Client.Clientset.CoreV1().Pods(event.InvolvedObject.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false // we will try again with the next event
+	}
+	matcher.pods[name] = err == nil && matcher.streamer.matches(*pod)
+	return matcher.pods[name]
+}
+
+// add holds the given line, an event is inserted before the first held log line that is newer
+func (merger *lineMerger) add(line Line) {
+	merger.lock.Lock()
+	defer merger.lock.Unlock()
+	held := heldLine{line: line, received: time.Now()}
+	if line.Event != nil {
+		for index, other := range merger.held {
+			if other.line.Event == nil && other.line.Banner == NoBanner && other.line.Time.After(line.Time) {
+				held.received = other.received // it must not be held longer than the lines after it
+				merger.held = slices.Insert(merger.held, index, held)
+				return
+			}
+		}
+	}
+	merger.held = append(merger.held, held)
+}
+
+// flush sends the lines held since before the given time, or all of them if the time is zero
+func (merger *lineMerger) flush(before time.Time) {
+	merger.lock.Lock()
+	count := len(merger.held)
+	if !before.IsZero() {
+		count = 0
+		for count < len(merger.held) && merger.held[count].received.Before(before) {
+			count++
+		}
+	}
+	lines := merger.held[:count]
+	merger.held = slices.Clone(merger.held[count:])
+	merger.lock.Unlock()
+
+	for _, held := range lines {
+		merger.handle(held.line)
+	}
+}
+
+// run sends the lines once they were held for eventMergeDelay, until the context is done
+func (merger *lineMerger) run(ctx context.Context) {
+	ticker := time.NewTicker(eventMergeDelay / 8)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			merger.flush(time.Time{})
+			return
+		case now := <-ticker.C:
+			merger.flush(now.Add(-eventMergeDelay))
+		}
+	}
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/gildas/go-flags"
 	"github.com/gildas/go-logger"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+	"github.com/spf13/pflag"
 )
 
 type LogsOptions struct {
@@ -25,8 +25,9 @@ type LogsOptions struct {
 	ClientKey                    string
 	Cluster                      string
 	Container                    string
-	Context                      *flags.EnumFlag
+	Context                      *ListFlag
 	DisableCompression           bool
+	Events                       bool
 	IgnoreErrors                 bool
 	InsecureSkipTLSVerify        bool
 	InsecureSkipTLSVerifyBackend bool
@@ -36,13 +37,14 @@ type LogsOptions struct {
 	LogFlushFrequency            time.Duration
 	MatchServerVersion           bool
 	MaxLogRequests               int
-	Namespace                    *flags.EnumFlag
+	Namespace                    *ListFlag
 	Password                     string
 	PodRunningTimeout            time.Duration
 	Prefix                       bool
 	Previous                     bool
 	Profile                      string
 	ProfileOutput                string
+	Record                       string
 	Release                      *flags.EnumFlag
 	RequestTimeout               time.Duration
 	Selector                     string
@@ -57,6 +59,7 @@ type LogsOptions struct {
 	Username                     string
 	VModule                      string
 	WarningsAsErrors             bool
+	WithPrevious                 bool
 }
 
 var kubectlLogFlags = []string{
@@ -74,6 +77,7 @@ var kubectlLogFlags = []string{
 	"container",
 	"context",
 	"disable-compression",
+	"events",
 	"ignore-errors",
 	"insecure-skip-tls-verify",
 	"insecure-skip-tls-verify-backend",
@@ -90,6 +94,8 @@ var kubectlLogFlags = []string{
 	"previous",
 	"profile",
 	"profile-output",
+	"record",
+	"release",
 	"request-timeout",
 	"selector",
 	"server",
@@ -103,12 +109,14 @@ var kubectlLogFlags = []string{
 	"username",
 	"vmodule",
 	"warnings-as-errors",
+	"with-previous",
 }
 
 // CreateLogsFlags creates the flags for the kubectl logs command
-func CreateLogsFlags(cmd *cobra.Command) (options LogsOptions) {
-	options.Context = flags.NewEnumFlagWithFunc(cmd, "", GetContexts)
-	options.Namespace = flags.NewEnumFlagWithFunc(cmd, "", GetNamespaces)
+func CreateLogsFlags(cmd *cobra.Command) (options *LogsOptions) {
+	options = &LogsOptions{}
+	options.Context = NewListFlag(GetContexts)
+	options.Namespace = NewListFlag(GetNamespaces)
 	options.Release = flags.NewEnumFlagWithFunc(cmd, "", GetReleases)
 
 	cmd.Flags().BoolVar(&options.AllContainers, "all-containers", false, "Get all containers' logs in the pod(s).")
@@ -123,8 +131,9 @@ func CreateLogsFlags(cmd *cobra.Command) (options LogsOptions) {
 	cmd.Flags().StringVar(&options.ClientKey, "client-key", "", "Path to a client key file for TLS")
 	cmd.Flags().StringVar(&options.Cluster, "cluster", "", "The name of the kubeconfig cluster to use")
 	cmd.Flags().StringVarP(&options.Container, "container", "c", "", "Print the logs of this container")
-	cmd.Flags().Var(options.Context, "context", "The name of the kubeconfig context to use")
+	cmd.Flags().Var(options.Context, "context", "The names of the kubeconfig contexts to use, separated by commas or as globs (e.g. 'prod-*')")
 	cmd.Flags().BoolVar(&options.DisableCompression, "disable-compression", false, "If true, opt-out of response compression for all requests to the server")
+	cmd.Flags().BoolVar(&options.Events, "events", false, "Show the Kubernetes events of the pod(s) with their logs, merged by time.")
 	cmd.Flags().BoolVar(&options.IgnoreErrors, "ignore-errors", false, "If watching / following pod logs, allow for any errors that occur to be non-fatal")
 	cmd.Flags().BoolVar(&options.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "If true, the server's certificate will not be checked for validity. This will make your HTTPS connections insecure")
 	cmd.Flags().BoolVar(&options.InsecureSkipTLSVerifyBackend, "insecure-skip-tls-verify-backend", false, "Skip verifying the identity of the kubelet that logs are requested from.  In theory, an attacker could provide invalid log content back. You might want to use this if your kubelet serving certificates have expired.")
@@ -134,13 +143,14 @@ func CreateLogsFlags(cmd *cobra.Command) (options LogsOptions) {
 	cmd.Flags().DurationVar(&options.LogFlushFrequency, "log-flush-frequency", 5*time.Second, "Maximum number of seconds between log flushes")
 	cmd.Flags().BoolVar(&options.MatchServerVersion, "match-server-version", false, "Require server version to match client version")
 	cmd.Flags().IntVar(&options.MaxLogRequests, "max-log-requests", 5, "Maximum number of concurrent logs to follow when using by a selector. Defaults to 5.")
-	cmd.Flags().VarP(options.Namespace, "namespace", "n", "If present, the namespace scope for this CLI request")
+	cmd.Flags().VarP(options.Namespace, "namespace", "n", "If present, the namespaces scope for this CLI request, separated by commas or as globs (e.g. 'team-*')")
 	cmd.Flags().StringVar(&options.Password, "password", "", "Password for basic authentication to the API server.")
-	cmd.Flags().DurationVar(&options.PodRunningTimeout, "pod-running-timeout", 0, "The length of time (like 5s, 2m, or 3h, higher than zero) to wait until at least one pod is running")
+	cmd.Flags().DurationVar(&options.PodRunningTimeout, "pod-running-timeout", 20*time.Second, "The length of time (like 5s, 2m, or 3h, higher than zero) to wait until at least one pod is running")
 	cmd.Flags().BoolVar(&options.Prefix, "prefix", false, "Prefix each log line with the log source (pod name and container name)")
 	cmd.Flags().BoolVarP(&options.Previous, "previous", "p", false, "If true, print the logs for the previous instance of the container in a pod if it exists.")
 	cmd.Flags().StringVar(&options.Profile, "profile", "", "Name of profile to capture. One of (none|cpu|heap|goroutine|threadcreate|block|mutex|trace)")
 	cmd.Flags().StringVar(&options.ProfileOutput, "profile-output", "", "Name of the file to write the profile to")
+	cmd.Flags().StringVar(&options.Record, "record", "", "Record the streamed lines and their metadata into the given bundle directory or tarball (.tar, .tar.gz, .tgz), to replay them later with lv <bundle>")
 	cmd.Flags().DurationVar(&options.RequestTimeout, "request-timeout", 0, "The length of time to wait before giving up on a single server request. Non-zero values should contain a corresponding time unit (e.g. 1s, 2m, 3h). A value of zero means don't timeout requests.")
 	cmd.Flags().StringVarP(&options.Selector, "selector", "l", "", "Selector (label query) to filter on, supports '=', '==', '!=', 'in', 'notin'.(e.g. -l key1=value1,key2=value2,key3 in (value3)). Matching objects must satisfy all of the specified label constraints.")
 	cmd.Flags().StringVarP(&options.Server, "server", "s", "", "The address and port of the Kubernetes API server")
@@ -154,6 +164,7 @@ func CreateLogsFlags(cmd *cobra.Command) (options LogsOptions) {
 	cmd.Flags().StringVar(&options.Username, "username", "", "Username for basic authentication to the API server")
 	cmd.Flags().StringVar(&options.VModule, "vmodule", "", "comma-separated list of pattern=N settings for file-filtered logging (only works for the default text log format)")
 	cmd.Flags().BoolVar(&options.WarningsAsErrors, "warnings-as-errors", false, "Treat warnings received from the server as errors and exit with a non-zero exit code")
+	cmd.Flags().BoolVar(&options.WithPrevious, "with-previous", false, "Print the logs of the previous instance of the container before the current one, with a restart marker.")
 	if IsHelmAvailable() {
 		cmd.Flags().Var(options.Release, "release", "The name of the Helm release to use for logs")
 	}
@@ -164,6 +175,17 @@ func CreateLogsFlags(cmd *cobra.Command) (options LogsOptions) {
 	return
 }
 
+// AddLogsFlags adds the kubectl logs flags and the selector flags of the given command to another command
+//
+// The flags are shared, so the values given to either command and the completion are the same.
+func AddLogsFlags(cmd *cobra.Command, from *cobra.Command) {
+	from.LocalNonPersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		if cmd.Flags().Lookup(flag.Name) == nil {
+			cmd.Flags().AddFlag(flag)
+		}
+	})
+}
+
 // HasLogsFlags checks if any of the kubectl logs flags or extra logs flags are present in the command
 func HasLogsFlags(cmd *cobra.Command) bool {
 	if cmd.Flag("k8s").Changed {
@@ -175,33 +197,14 @@ func HasLogsFlags(cmd *cobra.Command) bool {
 	return kubectlSelectors.HasFlag(cmd)
 }
 
-// BuildLogsParameters builds the parameters for the kubectl logs command based on the flags present in the command
-func BuildLogsParameters(cmd *cobra.Command) (params []string) {
-	params = []string{"logs"}
-	// --follow is common for both kubectl and files, so we need to add it here
-	if viper.GetBool("follow") {
-		params = append(params, "--follow")
-	}
-	for _, flag := range kubectlLogFlags {
-		if cmd.Flags().Changed(flag) {
-			params = append(params, "--"+flag)
-			// If the flag has a value, we need to add it as well
-			if cmd.Flags().Lookup(flag).Value.String() != "" && cmd.Flags().Lookup(flag).Value.Type() != "bool" {
-				params = append(params, cmd.Flags().Lookup(flag).Value.String())
-			}
-		}
-	}
-	if selector := BuildSelectorArgs(cmd); len(selector) > 0 {
-		params = append(params, "--selector", selector)
-	}
-	return
-}
-
 // BuildSelectorArgs builds the Kubernetes selector
 func BuildSelectorArgs(cmd *cobra.Command) string {
 	log := logger.Must(logger.FromContext(cmd.Context()))
 
 	selectors := []string{}
+	if selector := flagString(cmd, "selector"); len(selector) > 0 {
+		selectors = append(selectors, selector)
+	}
 	for _, selector := range kubectlSelectors {
 		if name, found := selector.HasFlag(cmd); found {
 			log.Debugf("Selector %s found with flag %s, adding selector %s", selector.Name, name, selector.GetLabel())
@@ -1,37 +1,34 @@
 package kubectl
 
 import (
-	"bytes"
 	"context"
-	"strings"
 
 	"github.com/gildas/go-logger"
 	"github.com/gildas/lv/cmd/common"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // GetNamespaces gets the namespaces for the current context
 func GetNamespaces(ctx context.Context, cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
 	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "namespaces")
-	var stdout, stderr bytes.Buffer
 
-	kubectlContext, err := GetCurrentContext(ctx, cmd)
+	client, err := NewClient(cmd)
 	if err != nil {
-		log.Errorf("Error getting current context: ", err)
+		log.Errorf("Error creating Kubernetes client: ", err)
 		return nil, err
 	}
 
-	log.Debugf("Getting namespaces for completion with args: %s", args)
-	err = NewKubectl().Exec(ctx, []string{"get", "namespaces", "--context", kubectlContext, "-o", "jsonpath={.items[*].metadata.name}"}, &stdout, &stderr)
+	log.Debugf("Getting namespaces for completion in context %s with args: %s", client.Context, args)
+	list, err := client.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		log.Errorf("Error getting namespaces: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
 
 	namespaces := []string{}
-	for ns := range strings.FieldsSeq(stdout.String()) {
-		namespaces = append(namespaces, ns)
+	for _, namespace := range list.Items {
+		namespaces = append(namespaces, namespace.Name)
 	}
 
 	return common.FilterValidArgs(namespaces, args, toComplete), nil
@@ -41,28 +38,22 @@ func GetNamespaces(ctx context.Context, cmd *cobra.Command, args []string, toCom
 func GetCurrentNamespace(ctx context.Context, cmd *cobra.Command, kubectlContext string) (string, error) {
 	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "current-namespace")
 
-	if cmd.Flags().Changed("namespace") {
-		return cmd.Flags().Lookup("namespace").Value.String(), nil
+	if value := singleFlagValue(cmd, "namespace"); len(value) > 0 {
+		return value, nil
 	}
 
+	rawConfig, err := loadClientConfig(cmd, "", "").RawConfig()
+	if err != nil {
+		log.Errorf("Error getting current namespace: ", err)
+		return "", err
+	}
 	if len(kubectlContext) == 0 {
-		var err error
-
-		kubectlContext, err = GetCurrentContext(ctx, cmd)
-		if err != nil {
-			log.Errorf("Error getting current context: ", err)
-			return "", err
-		}
+		kubectlContext = rawConfig.CurrentContext
 	}
 
-	var stdout, stderr bytes.Buffer
-
 	log.Debugf("Getting current namespace for context %s", kubectlContext)
-	err := NewKubectl().Exec(ctx, []string{"config", "view", "--context", kubectlContext, "--minify", "--output", "jsonpath={..namespace}"}, &stdout, &stderr)
-	if err != nil {
-		log.Errorf("Error getting current namespace: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
-		return "", err
+	if context, found := rawConfig.Contexts[kubectlContext]; found && len(context.Namespace) > 0 {
+		return context.Namespace, nil
 	}
-	return strings.TrimSpace(stdout.String()), nil
+	return metav1.NamespaceDefault, nil
 }
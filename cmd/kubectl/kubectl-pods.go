@@ -1,19 +1,21 @@
 package kubectl
 
 import (
-	"bytes"
 	"context"
 	"slices"
 	"strings"
 
 	"github.com/gildas/go-core"
+	"github.com/gildas/go-errors"
 	"github.com/gildas/go-flags"
 	"github.com/gildas/go-logger"
 	"github.com/gildas/lv/cmd/common"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var resourceTypes = map[string]flags.AllowedFunc{
+	"cronjobs":               GetResourceNamesFunc("cronjobs.batch"),
 	"daemonsets":             GetResourceNamesFunc("daemonsets.apps"),
 	"deployments":            GetResourceNamesFunc("deployments.apps"),
 	"jobs":                   GetResourceNamesFunc("jobs.batch"),
@@ -24,26 +26,58 @@ var resourceTypes = map[string]flags.AllowedFunc{
 	"statefulsets":           GetResourceNamesFunc("statefulsets.apps"),
 }
 
+// resourceAliases contains the singular and short names of the resourceTypes, like kubectl
+var resourceAliases = map[string]string{
+	"cj":                    "cronjobs",
+	"cronjob":               "cronjobs",
+	"daemonset":             "daemonsets",
+	"deploy":                "deployments",
+	"deployment":            "deployments",
+	"ds":                    "daemonsets",
+	"job":                   "jobs",
+	"po":                    "pods",
+	"pod":                   "pods",
+	"rc":                    "replicationcontrollers",
+	"replicaset":            "replicasets",
+	"replicationcontroller": "replicationcontrollers",
+	"rs":                    "replicasets",
+	"service":               "services",
+	"statefulset":           "statefulsets",
+	"sts":                   "statefulsets",
+	"svc":                   "services",
+}
+
+// ParseResource parses a resource given as "type/name" or "name" (a pod)
+//
+// The type can be any of the resourceTypes or their aliases (e.g. "deploy/api", "sts/db", "job/migrate"), it is returned as one of the resourceTypes
+func ParseResource(resource string) (resourceType, name string, err error) {
+	resourceType, name, found := strings.Cut(resource, "/")
+	if !found {
+		return "pods", resource, nil
+	}
+	if alias, found := resourceAliases[resourceType]; found {
+		resourceType = alias
+	}
+	if _, found := resourceTypes[resourceType]; !found {
+		return "", "", errors.Unsupported.With("resource type", resourceType)
+	}
+	if len(name) == 0 {
+		return "", "", errors.ArgumentMissing.With("name")
+	}
+	return resourceType, name, nil
+}
+
 // GetPods gets the pods for the current context
 func GetPods(ctx context.Context, cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
 	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "pods")
-	var stdout, stderr bytes.Buffer
 
-	kubectlContext, err := GetCurrentContext(ctx, cmd)
+	client, err := NewClient(cmd)
 	if err != nil {
-		log.Errorf("Error getting current context: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
+		log.Errorf("Error creating Kubernetes client: ", err)
 		return nil, err
 	}
 
-	kubectlNamespace, err := GetCurrentNamespace(ctx, cmd, kubectlContext)
-	if err != nil {
-		log.Errorf("Error getting current namespace: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
-		return nil, err
-	}
-
-	log.Debugf("Getting pods for completion in namespace %s with context %s, args: %s, toComplete: %s", kubectlNamespace, kubectlContext, args, toComplete)
+	log.Debugf("Getting pods for completion in namespace %s with context %s, args: %s, toComplete: %s", client.Namespace, client.Context, args, toComplete)
 	if len(toComplete) > 0 {
 		log.Debugf("Filtering resource types for toComplete: %s", toComplete)
 		resources := []string{}
@@ -53,16 +87,21 @@ func GetPods(ctx context.Context, cmd *cobra.Command, args []string, toComplete
 		if len(components) > 1 {
 			resourceToComplete = components[1]
 		}
-		for resourceType, getter := range resourceTypes {
-			if resourceType == resourceTypeToComplete {
+		if len(components) > 1 {
+			resourceType := resourceTypeToComplete
+			if alias, found := resourceAliases[resourceType]; found {
+				resourceType = alias
+			}
+			if getter, found := resourceTypes[resourceType]; found {
 				log.Debugf("Adding resource type %s to completion", resourceType)
 				collected, err := getter(ctx, cmd, args, resourceToComplete)
 				if err != nil {
 					log.Errorf("Error getting resources for type %s: %v", resourceType, err)
-					continue
+					return nil, err
 				}
 				log.Debugf("Collected resources for type %s: %s", resourceType, collected)
-				resources = append(resources, core.Map(collected, func(resource string) string { return resourceType + "/" + resource })...)
+				// the type is completed as typed, so the shell keeps the candidates
+				resources = append(resources, core.Map(collected, func(resource string) string { return resourceTypeToComplete + "/" + resource })...)
 				return common.FilterValidArgs(resources, args, toComplete), nil
 			}
 		}
@@ -70,22 +109,17 @@ func GetPods(ctx context.Context, cmd *cobra.Command, args []string, toComplete
 			return common.FilterValidArgs(resources, args, toComplete), nil
 		}
 	}
-	params := []string{"get", "pods", "--context", kubectlContext, "--namespace", kubectlNamespace}
-	if selector := BuildSelectorArgs(cmd); len(selector) > 0 {
-		params = append(params, "--selector", selector)
-	}
-	params = append(params, "-o", "jsonpath={.items[*].metadata.name}")
-	err = NewKubectl().Exec(ctx, params, &stdout, &stderr)
+	listOptions := metav1.ListOptions{LabelSelector: BuildSelectorArgs(cmd)}
+	items, err := listObjectMeta(ctx, client.Clientset, "pods", client.Namespace, listOptions)
 	if err != nil {
 		log.Errorf("Error getting pods: ", err)
-		log.Errorf("Stderr: %s", stderr.String())
 		return nil, err
 	}
 
 	pods := []string{}
-	for pod := range strings.FieldsSeq(stdout.String()) {
-		if !slices.Contains(pods, pod) {
-			pods = append(pods, pod)
+	for _, item := range items {
+		if !slices.Contains(pods, item.Name) {
+			pods = append(pods, item.Name)
 		}
 	}
 
@@ -102,6 +136,12 @@ func GetPods(ctx context.Context, cmd *cobra.Command, args []string, toComplete
 				pods = append(pods, resourceType+"/")
 			}
 		}
+		for alias := range resourceAliases {
+			if strings.HasPrefix(alias, toComplete) {
+				log.Debugf("Adding resource alias %s to completion", alias)
+				pods = append(pods, alias+"/")
+			}
+		}
 	}
 
 	return common.FilterValidArgs(pods, args, toComplete), nil
@@ -1,15 +1,19 @@
 package kubectl
 
 import (
-	"bytes"
 	"context"
+	"fmt"
 	"slices"
 	"strings"
 
+	"github.com/gildas/go-errors"
 	"github.com/gildas/go-flags"
 	"github.com/gildas/go-logger"
 	"github.com/gildas/lv/cmd/common"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
 )
 
 // GetResourceNamesFunc gets the kubernetes resources for the current context
@@ -19,39 +23,29 @@ func GetResourceNamesFunc(resourceType string) flags.AllowedFunc {
 
 // GetResourceLabelsFunc gets the kubernetes resources for the current context with a specific label selector
 func GetResourceLabelsFunc(resourceType string, labelSelector string) flags.AllowedFunc {
-	if labelSelector != "name" {
-		labelSelector = "labels." + strings.ReplaceAll(labelSelector, ".", "\\.")
-	}
 	return func(ctx context.Context, cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
 		log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "resources", "resourceType", resourceType, "labelSelector", labelSelector)
-		var stdout, stderr bytes.Buffer
-
-		kubectlContext, err := GetCurrentContext(ctx, cmd)
-		if err != nil {
-			log.Errorf("Error getting current context: ", err)
-			log.Errorf("Stderr: %s", stderr.String())
-			return nil, err
-		}
 
-		kubectlNamespace, err := GetCurrentNamespace(ctx, cmd, kubectlContext)
+		client, err := NewClient(cmd)
 		if err != nil {
-			log.Errorf("Error getting current namespace: ", err)
-			log.Errorf("Stderr: %s", stderr.String())
+			log.Errorf("Error creating Kubernetes client: ", err)
 			return nil, err
 		}
 
-		log.Debugf("Getting %s for completion in namespace %s with context %s, label selector %s and args: %s", resourceType, kubectlNamespace, kubectlContext, labelSelector, args)
-		err = NewKubectl().Exec(ctx, []string{"get", resourceType, "--context", kubectlContext, "--namespace", kubectlNamespace, "-o", "jsonpath={.items[*].metadata." + labelSelector + "}"}, &stdout, &stderr)
+		log.Debugf("Getting %s for completion in namespace %s with context %s, label selector %s and args: %s", resourceType, client.Namespace, client.Context, labelSelector, args)
+		items, err := listObjectMeta(ctx, client.Clientset, resourceType, client.Namespace, metav1.ListOptions{})
 		if err != nil {
 			log.Errorf("Error getting %s: ", resourceType, err)
-			log.Errorf("Stderr: %s", stderr.String())
 			return nil, err
 		}
-		log.Debugf("Raw resources output: %s", stdout.String())
 
 		resources := []string{}
-		for resource := range strings.FieldsSeq(stdout.String()) {
-			if !slices.Contains(resources, resource) {
+		for _, item := range items {
+			resource := item.Name
+			if labelSelector != "name" {
+				resource = item.Labels[labelSelector]
+			}
+			if len(resource) > 0 && !slices.Contains(resources, resource) {
 				resources = append(resources, resource)
 			}
 		}
@@ -59,3 +53,180 @@ func GetResourceLabelsFunc(resourceType string, labelSelector string) flags.Allo
 		return common.FilterValidArgs(resources, args, toComplete), nil
 	}
 }
+
+// listObjectMeta lists the metadata of the resources of the given type in the given namespace
+func listObjectMeta(ctx context.Context, clientset kubernetes.Interface, resourceType, namespace string, options metav1.ListOptions) (items []metav1.ObjectMeta, err error) {
+	switch resourceType {
+	case "cronjobs.batch":
+		list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "daemonsets.apps":
+		list, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "deployments.apps":
+		list, err := clientset.AppsV1().Deployments(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "jobs.batch":
+		list, err := clientset.BatchV1().Jobs(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "pods":
+		list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "replicasets.apps":
+		list, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "replicationcontrollers":
+		list, err := clientset.CoreV1().ReplicationControllers(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "services":
+		list, err := clientset.CoreV1().Services(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	case "statefulsets.apps":
+		list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			items = append(items, item.ObjectMeta)
+		}
+	default:
+		return nil, errors.ArgumentInvalid.With("resourceType", resourceType)
+	}
+	return items, nil
+}
+
+// GetWorkloadSelector gets the label selector of the pods managed by the given workload
+//
+// resourceType is one of the resourceTypes (e.g. "deployments").
+// The pods of a cronjob are selected by the jobs it owns, as the labels of its job template are usually empty.
+func GetWorkloadSelector(ctx context.Context, clientset kubernetes.Interface, namespace, resourceType, name string) (string, error) {
+	var selector *metav1.LabelSelector
+	var labelSet map[string]string
+
+	switch resourceType {
+	case "cronjobs":
+		return cronJobSelector(ctx, clientset, namespace, name)
+	case "daemonsets":
+		item, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = item.Spec.Selector
+	case "deployments":
+		item, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = item.Spec.Selector
+	case "jobs":
+		item, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = item.Spec.Selector
+	case "replicasets":
+		item, err := clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = item.Spec.Selector
+	case "replicationcontrollers":
+		item, err := clientset.CoreV1().ReplicationControllers(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSet = item.Spec.Selector
+	case "services":
+		item, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		labelSet = item.Spec.Selector
+	case "statefulsets":
+		item, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = item.Spec.Selector
+	default:
+		return "", errors.Unsupported.With("resource type", resourceType)
+	}
+	if selector != nil {
+		parsed, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return "", err
+		}
+		if !parsed.Empty() {
+			return parsed.String(), nil
+		}
+	}
+	if len(labelSet) == 0 {
+		return "", errors.NotFound.With("pod selector", resourceType+"/"+name)
+	}
+	return labels.SelectorFromSet(labelSet).String(), nil
+}
+
+// cronJobSelector gets the label selector of the pods of the jobs owned by the given cronjob
+//
+// The jobs are found with their ownerReferences, their pods have the controller-uid label with the UID of their job
+func cronJobSelector(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (string, error) {
+	cronjob, err := clientset.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	jobs, err := clientset.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	uids := []string{}
+	for _, job := range jobs.Items {
+		if slices.ContainsFunc(job.OwnerReferences, func(owner metav1.OwnerReference) bool { return owner.UID == cronjob.UID }) {
+			uids = append(uids, string(job.UID))
+		}
+	}
+	if len(uids) == 0 {
+		return "", errors.NotFound.With("jobs of cronjob", name)
+	}
+	slices.Sort(uids)
+	return fmt.Sprintf("controller-uid in (%s)", strings.Join(uids, ",")), nil
+}
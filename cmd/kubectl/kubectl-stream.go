@@ -0,0 +1,500 @@
+package kubectl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Source describes the container a log line comes from
+type Source struct {
+	Context   string            `json:"context"`
+	Namespace string            `json:"namespace"`
+	Pod       string            `json:"pod,omitempty"`
+	Container string            `json:"container,omitempty"`
+	Node      string            `json:"node,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Line is a log line read from a container, or a banner when a container is attached or detached
+type Line struct {
+	Source Source        `json:"source"`
+	Time   time.Time     `json:"time"`
+	Text   string        `json:"text,omitempty"`
+	Banner Banner        `json:"banner,omitempty"`
+	Event  *corev1.Event `json:"event,omitempty"` // The Kubernetes event if the line is an event
+}
+
+// Banner tells if a Line is a banner and which one
+type Banner int
+
+const (
+	// NoBanner is used for log lines
+	NoBanner Banner = iota
+	// AttachedBanner is used when a container starts being streamed
+	AttachedBanner
+	// DetachedBanner is used when a container stops being streamed
+	DetachedBanner
+	// SkippedBanner is used when a container cannot be streamed because of --max-log-requests
+	SkippedBanner
+	// FailedBanner is used when a context or a namespace cannot be streamed
+	FailedBanner
+	// RestartedBanner is used between the logs of the previous and the current instances of a container
+	RestartedBanner
+)
+
+// Streamer streams the logs of containers from Kubernetes
+type Streamer struct {
+	Client            *Client
+	Pod               string // The pod to stream, if empty the pods are selected with Selector and PodSelectors
+	Release           string // The Helm release the PodSelectors come from
+	Selector          string
+	PodSelectors      []string // If set, the pods must match one of these selectors too (e.g. the workloads of a Helm release)
+	Container         string
+	AllContainers     bool
+	Prefix            bool
+	Follow            bool
+	IgnoreErrors      bool
+	MaxLogRequests    int
+	PodRunningTimeout time.Duration
+	Events            bool // Streams the events of the pods too
+	WithPrevious      bool // Streams the logs of the previous instance of the containers before the current ones
+	LogOptions        corev1.PodLogOptions
+	cronJobs          map[string]string // the selectors of the pods of the cronjobs by name, updated with the jobs they create when following
+	lock              sync.Mutex
+	selectorLock      sync.RWMutex // protects the selectors, as they are updated when following cronjobs
+}
+
+// DefaultContainerAnnotation is the annotation kubectl uses to find the default container of a pod
+const DefaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// NewStreamers creates a Streamer for each context and namespace given by --context and --namespace (see GetTargets)
+//
+// If some contexts or namespaces fail, their errors are returned with the streamers of the other ones
+func NewStreamers(cmd *cobra.Command, options *LogsOptions, args []string) (streamers []*Streamer, err error) {
+	var merr errors.MultiError
+
+	targets, err := GetTargets(cmd.Context(), cmd, options)
+	if targetErrors, ok := err.(*errors.MultiError); ok {
+		merr.Append(targetErrors.Errors...)
+	} else if err != nil {
+		merr.Append(err)
+	}
+	for _, target := range targets {
+		streamer, err := NewStreamer(cmd, options, args, target)
+		if err != nil {
+			merr.Append(errors.Join(errors.Errorf("%s", target), err))
+			continue
+		}
+		streamers = append(streamers, streamer)
+	}
+	return streamers, merr.AsError()
+}
+
+// NewStreamer creates a new Streamer for the given target from the kubectl flags of the given command and its arguments
+func NewStreamer(cmd *cobra.Command, options *LogsOptions, args []string, target Target) (*Streamer, error) {
+	client, err := NewClientFor(cmd, target.Context, target.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	streamer := &Streamer{
+		Client:            client,
+		Selector:          BuildSelectorArgs(cmd),
+		Container:         options.Container,
+		AllContainers:     options.AllContainers,
+		Prefix:            options.Prefix || options.AllPods,
+		Follow:            viper.GetBool("follow"),
+		IgnoreErrors:      options.IgnoreErrors,
+		MaxLogRequests:    options.MaxLogRequests,
+		PodRunningTimeout: options.PodRunningTimeout,
+		Events:            options.Events,
+		WithPrevious:      options.WithPrevious && !options.Previous,
+		LogOptions: corev1.PodLogOptions{
+			Previous:                     options.Previous,
+			Timestamps:                   options.Timestamps,
+			InsecureSkipTLSVerifyBackend: options.InsecureSkipTLSVerifyBackend,
+		},
+	}
+	streamer.LogOptions.Follow = streamer.Follow
+	if len(args) > 0 {
+		resourceType, name, err := ParseResource(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if resourceType == "pods" {
+			streamer.Pod = name
+		} else {
+			// all the pods and containers of a workload are streamed with its selector
+			selector, err := GetWorkloadSelector(cmd.Context(), client.Clientset, client.Namespace, resourceType, name)
+			if err != nil {
+				return nil, err
+			}
+			if resourceType == "cronjobs" {
+				streamer.cronJobs = map[string]string{name: selector}
+			}
+			if len(streamer.Selector) > 0 {
+				selector = streamer.Selector + "," + selector
+			}
+			streamer.Selector = selector
+			streamer.AllContainers = len(streamer.Container) == 0
+			streamer.Prefix = true
+		}
+	}
+	if release := options.Release.Value; len(release) > 0 {
+		streamer.Release = release
+		if err = CheckReleaseSelectors(cmd, client.Context, client.Namespace, release); err != nil {
+			return nil, err
+		}
+		var cronJobs map[string]string
+		if streamer.PodSelectors, cronJobs, err = releaseSelectors(cmd.Context(), client.Clientset, client.Context, client.Namespace, release); err != nil {
+			return nil, err
+		}
+		if len(cronJobs) > 0 {
+			if streamer.cronJobs == nil {
+				streamer.cronJobs = map[string]string{}
+			}
+			maps.Copy(streamer.cronJobs, cronJobs)
+		}
+	}
+	if options.Since > 0 {
+		seconds := int64(options.Since.Seconds())
+		streamer.LogOptions.SinceSeconds = &seconds
+	} else if !options.SinceTime.IsZero() {
+		streamer.LogOptions.SinceTime = &metav1.Time{Time: options.SinceTime}
+	}
+	if options.LimitBytes > 0 {
+		streamer.LogOptions.LimitBytes = &options.LimitBytes
+	}
+	// Like kubectl, the default tail is 10 lines with a selector, all lines for a pod or a workload
+	if options.Tail >= 0 {
+		streamer.LogOptions.TailLines = &options.Tail
+	} else if !cmd.Flags().Changed("tail") && len(args) == 0 {
+		tail := int64(10)
+		streamer.LogOptions.TailLines = &tail
+	}
+	return streamer, nil
+}
+
+// Stream streams the log lines of the selected containers, and their events if Events is set, to the given handler
+//
+// When following, the containers are streamed concurrently, otherwise one after the other.
+// When following pods with a selector, new pods and containers are attached as they start (see watch).
+// The events are merged by time with the log lines, when following the lines are held for a moment to merge the events that come late.
+// The calls to handle are serialized.
+func (streamer *Streamer) Stream(ctx context.Context, handle func(line Line)) error {
+	if !streamer.Events {
+		return streamer.streamLogs(ctx, handle)
+	}
+	if !streamer.Follow {
+		return streamer.streamSorted(ctx, handle)
+	}
+	return streamer.streamMerged(ctx, handle)
+}
+
+// streamLogs streams the log lines of the selected containers to the given handler
+func (streamer *Streamer) streamLogs(ctx context.Context, handle func(line Line)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "stream")
+
+	if streamer.Follow && len(streamer.Pod) == 0 {
+		return streamer.watch(ctx, handle)
+	}
+
+	sources, err := streamer.Sources(ctx)
+	if err != nil {
+		return err
+	}
+	if streamer.Follow && streamer.MaxLogRequests > 0 && len(sources) > streamer.MaxLogRequests {
+		return errors.Errorf("you are attempting to follow %d log streams, but maximum allowed concurrency is %d, use --max-log-requests to increase the limit", len(sources), streamer.MaxLogRequests)
+	}
+
+	if !streamer.Follow {
+		for _, source := range sources {
+			if err := streamer.streamInstances(ctx, source, streamer.LogOptions, handle); err != nil {
+				if !streamer.IgnoreErrors {
+					return err
+				}
+				log.Errorf("Failed to stream logs from pod %s, container %s", source.Pod, source.Container, err)
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var waiter sync.WaitGroup
+	var merr errors.MultiError
+	var merrLock sync.Mutex
+	for _, source := range sources {
+		waiter.Add(1)
+		go func(source Source) {
+			defer waiter.Done()
+			if err := streamer.streamInstances(ctx, source, streamer.LogOptions, handle); err != nil && ctx.Err() == nil {
+				log.Errorf("Failed to stream logs from pod %s, container %s", source.Pod, source.Container, err)
+				if !streamer.IgnoreErrors {
+					merrLock.Lock()
+					merr.Append(err)
+					merrLock.Unlock()
+					cancel()
+				}
+			}
+		}(source)
+	}
+	waiter.Wait()
+	return merr.AsError()
+}
+
+// Sources gets the containers to stream
+func (streamer *Streamer) Sources(ctx context.Context) (sources []Source, err error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "sources")
+	pods := streamer.Client.Clientset.CoreV1().Pods(streamer.Client.Namespace)
+
+	var items []corev1.Pod
+	if len(streamer.Pod) > 0 {
+		pod, err := streamer.waitForPod(ctx, streamer.Pod)
+		if err != nil {
+			return nil, err
+		}
+		items = []corev1.Pod{*pod}
+	} else if streamer.hasSelector() {
+		log.Debugf("Getting pods in namespace %s with selector %s", streamer.Client.Namespace, streamer.listSelector())
+		list, err := pods.List(ctx, metav1.ListOptions{LabelSelector: streamer.listSelector()})
+		if err != nil {
+			return nil, err
+		}
+		items = slices.DeleteFunc(list.Items, func(pod corev1.Pod) bool { return !streamer.matches(pod) })
+	} else {
+		return nil, errors.ArgumentMissing.With("pod or selector")
+	}
+
+	for _, pod := range items {
+		podSources, err := streamer.podSources(pod)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, podSources...)
+	}
+	log.Debugf("Found %d containers to stream", len(sources))
+	return sources, nil
+}
+
+// hasSelector tells if the pods are selected with labels
+func (streamer *Streamer) hasSelector() bool {
+	streamer.selectorLock.RLock()
+	defer streamer.selectorLock.RUnlock()
+	return len(streamer.Selector) > 0 || len(streamer.PodSelectors) > 0
+}
+
+// listSelector gets the label selector used to list the pods
+//
+// With more than one PodSelectors, the listed pods must be filtered with matches
+func (streamer *Streamer) listSelector() string {
+	streamer.selectorLock.RLock()
+	defer streamer.selectorLock.RUnlock()
+	if len(streamer.PodSelectors) == 1 && len(streamer.Selector) > 0 {
+		return streamer.Selector + "," + streamer.PodSelectors[0]
+	} else if len(streamer.PodSelectors) == 1 {
+		return streamer.PodSelectors[0]
+	}
+	return streamer.Selector
+}
+
+// matches tells if the given pod matches the Selector and one of the PodSelectors
+func (streamer *Streamer) matches(pod corev1.Pod) bool {
+	streamer.selectorLock.RLock()
+	defer streamer.selectorLock.RUnlock()
+	set := labels.Set(pod.Labels)
+	if selector, err := labels.Parse(streamer.Selector); err != nil || !selector.Matches(set) {
+		return false
+	}
+	if len(streamer.PodSelectors) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(streamer.PodSelectors, func(value string) bool {
+		selector, err := labels.Parse(value)
+		return err == nil && selector.Matches(set)
+	})
+}
+
+// updateCronJob updates the selectors with the jobs the given cronjob owns now, it tells if they changed
+func (streamer *Streamer) updateCronJob(ctx context.Context, name string) (bool, error) {
+	selector, err := cronJobSelector(ctx, streamer.Client.Clientset, streamer.Client.Namespace, name)
+	if err != nil {
+		return false, err
+	}
+	streamer.selectorLock.Lock()
+	defer streamer.selectorLock.Unlock()
+	previous := streamer.cronJobs[name]
+	if selector == previous {
+		return false, nil
+	}
+	streamer.Selector = strings.Replace(streamer.Selector, previous, selector, 1)
+	for index, podSelector := range streamer.PodSelectors {
+		if podSelector == previous {
+			streamer.PodSelectors[index] = selector
+		}
+	}
+	streamer.cronJobs[name] = selector
+	return true, nil
+}
+
+// podSources gets the containers to stream in the given pod
+func (streamer *Streamer) podSources(pod corev1.Pod) (sources []Source, err error) {
+	containers, err := streamer.containers(pod)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		sources = append(sources, Source{
+			Context:   streamer.Client.Context,
+			Namespace: pod.Namespace,
+			Pod:       pod.Name,
+			Container: container,
+			Node:      pod.Spec.NodeName,
+			Labels:    pod.Labels,
+		})
+	}
+	return sources, nil
+}
+
+// containers gets the names of the containers to stream in the given pod
+func (streamer *Streamer) containers(pod corev1.Pod) ([]string, error) {
+	if streamer.AllContainers {
+		containers := []string{}
+		for _, container := range pod.Spec.InitContainers {
+			containers = append(containers, container.Name)
+		}
+		for _, container := range pod.Spec.Containers {
+			containers = append(containers, container.Name)
+		}
+		return containers, nil
+	}
+	if len(streamer.Container) > 0 {
+		for _, container := range slices.Concat(pod.Spec.InitContainers, pod.Spec.Containers) {
+			if container.Name == streamer.Container {
+				return []string{container.Name}, nil
+			}
+		}
+		return nil, errors.NotFound.With("container", streamer.Container)
+	}
+	if name, found := pod.Annotations[DefaultContainerAnnotation]; found {
+		return []string{name}, nil
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return nil, errors.NotFound.With("container", pod.Name)
+	}
+	return []string{pod.Spec.Containers[0].Name}, nil
+}
+
+// waitForPod gets the given pod and waits for it to run if it is pending, up to PodRunningTimeout
+func (streamer *Streamer) waitForPod(ctx context.Context, name string) (*corev1.Pod, error) {
+	pods := streamer.Client.Clientset.CoreV1().Pods(streamer.Client.Namespace)
+	deadline := time.Now().Add(streamer.PodRunningTimeout)
+
+	for {
+		pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if pod.Status.Phase != corev1.PodPending || time.Now().After(deadline) {
+			return pod, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// streamInstances streams the log lines of the given container, preceded by the ones of its previous instance if WithPrevious is set
+//
+// A RestartedBanner with the reason and the exit code of the previous instance is sent between them.
+func (streamer *Streamer) streamInstances(ctx context.Context, source Source, options corev1.PodLogOptions, handle func(line Line)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "stream", "pod", source.Pod, "container", source.Container)
+
+	if !streamer.WithPrevious {
+		return streamer.streamContainer(ctx, source, options, handle)
+	}
+	pod, err := streamer.Client.Clientset.CoreV1().Pods(source.Namespace).Get(ctx, source.Pod, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if status := containerStatus(*pod, source.Container); status != nil && status.LastTerminationState.Terminated != nil {
+		terminated := status.LastTerminationState.Terminated
+		previous := options
+		previous.Previous = true
+		previous.Follow = false
+		if err := streamer.streamContainer(ctx, source, previous, handle); err != nil {
+			log.Warnf("Failed to stream logs from the previous instance of pod %s, container %s: %s", source.Pod, source.Container, err)
+		}
+		banner := Line{Source: source, Time: terminated.FinishedAt.Time, Banner: RestartedBanner, Text: fmt.Sprintf("%s, exit code %d", terminated.Reason, terminated.ExitCode)}
+		if banner.Time.IsZero() {
+			banner.Time = time.Now()
+		}
+		streamer.emit(handle, banner)
+	} else {
+		log.Debugf("Container %s of pod %s has no previous instance", source.Container, source.Pod)
+	}
+	return streamer.streamContainer(ctx, source, options, handle)
+}
+
+// streamContainer streams the log lines of the given container to the given handler
+func (streamer *Streamer) streamContainer(ctx context.Context, source Source, options corev1.PodLogOptions, handle func(line Line)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "stream", "pod", source.Pod, "container", source.Container)
+
+	options.Container = source.Container
+	options.Timestamps = true // we need the timestamps to order the lines, they are removed if not requested
+
+	log.Infof("Streaming logs from pod %s, container %s", source.Pod, source.Container)
+	stream, err := streamer.Client.Clientset.CoreV1().Pods(source.Namespace).GetLogs(source.Pod, &options).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }()
+
+	reader := bufio.NewReader(stream)
+	for {
+		text, err := reader.ReadString('\n')
+		if len(text) > 0 {
+			line := Line{Source: source, Text: strings.TrimRight(text, "\r\n")}
+			if timestamp, rest, found := strings.Cut(line.Text, " "); found {
+				if parsed, perr := time.Parse(time.RFC3339Nano, timestamp); perr == nil {
+					line.Time = parsed
+					if !streamer.LogOptions.Timestamps {
+						line.Text = rest
+					}
+				}
+			}
+			streamer.emit(handle, line)
+		}
+		if errors.Is(err, io.EOF) {
+			log.Infof("End of logs from pod %s, container %s", source.Pod, source.Container)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// emit calls the handler with the given line, calls are serialized
+func (streamer *Streamer) emit(handle func(line Line), line Line) {
+	streamer.lock.Lock()
+	defer streamer.lock.Unlock()
+	handle(line)
+}
@@ -0,0 +1,545 @@
+package kubectl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/suite"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type StreamSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestStreamSuite(t *testing.T) {
+	suite.Run(t, new(StreamSuite))
+}
+
+func (suite *StreamSuite) SetupSuite() {
+	suite.Name = "Stream"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// pod creates a running pod with the given labels and containers
+func pod(name string, labels map[string]string, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: labels},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+	}
+	return pod
+}
+
+func (suite *StreamSuite) streamer(objects ...runtime.Object) *Streamer {
+	return &Streamer{Client: &Client{Clientset: fake.NewClientset(objects...), Context: "test", Namespace: "shop"}}
+}
+
+func (suite *StreamSuite) TestCanSelectPodsWithSelector() {
+	streamer := suite.streamer(
+		pod("api-1", map[string]string{"app": "api"}, "main"),
+		pod("api-2", map[string]string{"app": "api"}, "main"),
+		pod("web-1", map[string]string{"app": "web"}, "main"),
+	)
+	streamer.Selector = "app=api"
+	sources, err := streamer.Sources(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(sources, 2)
+	suite.Assert().ElementsMatch([]string{"api-1", "api-2"}, []string{sources[0].Pod, sources[1].Pod})
+	for _, source := range sources {
+		suite.Assert().Equal("test", source.Context)
+		suite.Assert().Equal("shop", source.Namespace)
+		suite.Assert().Equal("main", source.Container)
+		suite.Assert().Equal("api", source.Labels["app"])
+	}
+}
+
+func (suite *StreamSuite) TestCanSelectPodsWithPodSelectors() {
+	streamer := suite.streamer(
+		pod("api-1", map[string]string{"app": "api", "tier": "backend"}, "main"),
+		pod("web-1", map[string]string{"app": "web", "tier": "frontend"}, "main"),
+		pod("db-1", map[string]string{"app": "db", "tier": "backend"}, "main"),
+	)
+	streamer.PodSelectors = []string{"app=api", "app=web"}
+	sources, err := streamer.Sources(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Assert().Len(sources, 2)
+
+	streamer.Selector = "tier=backend"
+	sources, err = streamer.Sources(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(sources, 1)
+	suite.Assert().Equal("api-1", sources[0].Pod)
+}
+
+func (suite *StreamSuite) TestShouldFailWithoutPodOrSelector() {
+	_, err := suite.streamer().Sources(suite.ctx)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentMissing)
+}
+
+func (suite *StreamSuite) TestCanSelectContainers() {
+	api := pod("api-1", map[string]string{"app": "api"}, "main", "sidecar")
+	api.Spec.InitContainers = []corev1.Container{{Name: "migrate"}}
+	streamer := suite.streamer(api)
+	streamer.Pod = "api-1"
+
+	sources, err := streamer.Sources(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Len(sources, 1)
+	suite.Assert().Equal("main", sources[0].Container, "The first container should be the default one")
+
+	api.Annotations = map[string]string{DefaultContainerAnnotation: "sidecar"}
+	containers, err := streamer.containers(*api)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"sidecar"}, containers, "The annotation should give the default container")
+
+	streamer.Container = "migrate"
+	containers, err = streamer.containers(*api)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"migrate"}, containers, "Init containers can be selected")
+
+	streamer.Container = "unknown"
+	_, err = streamer.containers(*api)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.NotFound)
+
+	streamer.Container = ""
+	streamer.AllContainers = true
+	containers, err = streamer.containers(*api)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"migrate", "main", "sidecar"}, containers)
+}
+
+func (suite *StreamSuite) TestShouldWaitForPendingPod() {
+	api := pod("api-1", nil, "main")
+	api.Status.Phase = corev1.PodPending
+	clientset := fake.NewClientset(api)
+	var gets atomic.Int32
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if gets.Add(1) < 2 {
+			return false, nil, nil
+		}
+		running := api.DeepCopy()
+		running.Status.Phase = corev1.PodRunning
+		return true, running, nil
+	})
+	streamer := &Streamer{Client: &Client{Clientset: clientset, Context: "test", Namespace: "shop"}, PodRunningTimeout: 20 * time.Second}
+
+	found, err := streamer.waitForPod(suite.ctx, "api-1")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(corev1.PodRunning, found.Status.Phase)
+	suite.Assert().Equal(int32(2), gets.Load())
+
+	streamer = &Streamer{Client: &Client{Clientset: fake.NewClientset(api), Context: "test", Namespace: "shop"}}
+	found, err = streamer.waitForPod(suite.ctx, "api-1")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(corev1.PodPending, found.Status.Phase, "Without timeout, the pending pod should be returned at once")
+}
+
+func (suite *StreamSuite) TestCanStreamPodLogs() {
+	streamer := suite.streamer(pod("api-1", map[string]string{"app": "api"}, "main"))
+	streamer.Pod = "api-1"
+
+	lines := []Line{}
+	err := streamer.Stream(suite.ctx, func(line Line) { lines = append(lines, line) })
+	suite.Require().NoError(err)
+	suite.Require().Len(lines, 1)
+	suite.Assert().Equal("fake logs", lines[0].Text) // the body of the logs of the fake clientset
+	suite.Assert().Equal("api-1", lines[0].Source.Pod)
+	suite.Assert().Equal("main", lines[0].Source.Container)
+}
+
+// kubeconfig writes a kubeconfig with the contexts dev and prod, and returns its path
+func (suite *StreamSuite) kubeconfig() string {
+	kubeconfig := filepath.Join(suite.T().TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster: {server: "https://dev.example.com:6443"}
+- name: prod
+  cluster: {server: "https://prod.example.com:6443"}
+users:
+- name: dev
+  user: {token: dev-token}
+- name: prod
+  user: {token: prod-token}
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev, namespace: default}
+- name: prod
+  context: {cluster: prod, user: prod, namespace: prod}
+`), 0600)
+	suite.Require().NoError(err)
+	return kubeconfig
+}
+
+func (suite *StreamSuite) TestCanOverrideKubeconfigWithFlags() {
+	kubeconfig := suite.kubeconfig()
+
+	cmd := &cobra.Command{Use: "test"}
+	options := CreateLogsFlags(cmd)
+	suite.Assert().Equal(20*time.Second, options.PodRunningTimeout, "The default timeout should be kubectl's")
+	err := cmd.ParseFlags([]string{
+		"--kubeconfig", kubeconfig,
+		"--context", "prod",
+		"--namespace", "shop",
+		"--server", "https://override.example.com:6443",
+		"--token", "override-token",
+		"--as", "alice",
+		"--as-group", "ops",
+		"--as-user-extra", "scope=read",
+		"--pod-running-timeout", "5s",
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(5*time.Second, options.PodRunningTimeout)
+
+	client, err := NewClient(cmd)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("prod", client.Context)
+	suite.Assert().Equal("shop", client.Namespace)
+
+	config, err := loadClientConfig(cmd, "prod", "shop").ClientConfig()
+	suite.Require().NoError(err)
+	suite.Assert().Equal("https://override.example.com:6443", config.Host)
+	suite.Assert().Equal("override-token", config.BearerToken)
+	suite.Assert().Equal("alice", config.Impersonate.UserName)
+	suite.Assert().Equal([]string{"ops"}, config.Impersonate.Groups)
+	suite.Assert().Equal(map[string][]string{"scope": {"read"}}, config.Impersonate.Extra)
+
+	client, err = NewClientFor(cmd, "dev", "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("dev", client.Context)
+	suite.Assert().Equal("default", client.Namespace, "The namespace of the context should be used")
+}
+
+func (suite *StreamSuite) TestShouldKeepEventsOfDeletedStreamedPods() {
+	streamer := suite.streamer(pod("api-1", map[string]string{"app": "api"}, "main"))
+	streamer.Selector = "app=api"
+	matcher := streamer.newEventMatcher()
+	event := func(name string) *corev1.Event {
+		return &corev1.Event{InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: name}}
+	}
+
+	suite.Assert().True(matcher.matches(suite.ctx, event("api-1")))
+	suite.Assert().False(matcher.matches(suite.ctx, event("api-0")), "The events of unknown deleted pods should be dropped")
+
+	matcher.record(func(Line) {})(Line{Source: Source{Pod: "api-0", Container: "main"}})
+	suite.Assert().True(matcher.matches(suite.ctx, event("api-0")), "The events of deleted pods that were streamed should be kept")
+}
+
+func (suite *StreamSuite) TestCanMergeEventsWithHeldLines() {
+	start := time.Now()
+	lines := []Line{}
+	merger := &lineMerger{handle: func(line Line) { lines = append(lines, line) }}
+	merger.add(Line{Time: start, Text: "log 1"})
+	merger.add(Line{Time: start.Add(2 * time.Second), Text: "log 2"})
+	merger.add(Line{Time: start.Add(3 * time.Second), Banner: DetachedBanner})
+	merger.add(Line{Time: start.Add(time.Second), Text: "event", Event: &corev1.Event{}})
+	merger.add(Line{Time: start.Add(5 * time.Second), Text: "late event", Event: &corev1.Event{}})
+
+	merger.flush(start.Add(-time.Hour))
+	suite.Assert().Empty(lines, "The lines should be held")
+	merger.flush(time.Time{})
+	texts := []string{}
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+	suite.Assert().Equal([]string{"log 1", "event", "log 2", "", "late event"}, texts)
+}
+
+func (suite *StreamSuite) TestCanSelectPodsOfCronJob() {
+	cronjob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "shop", UID: "cron-uid"}}
+	owned := func(name, uid string, owner types.UID) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", UID: types.UID(uid)}}
+		if len(owner) > 0 {
+			job.OwnerReferences = []metav1.OwnerReference{{Kind: "CronJob", Name: "backup", UID: owner}}
+		}
+		return job
+	}
+	clientset := fake.NewClientset(cronjob, owned("backup-2", "job-2", "cron-uid"), owned("backup-1", "job-1", "cron-uid"), owned("other", "job-3", ""))
+
+	selector, err := GetWorkloadSelector(suite.ctx, clientset, "shop", "cronjobs", "backup")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("controller-uid in (job-1,job-2)", selector)
+
+	_, err = GetWorkloadSelector(suite.ctx, fake.NewClientset(cronjob), "shop", "cronjobs", "backup")
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.NotFound, "A cronjob without jobs has no pods")
+}
+
+// follow follows the logs of the streamer in the background, the returned func gives the next line received
+func (suite *StreamSuite) follow(streamer *Streamer) (next func() Line, stop func()) {
+	ctx, cancel := context.WithCancel(suite.ctx)
+	received := make(chan Line, 20)
+	done := make(chan error, 1)
+	go func() { done <- streamer.watch(ctx, func(line Line) { received <- line }) }()
+	next = func() Line {
+		select {
+		case line := <-received:
+			return line
+		case <-time.After(5 * time.Second):
+			suite.FailNow("No line received")
+			return Line{}
+		}
+	}
+	stop = func() {
+		cancel()
+		suite.Require().NoError(<-done)
+	}
+	return
+}
+
+// running sets the given container of the pod as running
+func running(pod *corev1.Pod, container, containerID string) *corev1.Pod {
+	pod = pod.DeepCopy()
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:        container,
+		ContainerID: containerID,
+		State:       corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.Now()}},
+	}}
+	return pod
+}
+
+func (suite *StreamSuite) TestCanAttachContainerWhenItRuns() {
+	api := pod("api-1", map[string]string{"app": "api"}, "main")
+	api.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "main",
+		State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+	}}
+	clientset := fake.NewClientset(api)
+	podWatch := watch.NewFake()
+	clientset.PrependWatchReactor("pods", k8stesting.DefaultWatchReactor(podWatch, nil))
+	streamer := &Streamer{Client: &Client{Clientset: clientset, Context: "test", Namespace: "shop"}, Selector: "app=api", Follow: true}
+
+	next, stop := suite.follow(streamer)
+	defer stop()
+	podWatch.Modify(running(api, "main", "containerd://1"))
+	suite.Assert().Equal(AttachedBanner, next().Banner)
+	suite.Assert().Equal("fake logs", next().Text)
+	suite.Assert().Equal(DetachedBanner, next().Banner)
+}
+
+func (suite *StreamSuite) TestShouldRetryFailedStream() {
+	api := running(pod("api-1", map[string]string{"app": "api"}, "main"), "main", "containerd://1")
+	clientset := fake.NewClientset(api)
+	clientset.PrependWatchReactor("pods", k8stesting.DefaultWatchReactor(watch.NewFake(), nil))
+	var requests atomic.Int32
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() == "log" && requests.Add(1) == 1 {
+			return true, nil, errors.Errorf("connection reset by peer")
+		}
+		return false, nil, nil
+	})
+	streamer := &Streamer{Client: &Client{Clientset: clientset, Context: "test", Namespace: "shop"}, Selector: "app=api", Follow: true}
+
+	next, stop := suite.follow(streamer)
+	defer stop()
+	suite.Assert().Equal(AttachedBanner, next().Banner)
+	detached := next()
+	suite.Assert().Equal(DetachedBanner, detached.Banner)
+	suite.Assert().Contains(detached.Text, "retrying in 1s")
+	suite.Assert().Equal(AttachedBanner, next().Banner, "The container should be attached again after the backoff")
+	suite.Assert().Equal("fake logs", next().Text)
+	suite.Assert().Equal(DetachedBanner, next().Banner)
+	suite.Assert().Equal(int32(2), requests.Load())
+}
+
+func (suite *StreamSuite) TestShouldOfferOnlySelectorsOfReleaseChart() {
+	// a fake helm lists the release, gives its metadata, and records its calls
+	dir := suite.T().TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$@" >> ` + calls + `
+case "$1" in
+list) echo '[{"name":"shop","chart":"nginx-1.2.3"}]' ;;
+get) echo '{"name":"shop","chart":"nginx","version":"1.2.3"}' ;;
+esac
+`
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "helm"), []byte(script), 0700))
+	suite.T().Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cmd := &cobra.Command{Use: "test"}
+	CreateLogsFlags(cmd)
+	redis := Selector{Name: "redis-app", Charts: []string{"redis"}}
+	redis.Register(cmd)
+	cmd.SetContext(suite.ctx)
+	suite.Require().NoError(cmd.ParseFlags([]string{"--context", "test", "--namespace", "shop", "--release", "shop"}))
+	content, err := os.ReadFile(calls)
+	suite.Require().NoError(err)
+	suite.Assert().NotContains(string(content), "metadata", "The chart should not be looked up before completing")
+
+	chart, err := GetReleaseChart(suite.ctx, "test", "shop", "shop")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("nginx", chart)
+
+	values, err := redis.allowedFunc()(suite.ctx, cmd, nil, "")
+	suite.Require().NoError(err)
+	suite.Assert().Empty(values, "The selector does not support the chart of the release")
+	content, err = os.ReadFile(calls)
+	suite.Require().NoError(err)
+	suite.Assert().Contains(string(content), "get metadata shop -o json --kube-context test --namespace shop")
+}
+
+func (suite *StreamSuite) TestCanFollowPodsOfNewJobsOfCronJob() {
+	cronjob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "shop", UID: "cron-uid"}}
+	job := func(name, uid string) *batchv1.Job {
+		controller := true
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", UID: types.UID(uid), OwnerReferences: []metav1.OwnerReference{
+			{Kind: "CronJob", Name: "backup", UID: "cron-uid", Controller: &controller},
+		}}}
+	}
+	clientset := fake.NewClientset(cronjob, job("backup-1", "job-1"), running(pod("backup-1-a", map[string]string{"controller-uid": "job-1"}, "main"), "main", "containerd://1"))
+	podWatches := make(chan *watch.FakeWatcher, 10)
+	clientset.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		podWatch := watch.NewFake()
+		podWatches <- podWatch
+		return true, podWatch, nil
+	})
+	jobWatch := watch.NewFake()
+	clientset.PrependWatchReactor("jobs", k8stesting.DefaultWatchReactor(jobWatch, nil))
+
+	selector, err := GetWorkloadSelector(suite.ctx, clientset, "shop", "cronjobs", "backup")
+	suite.Require().NoError(err)
+	streamer := &Streamer{Client: &Client{Clientset: clientset, Context: "test", Namespace: "shop"}, Selector: selector, Follow: true, cronJobs: map[string]string{"backup": selector}}
+
+	next, stop := suite.follow(streamer)
+	defer stop()
+	attached := next()
+	suite.Assert().Equal(AttachedBanner, attached.Banner)
+	suite.Assert().Equal("backup-1-a", attached.Source.Pod)
+	suite.Assert().Equal("fake logs", next().Text)
+	suite.Assert().Equal(DetachedBanner, next().Banner)
+	<-podWatches
+
+	// the cronjob creates a new job, its pods are selected
+	backup2 := job("backup-2", "job-2")
+	suite.Require().NoError(clientset.Tracker().Add(backup2))
+	jobWatch.Add(backup2)
+	select {
+	case podWatch := <-podWatches:
+		suite.Assert().Equal("controller-uid in (job-1,job-2)", streamer.listSelector())
+		podWatch.Add(running(pod("backup-2-a", map[string]string{"controller-uid": "job-2"}, "main"), "main", "containerd://2"))
+	case <-time.After(5 * time.Second):
+		suite.FailNow("The pods should be watched again")
+	}
+	attached = next()
+	suite.Assert().Equal(AttachedBanner, attached.Banner)
+	suite.Assert().Equal("backup-2-a", attached.Source.Pod)
+	suite.Assert().Equal("fake logs", next().Text)
+}
+
+func (suite *StreamSuite) TestShouldReportUnknownContexts() {
+	cmd := &cobra.Command{Use: "test"}
+	options := CreateLogsFlags(cmd)
+	suite.Require().NoError(cmd.ParseFlags([]string{"--kubeconfig", suite.kubeconfig(), "--context", "prod,staging,qa-*"}))
+
+	targets, err := GetTargets(suite.ctx, cmd, options)
+	suite.Assert().Equal([]Target{{Context: "prod"}}, targets)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.NotFound)
+	suite.Assert().Contains(err.Error(), "context staging", "The literal context should be reported")
+	suite.Assert().NotContains(err.Error(), "qa-*", "The globs that match nothing are not failures")
+
+	cmd = &cobra.Command{Use: "test"}
+	options = CreateLogsFlags(cmd)
+	suite.Require().NoError(cmd.ParseFlags([]string{"--kubeconfig", suite.kubeconfig(), "--context", "staging"}))
+	targets, err = GetTargets(suite.ctx, cmd, options)
+	suite.Assert().Empty(targets)
+	suite.Require().Error(err)
+	suite.Assert().Contains(err.Error(), "context staging")
+}
+
+func (suite *StreamSuite) TestCanReplayRecordedBundle() {
+	clientset := fake.NewClientset(pod("api-1", map[string]string{"app": "api"}, "main"))
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "log" {
+			return false, nil, nil
+		}
+		return true, &runtime.Unknown{Raw: []byte("2026-10-18T10:00:00Z hello\n2026-10-18T10:00:02Z world\n")}, nil
+	})
+	streamer := &Streamer{Client: &Client{Clientset: clientset, Context: "test", Namespace: "shop"}, Selector: "app=api"}
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+
+	for _, name := range []string{"bundle", "bundle.tar", "bundle.tar.gz", "bundle.tgz"} {
+		bundlePath := filepath.Join(suite.T().TempDir(), name)
+		recorder, err := NewRecorder(bundlePath, []*Streamer{streamer}, true, false)
+		suite.Require().NoError(err, name)
+		err = streamer.Stream(suite.ctx, func(line Line) { suite.Require().NoError(recorder.Record(line)) })
+		suite.Require().NoError(err, name)
+		event := &corev1.Event{Reason: "Pulled", Message: "Image pulled", InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "shop", Name: "api-1"}}
+		suite.Require().NoError(recorder.Record(Line{Source: Source{Context: "test", Namespace: "shop", Pod: "api-1"}, Time: start.Add(time.Second), Text: "Image pulled", Event: event}))
+		suite.Require().NoError(recorder.Close(), name)
+
+		suite.Require().True(IsBundle(bundlePath), name)
+		bundle, lines, err := OpenBundle(bundlePath)
+		suite.Require().NoError(err, name)
+		suite.Assert().True(bundle.Prefix, name)
+		suite.Assert().Equal([]BundleTarget{{Context: "test", Namespace: "shop", Selector: "app=api"}}, bundle.Targets, name)
+		suite.Require().Len(bundle.Streams, 1, name)
+		suite.Assert().Equal(2, bundle.Streams[0].Lines, name)
+		suite.Assert().Equal(start, bundle.Start, name)
+		suite.Assert().Equal(start.Add(2*time.Second), bundle.End, name)
+
+		suite.Require().Len(lines, 3, name)
+		suite.Assert().Equal("hello", lines[0].Text, name)
+		suite.Assert().Equal(Source{Context: "test", Namespace: "shop", Pod: "api-1", Container: "main", Labels: map[string]string{"app": "api"}}, lines[0].Source, name)
+		suite.Assert().Equal("Image pulled", lines[1].Text, "The events should be merged by time in %s", name)
+		suite.Require().NotNil(lines[1].Event, name)
+		suite.Assert().Equal("Pulled", lines[1].Event.Reason, name)
+		suite.Assert().Equal("world", lines[2].Text, name)
+		suite.Assert().True(lines[2].Time.Equal(start.Add(2*time.Second)), name)
+	}
+}
+
+func (suite *StreamSuite) TestShouldRecognizeBundleByMetadataFile() {
+	dir := suite.T().TempDir()
+	suite.Assert().False(IsBundle(dir), "A directory without metadata is not a bundle")
+	suite.Assert().False(IsBundle(filepath.Join(dir, "missing.tgz")))
+
+	// a tarball without metadata is not a bundle
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "app.log"), []byte("hello\n"), 0o644))
+	tarball := filepath.Join(suite.T().TempDir(), "logs.tar.gz")
+	suite.Require().NoError(writeTarball(tarball, dir))
+	suite.Assert().False(IsBundle(tarball))
+	_, _, err := OpenBundle(tarball)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.NotFound)
+
+	// a file that is not a tarball is not a bundle, even with the extension
+	notTarball := filepath.Join(dir, "app.tgz")
+	suite.Require().NoError(os.WriteFile(notTarball, []byte("not a tarball"), 0o644))
+	suite.Assert().False(IsBundle(notTarball))
+
+	// a bundle whose stream is missing cannot be opened
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, BundleMetadataFile), []byte(`{"version": 1, "streams": [{"file": "streams/test/shop/api-1/main.log"}]}`), 0o644))
+	suite.Assert().True(IsBundle(dir))
+	_, _, err = OpenBundle(dir)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, os.ErrNotExist)
+
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, BundleMetadataFile), []byte(`{"version": 2}`), 0o644))
+	_, _, err = OpenBundle(dir)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.Unsupported, "Newer bundles are not supported")
+}
@@ -0,0 +1,108 @@
+package kubectl
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Target is a Kubernetes context and namespace to stream logs from
+type Target struct {
+	Context   string
+	Namespace string
+}
+
+// GetTargets gets the contexts and namespaces given by --context and --namespace, as lists or globs
+//
+// Without --context, the current context is used. Without --namespace, the namespace of each context is used.
+// Namespace globs are matched against the namespaces of each context.
+// If some contexts cannot be reached or are not in the kubeconfig, their errors are returned with the targets of the other contexts.
+func GetTargets(ctx context.Context, cmd *cobra.Command, options *LogsOptions) (targets []Target, err error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "targets")
+	var merr errors.MultiError
+
+	contexts := []string{""}
+	if len(options.Context.Values) > 0 {
+		rawConfig, err := loadClientConfig(cmd, "", "").RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		contexts = []string{}
+		for name := range rawConfig.Contexts {
+			if options.Context.Match(name) {
+				contexts = append(contexts, name)
+			}
+		}
+		for _, name := range options.Context.Values {
+			if _, found := rawConfig.Contexts[name]; !found && !isGlob(name) {
+				log.Errorf("Context %s is not in the kubeconfig", name)
+				merr.Append(errors.Join(errors.Errorf("context %s", name), errors.NotFound.With("context", name)))
+			}
+		}
+		if len(contexts) == 0 {
+			if err := merr.AsError(); err != nil {
+				return nil, err
+			}
+			return nil, errors.NotFound.With("context", options.Context.String())
+		}
+		sort.Strings(contexts)
+	}
+
+	for _, kubeContext := range contexts {
+		if len(options.Namespace.Values) == 0 {
+			targets = append(targets, Target{Context: kubeContext})
+			continue
+		}
+		var namespaces []string
+		for _, namespace := range options.Namespace.Values {
+			if !isGlob(namespace) {
+				namespaces = append(namespaces, namespace)
+			}
+		}
+		if len(namespaces) < len(options.Namespace.Values) {
+			client, err := NewClientFor(cmd, kubeContext, "")
+			if err != nil {
+				log.Errorf("Failed to create client for context %s", kubeContext, err)
+				merr.Append(errors.Join(errors.Errorf("context %s", kubeContext), err))
+				continue
+			}
+			list, err := client.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				log.Errorf("Failed to list namespaces in context %s", kubeContext, err)
+				merr.Append(errors.Join(errors.Errorf("context %s", kubeContext), err))
+				continue
+			}
+			for _, item := range list.Items {
+				if options.Namespace.Match(item.Name) {
+					namespaces = append(namespaces, item.Name)
+				}
+			}
+		}
+		sort.Strings(namespaces)
+		for index, namespace := range namespaces {
+			if index == 0 || namespaces[index-1] != namespace {
+				targets = append(targets, Target{Context: kubeContext, Namespace: namespace})
+			}
+		}
+	}
+	log.Debugf("Found %d targets: %v", len(targets), targets)
+	return targets, merr.AsError()
+}
+
+// String returns the context and namespace of the target
+//
+// implements fmt.Stringer
+func (target Target) String() string {
+	kubeContext, namespace := target.Context, target.Namespace
+	if len(kubeContext) == 0 {
+		kubeContext = "current context"
+	}
+	if len(namespace) == 0 {
+		namespace = "default namespace"
+	}
+	return "context " + kubeContext + ", namespace " + namespace
+}
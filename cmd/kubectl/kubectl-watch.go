@@ -0,0 +1,495 @@
+package kubectl
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// podWatcher keeps track of the pods matching the selector and of the containers being streamed
+type podWatcher struct {
+	streamer *Streamer
+	handle   func(line Line)
+	waiter   sync.WaitGroup
+	pods     map[string]corev1.Pod
+	streams  map[string]*containerStream // the containers being streamed by pod/container
+	detached map[string]string           // the ID of the last container streamed by pod/container
+	skipped  map[string]bool             // the containers that could not be attached because of MaxLogRequests
+	retries  map[string]*streamRetry     // the running containers whose stream failed by pod/container
+	ended    chan streamEnd
+	retry    chan struct{}
+	cronJobs chan string // the cronjobs that created jobs
+}
+
+type containerStream struct {
+	source      Source
+	containerID string
+	options     corev1.PodLogOptions
+	cancel      context.CancelFunc
+	reason      string    // why the stream was canceled (e.g. the pod was deleted)
+	last        time.Time // the time of the last line streamed
+}
+
+// streamRetry tells when to attach again a running container whose stream failed
+type streamRetry struct {
+	containerID string
+	options     corev1.PodLogOptions // the options of the failed stream
+	attempts    int
+	at          time.Time // when the container can be attached again
+	since       time.Time // the time of the last line streamed, the lines up to it are not streamed again
+}
+
+const (
+	attachRetryDelay    = time.Second      // the delay before attaching again a container whose stream failed, doubled at each attempt
+	attachMaxRetryDelay = 30 * time.Second // the maximum delay before attaching again a container whose stream failed
+)
+
+type streamEnd struct {
+	key string
+	err error
+}
+
+// watch streams the containers of the pods matching the selector and attaches the new ones as they start
+//
+// Containers are attached when they run (at start or when their status moves to running) and detached when their log stream ends (terminated container, deleted pod).
+// When the stream of a running container fails, it is attached again after a backoff.
+// When following cronjobs, their jobs are watched too, the pods of the new jobs are selected as they are created.
+// The containers found at start are streamed with the log options (and their previous instance with WithPrevious), the new or restarted ones are streamed from their start.
+// If there are more containers than MaxLogRequests, the extra ones are attached when other streams end.
+func (streamer *Streamer) watch(ctx context.Context, handle func(line Line)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "watch")
+
+	if !streamer.hasSelector() {
+		return errors.ArgumentMissing.With("pod or selector")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	watcher := &podWatcher{
+		streamer: streamer,
+		handle:   handle,
+		pods:     map[string]corev1.Pod{},
+		streams:  map[string]*containerStream{},
+		detached: map[string]string{},
+		skipped:  map[string]bool{},
+		retries:  map[string]*streamRetry{},
+		ended:    make(chan streamEnd),
+		retry:    make(chan struct{}),
+		cronJobs: make(chan string),
+	}
+	defer func() {
+		cancel()
+		watcher.waiter.Wait()
+	}()
+	if len(streamer.cronJobs) > 0 {
+		watcher.waiter.Add(1)
+		go func() {
+			defer watcher.waiter.Done()
+			watcher.watchJobs(ctx)
+		}()
+	}
+
+	pods := streamer.Client.Clientset.CoreV1().Pods(streamer.Client.Namespace)
+	initial := true
+	for {
+		log.Debugf("Getting pods in namespace %s with selector %s", streamer.Client.Namespace, streamer.listSelector())
+		list, err := pods.List(ctx, metav1.ListOptions{LabelSelector: streamer.listSelector()})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		items := slices.DeleteFunc(list.Items, func(pod corev1.Pod) bool { return !streamer.matches(pod) })
+		if initial {
+			if err := watcher.checkMaxLogRequests(items); err != nil {
+				return err
+			}
+		}
+		watcher.replace(ctx, items, initial)
+		initial = false
+
+		log.Debugf("Watching pods from resource version %s", list.ResourceVersion)
+		podWatch, err := pods.Watch(ctx, metav1.ListOptions{LabelSelector: streamer.listSelector(), ResourceVersion: list.ResourceVersion})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		done := watcher.process(ctx, podWatch)
+		podWatch.Stop()
+		if done {
+			return nil
+		}
+		log.Debugf("Pod watch expired, restarting")
+	}
+}
+
+// checkMaxLogRequests fails like kubectl if there are more running containers than MaxLogRequests at start
+func (watcher *podWatcher) checkMaxLogRequests(pods []corev1.Pod) error {
+	if watcher.streamer.MaxLogRequests <= 0 {
+		return nil
+	}
+	count := 0
+	for _, pod := range pods {
+		sources, _ := watcher.streamer.podSources(pod)
+		for _, source := range sources {
+			if status := containerStatus(pod, source.Container); status != nil && status.State.Running != nil {
+				count++
+			}
+		}
+	}
+	if count > watcher.streamer.MaxLogRequests {
+		return errors.Errorf("you are attempting to follow %d log streams, but maximum allowed concurrency is %d, use --max-log-requests to increase the limit", count, watcher.streamer.MaxLogRequests)
+	}
+	return nil
+}
+
+// process processes the pod events and the ended streams until the watch expires (false) or the context is done (true)
+func (watcher *podWatcher) process(ctx context.Context, podWatch watch.Interface) bool {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "watch")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case end := <-watcher.ended:
+			watcher.end(ctx, end)
+			watcher.attach(ctx, false)
+		case <-watcher.retry:
+			watcher.attach(ctx, false)
+		case name := <-watcher.cronJobs:
+			if changed, err := watcher.streamer.updateCronJob(ctx, name); err != nil {
+				log.Warnf("Failed to get the jobs of cronjob %s: %s", name, err)
+			} else if changed {
+				log.Debugf("Cronjob %s created jobs, listing the pods again", name)
+				return false
+			}
+		case event, ok := <-podWatch.ResultChan():
+			if !ok {
+				return false
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if pod, ok := event.Object.(*corev1.Pod); ok && watcher.streamer.matches(*pod) {
+					watcher.pods[pod.Name] = *pod
+				} else if ok {
+					watcher.delete(*pod, "pod no longer matches the selector") // the labels of the pod changed
+				}
+			case watch.Deleted:
+				if pod, ok := event.Object.(*corev1.Pod); ok {
+					watcher.delete(*pod, "pod deleted")
+				}
+			case watch.Error:
+				log.Warnf("Pod watch failed: %v", event.Object)
+				return false
+			}
+			watcher.attach(ctx, false)
+		}
+	}
+}
+
+// watchJobs tells which followed cronjobs created jobs until the context is done
+//
+// Every followed cronjob is checked when the jobs are listed, as jobs may have been created before they are watched.
+func (watcher *podWatcher) watchJobs(ctx context.Context) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "watch", "jobs")
+	streamer := watcher.streamer
+
+	streamer.selectorLock.RLock()
+	names := slices.Sorted(maps.Keys(streamer.cronJobs))
+	streamer.selectorLock.RUnlock()
+	notify := func(name string) bool {
+		select {
+		case watcher.cronJobs <- name:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	jobs := streamer.Client.Clientset.BatchV1().Jobs(streamer.Client.Namespace)
+	for {
+		list, err := jobs.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("Failed to list the jobs of cronjobs %s: %s", strings.Join(names, ", "), err)
+			}
+			return
+		}
+		for _, name := range names {
+			if !notify(name) {
+				return
+			}
+		}
+		jobWatch, err := jobs.Watch(ctx, metav1.ListOptions{ResourceVersion: list.ResourceVersion})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("Failed to watch the jobs of cronjobs %s: %s", strings.Join(names, ", "), err)
+			}
+			return
+		}
+		for expired := false; !expired; {
+			select {
+			case <-ctx.Done():
+				jobWatch.Stop()
+				return
+			case event, ok := <-jobWatch.ResultChan():
+				if !ok || event.Type == watch.Error {
+					expired = true
+					break
+				}
+				job, ok := event.Object.(*batchv1.Job)
+				if !ok || event.Type != watch.Added {
+					continue
+				}
+				if owner := metav1.GetControllerOf(job); owner != nil && owner.Kind == "CronJob" && slices.Contains(names, owner.Name) {
+					if !notify(owner.Name) {
+						jobWatch.Stop()
+						return
+					}
+				}
+			}
+		}
+		jobWatch.Stop()
+		log.Debugf("Job watch expired, restarting")
+	}
+}
+
+// replace replaces the known pods with the given ones and attaches their running containers
+func (watcher *podWatcher) replace(ctx context.Context, pods []corev1.Pod, initial bool) {
+	names := map[string]bool{}
+	for _, pod := range pods {
+		names[pod.Name] = true
+		watcher.pods[pod.Name] = pod
+	}
+	for name, pod := range watcher.pods {
+		if !names[name] {
+			watcher.delete(pod, "pod deleted")
+		}
+	}
+	watcher.attach(ctx, initial)
+}
+
+// delete forgets the given pod and stops streaming its containers, the reason is shown when they are detached
+func (watcher *podWatcher) delete(pod corev1.Pod, reason string) {
+	name := pod.Name
+	delete(watcher.pods, name)
+	for _, stream := range watcher.streams {
+		if stream.source.Pod == name {
+			stream.reason = reason
+			if terminated := terminatedReason(pod, stream.source.Container); len(terminated) > 0 {
+				stream.reason = reason + ", " + terminated
+			}
+			stream.cancel()
+		}
+	}
+	for key := range watcher.detached {
+		if strings.HasPrefix(key, name+"/") {
+			delete(watcher.detached, key)
+		}
+	}
+	for key := range watcher.skipped {
+		if strings.HasPrefix(key, name+"/") {
+			delete(watcher.skipped, key)
+		}
+	}
+	for key := range watcher.retries {
+		if strings.HasPrefix(key, name+"/") {
+			delete(watcher.retries, key)
+		}
+	}
+}
+
+// attach starts streaming the running containers that are not streamed yet
+func (watcher *podWatcher) attach(ctx context.Context, initial bool) {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubectl", "watch")
+	streamer := watcher.streamer
+
+	names := make([]string, 0, len(watcher.pods))
+	for name := range watcher.pods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pod := watcher.pods[name]
+		sources, err := streamer.podSources(pod)
+		if err != nil {
+			log.Debugf("Ignoring pod %s: %s", pod.Name, err)
+			continue
+		}
+		for _, source := range sources {
+			key := pod.Name + "/" + source.Container
+			status := containerStatus(pod, source.Container)
+			if status == nil || status.State.Running == nil {
+				continue
+			}
+			if _, streaming := watcher.streams[key]; streaming {
+				continue
+			}
+			if containerID, found := watcher.detached[key]; found && containerID == status.ContainerID {
+				continue // the container did not restart since it was detached
+			}
+			retry, retrying := watcher.retries[key]
+			if retrying && retry.containerID != status.ContainerID {
+				delete(watcher.retries, key) // the container restarted since its stream failed
+				retry, retrying = nil, false
+			}
+			if retrying && time.Now().Before(retry.at) {
+				continue
+			}
+			if streamer.MaxLogRequests > 0 && len(watcher.streams) >= streamer.MaxLogRequests {
+				if !watcher.skipped[key] {
+					watcher.skipped[key] = true
+					streamer.emit(watcher.handle, Line{Source: source, Time: time.Now(), Banner: SkippedBanner, Text: fmt.Sprintf("max log requests (%d) reached", streamer.MaxLogRequests)})
+				}
+				continue
+			}
+			delete(watcher.skipped, key)
+
+			options := streamer.LogOptions
+			if !initial {
+				// new or restarted containers are streamed from their start
+				options.TailLines = nil
+				options.SinceSeconds = nil
+				options.SinceTime = &metav1.Time{Time: status.State.Running.StartedAt.Time}
+			}
+			var since time.Time
+			if retrying {
+				// the failed stream is started again from its last line
+				options, since = retry.options, retry.since
+				if !since.IsZero() {
+					options.TailLines = nil
+					options.SinceSeconds = nil
+					options.SinceTime = &metav1.Time{Time: since}
+				}
+			}
+			streamCtx, cancel := context.WithCancel(ctx)
+			stream := &containerStream{source: source, containerID: status.ContainerID, options: options, cancel: cancel}
+			watcher.streams[key] = stream
+			streamer.emit(watcher.handle, Line{Source: source, Time: time.Now(), Banner: AttachedBanner})
+
+			// the stream records the time of its last line, the lines already streamed before a retry are skipped
+			handle := func(line Line) {
+				if !since.IsZero() && !line.Time.IsZero() && !line.Time.After(since) {
+					return
+				}
+				if !line.Time.IsZero() {
+					stream.last = line.Time
+				}
+				watcher.handle(line)
+			}
+			watcher.waiter.Add(1)
+			go func() {
+				defer watcher.waiter.Done()
+				var err error
+				if initial && !retrying {
+					err = streamer.streamInstances(streamCtx, source, options, handle)
+				} else {
+					err = streamer.streamContainer(streamCtx, source, options, handle)
+				}
+				select {
+				case watcher.ended <- streamEnd{key: key, err: err}:
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
+}
+
+// end detaches the container whose stream ended
+//
+// The reason of the deletion or of the termination is shown first, the error of the stream only if there is none.
+// If the stream of a running container failed, the container is attached again after a backoff.
+func (watcher *podWatcher) end(ctx context.Context, end streamEnd) {
+	stream, found := watcher.streams[end.key]
+	if !found {
+		return
+	}
+	stream.cancel()
+	delete(watcher.streams, end.key)
+
+	reason := stream.reason
+	failed := end.err != nil && !errors.Is(end.err, context.Canceled)
+	if pod, found := watcher.pods[stream.source.Pod]; found {
+		if len(reason) == 0 {
+			reason = terminatedReason(pod, stream.source.Container)
+		}
+		status := containerStatus(pod, stream.source.Container)
+		if len(reason) == 0 && failed && status != nil && status.State.Running != nil && status.ContainerID == stream.containerID {
+			delay := watcher.retryLater(ctx, end.key, stream)
+			watcher.streamer.emit(watcher.handle, Line{Source: stream.source, Time: time.Now(), Banner: DetachedBanner, Text: fmt.Sprintf("%s, retrying in %s", end.err, delay)})
+			return
+		}
+		watcher.detached[end.key] = stream.containerID
+	} else if len(reason) == 0 {
+		reason = "pod deleted"
+	}
+	delete(watcher.retries, end.key)
+	if len(reason) == 0 && failed {
+		reason = end.err.Error()
+	}
+	watcher.streamer.emit(watcher.handle, Line{Source: stream.source, Time: time.Now(), Banner: DetachedBanner, Text: reason})
+}
+
+// retryLater schedules the attachment of the container whose stream failed and returns the delay before it
+//
+// The delay doubles at each attempt, up to attachMaxRetryDelay, and starts again when the stream received lines.
+func (watcher *podWatcher) retryLater(ctx context.Context, key string, stream *containerStream) time.Duration {
+	retry, found := watcher.retries[key]
+	if !found {
+		retry = &streamRetry{containerID: stream.containerID, options: stream.options}
+		watcher.retries[key] = retry
+	}
+	if stream.last.After(retry.since) {
+		retry.since = stream.last
+		retry.attempts = 0
+	}
+	delay := min(attachRetryDelay<<retry.attempts, attachMaxRetryDelay)
+	if delay < attachMaxRetryDelay {
+		retry.attempts++
+	}
+	retry.at = time.Now().Add(delay)
+	time.AfterFunc(delay, func() {
+		select {
+		case watcher.retry <- struct{}{}:
+		case <-ctx.Done():
+		}
+	})
+	return delay
+}
+
+// terminatedReason tells why the given container of the pod terminated (e.g. "OOMKilled, exit code 137"), empty if it did not
+func terminatedReason(pod corev1.Pod, container string) string {
+	if status := containerStatus(pod, container); status != nil && status.State.Terminated != nil {
+		return fmt.Sprintf("%s, exit code %d", status.State.Terminated.Reason, status.State.Terminated.ExitCode)
+	}
+	return ""
+}
+
+// containerStatus gets the status of the given container in the pod
+func containerStatus(pod corev1.Pod, container string) *corev1.ContainerStatus {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name == container {
+			return &status
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return &status
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package kubectl
+
+import (
+	"path"
+	"strings"
+
+	"github.com/gildas/go-core"
+	"github.com/gildas/go-flags"
+	"github.com/spf13/cobra"
+)
+
+// ListFlag represents a flag that accepts a list of values, separated by commas or given more than once
+//
+// The values can be globs (e.g. "prod-*"), the allowed values are only used for completion.
+type ListFlag struct {
+	Values      []string
+	AllowedFunc flags.AllowedFunc
+}
+
+// NewListFlag creates a new ListFlag
+func NewListFlag(allowedFunc flags.AllowedFunc) *ListFlag {
+	return &ListFlag{AllowedFunc: allowedFunc}
+}
+
+// Type returns the type of the flag
+//
+// implements pflag.Value
+func (flag ListFlag) Type() string {
+	return "strings"
+}
+
+// String returns the string representation of the flag
+//
+// implements fmt.Stringer and pflag.Value
+func (flag ListFlag) String() string {
+	return strings.Join(flag.Values, ",")
+}
+
+// Set adds the comma separated values to the flag
+//
+// implements pflag.Value
+func (flag *ListFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			flag.Values = append(flag.Values, item)
+		}
+	}
+	return nil
+}
+
+// Single returns the value of the flag if it contains only one value that is not a glob
+func (flag ListFlag) Single() string {
+	if len(flag.Values) == 1 && !isGlob(flag.Values[0]) {
+		return flag.Values[0]
+	}
+	return ""
+}
+
+// Match tells if the given value matches one of the values or globs of the flag
+func (flag ListFlag) Match(value string) bool {
+	for _, pattern := range flag.Values {
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// CompletionFunc returns the completion function of the flag
+//
+// The last value of a comma separated list is completed
+func (flag *ListFlag) CompletionFunc(flagName string) (string, func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)) {
+	return flagName, func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if flag.AllowedFunc == nil {
+			return []string{}, cobra.ShellCompDirectiveNoFileComp
+		}
+		prefix := ""
+		if index := strings.LastIndex(toComplete, ","); index >= 0 {
+			prefix, toComplete = toComplete[:index+1], toComplete[index+1:]
+		}
+		allowed, err := flag.AllowedFunc(cmd.Context(), cmd, args, toComplete)
+		if err != nil {
+			return []string{}, cobra.ShellCompDirectiveError
+		}
+		return core.Map(allowed, func(value string) string { return prefix + value }), cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// isGlob tells if the value contains glob characters
+func isGlob(value string) bool {
+	return strings.ContainsAny(value, "*?[")
+}
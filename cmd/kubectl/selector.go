@@ -1,6 +1,11 @@
 package kubectl
 
 import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/gildas/go-errors"
 	"github.com/gildas/go-flags"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -21,16 +26,51 @@ type Selector struct {
 var kubectlSelectors Selectors
 
 // InitializeSelectors initializes the selectors by unmarshalling the configuration and registering them to the command
+//
+// When a Helm release is given with --release, only the selectors that support the chart of the release are offered by the shell completion and accepted by CheckReleaseSelectors.
+// As the selectors are registered before the flags are parsed, the chart is looked up lazily, when completing or once the flags are parsed.
 func InitializeSelectors(cmd *cobra.Command) error {
-	if err := viper.UnmarshalKey("selectors", &kubectlSelectors); err != nil {
+	var selectors Selectors
+	if err := viper.UnmarshalKey("selectors", &selectors); err != nil {
 		return err
 	}
+	kubectlSelectors = selectors
 	for i := range kubectlSelectors {
 		kubectlSelectors[i].Register(cmd)
 	}
 	return nil
 }
 
+// CheckReleaseSelectors checks that the selectors given in the command line support the chart of the given Helm release
+//
+// If the release cannot be found, only the selectors supporting all charts are accepted
+func CheckReleaseSelectors(cmd *cobra.Command, kubeContext, namespace, release string) error {
+	used := Selectors{}
+	for _, selector := range kubectlSelectors {
+		if _, found := selector.HasFlag(cmd); found {
+			used = append(used, selector)
+		}
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	chart, _ := GetReleaseChart(cmd.Context(), kubeContext, namespace, release)
+	for _, selector := range used {
+		if !selector.SupportsChart(chart) {
+			name, _ := selector.HasFlag(cmd)
+			return errors.ArgumentInvalid.With("--"+name, fmt.Sprintf("not supported by the chart %q of the release %s", chart, release))
+		}
+	}
+	return nil
+}
+
+// SupportsChart tells if the selector can be used with the given Helm chart
+//
+// A selector without charts or with the "*" chart supports all charts
+func (selector Selector) SupportsChart(chart string) bool {
+	return len(selector.Charts) == 0 || slices.Contains(selector.Charts, "*") || slices.Contains(selector.Charts, chart)
+}
+
 // HasFlag checks if any of the selectors has a flag set in the command line
 func (selectors Selectors) HasFlag(cmd *cobra.Command) bool {
 	for _, selector := range selectors {
@@ -72,10 +112,34 @@ func (selector Selector) HasFlag(cmd *cobra.Command) (name string, ok bool) {
 
 // register registers a flag for the selector to the given command
 func (selector *Selector) register(cmd *cobra.Command, name string) {
-	value := flags.NewEnumFlagWithFunc(cmd, "", GetResourceLabelsFunc("deployments.apps", selector.GetLabel()))
+	value := flags.NewEnumFlagWithFunc(cmd, "", selector.allowedFunc())
 	if cmd.Flags().Lookup(name) == nil {
 		cmd.Flags().Var(value, name, selector.Usage)
 	}
 	_ = cmd.RegisterFlagCompletionFunc(value.CompletionFunc(name))
 	selector.Value = value
 }
+
+// allowedFunc gives the values of the selector offered by the shell completion
+//
+// If a Helm release is given with --release and its chart is not supported by the selector, no value is offered
+func (selector Selector) allowedFunc() flags.AllowedFunc {
+	resourceLabels := GetResourceLabelsFunc("deployments.apps", selector.GetLabel())
+	return func(ctx context.Context, cmd *cobra.Command, args []string, toComplete string) ([]string, error) {
+		if release := flagString(cmd, "release"); len(release) > 0 {
+			kubeContext, err := GetCurrentContext(ctx, cmd)
+			if err != nil {
+				return nil, err
+			}
+			namespace, err := GetCurrentNamespace(ctx, cmd, kubeContext)
+			if err != nil {
+				return nil, err
+			}
+			chart, _ := GetReleaseChart(ctx, kubeContext, namespace, release)
+			if !selector.SupportsChart(chart) {
+				return []string{}, nil
+			}
+		}
+		return resourceLabels(ctx, cmd, args, toComplete)
+	}
+}
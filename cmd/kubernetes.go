@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/kubectl"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// EventTopic is the topic of the log entries created from Kubernetes events
+const EventTopic = "k8s-event"
+
+// KubernetesBlob is the blob of the log entries read from Kubernetes that describes their source (e.g. .k8s.pod)
+const KubernetesBlob = "k8s"
+
+// sourcePrefix matches the source written before the log lines by --prefix, like kubectl logs does (e.g. "[pod/api-1/main] ")
+//
+// With more than one context or namespace, the source starts with them (e.g. "[prod-eu/shop/pod/api-1/main] ").
+// The entries received by lv listen are prefixed with their protocol and sender (e.g. "[syslog:10.0.0.1] "),
+// and the entries merged from several remote objects with their object (e.g. "[s3:bucket/logs/api.log] ")
+var sourcePrefix = regexp.MustCompile(`^\[((?:\S+/[a-z0-9-]+/)?pod/[^\s/\]]+/[^\s\]]+|[a-z0-9+]+:[^\s\]]+)\] `)
+
+// SplitSourcePrefix splits the source written by --prefix from the rest of the line
+//
+// If the line has no source, the source is empty and the line is returned as is
+func SplitSourcePrefix(line []byte) (source string, rest []byte) {
+	if match := sourcePrefix.FindSubmatch(line); match != nil {
+		return string(match[1]), line[len(match[0]):]
+	}
+	return "", line
+}
+
+// SplitTimestampPrefix splits the timestamp written by --timestamps from the rest of the line (e.g. "2026-10-18T10:00:00.123456789Z ")
+//
+// If the line has no timestamp, the timestamp is empty and the line is returned as is
+func SplitTimestampPrefix(line []byte) (timestamp string, rest []byte) {
+	if value, rest, found := bytes.Cut(line, []byte(" ")); found {
+		if _, err := time.Parse(time.RFC3339Nano, string(value)); err == nil {
+			return string(value), rest
+		}
+	}
+	return "", line
+}
+
+// streamKubernetes streams the log lines from Kubernetes to the given io.Writer output
+//
+// With more than one streamer (contexts or namespaces), they are streamed concurrently and their lines are tagged with their context and namespace.
+// When not following, the lines are merged by time.
+// If a streamer fails, a banner is written and the others continue, an error is returned only if all of them fail.
+//
+// If recorder is not nil, the lines are recorded too.
+func streamKubernetes(ctx context.Context, streamers []*kubectl.Streamer, output io.Writer, recorder *kubectl.Recorder, options *OutputOptions) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubernetes", "stream")
+
+	writeLine := func(line kubectl.Line, prefix, tagged bool) {
+		if recorder != nil {
+			if err := recorder.Record(line); err != nil {
+				log.Errorf("Failed to record line from pod %s, container %s", line.Source.Pod, line.Source.Container, err)
+			}
+		}
+		writeKubernetesLine(output, line, prefix, tagged, options)
+	}
+	if len(streamers) == 1 {
+		return streamers[0].Stream(ctx, func(line kubectl.Line) {
+			writeLine(line, streamers[0].Prefix, false)
+		})
+	}
+	var lock sync.Mutex
+	var lines []kubectl.Line
+	var waiter sync.WaitGroup
+	var merr errors.MultiError
+
+	for _, streamer := range streamers {
+		waiter.Add(1)
+		go func(streamer *kubectl.Streamer) {
+			defer waiter.Done()
+			err := streamer.Stream(ctx, func(line kubectl.Line) {
+				lock.Lock()
+				defer lock.Unlock()
+				if streamer.Follow {
+					writeLine(line, true, true)
+				} else {
+					lines = append(lines, line)
+				}
+			})
+			if err != nil && ctx.Err() == nil {
+				lock.Lock()
+				defer lock.Unlock()
+				merr.Append(err)
+				source := kubectl.Source{Context: streamer.Client.Context, Namespace: streamer.Client.Namespace}
+				writeLine(kubectl.Line{Source: source, Time: time.Now(), Banner: kubectl.FailedBanner, Text: err.Error()}, true, true)
+			}
+		}(streamer)
+	}
+	waiter.Wait()
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	for _, line := range lines {
+		writeLine(line, true, true)
+	}
+	if len(merr.Errors) == len(streamers) {
+		return merr.AsError()
+	}
+	return nil
+}
+
+// replayKubernetes writes the lines of the bundle recorded with --record to the given io.Writer output, like they were streamed
+//
+// The lines before since are skipped, the ones without time are kept
+func replayKubernetes(ctx context.Context, bundlePath string, since time.Time, output io.Writer, options *OutputOptions) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("kubernetes", "replay")
+
+	bundle, lines, err := kubectl.OpenBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	log.Infof("Replaying %d lines of %d streams recorded from %s to %s", len(lines), len(bundle.Streams), bundle.Start, bundle.End)
+	for _, line := range lines {
+		if !line.Time.IsZero() && line.Time.Before(since) {
+			continue
+		}
+		writeKubernetesLine(output, line, bundle.Prefix || bundle.Tagged, bundle.Tagged, options)
+	}
+	return nil
+}
+
+// writeKubernetesFailures writes a banner for each context or namespace that cannot be streamed
+func writeKubernetesFailures(output io.Writer, err error, options *OutputOptions) {
+	failures := []error{err}
+	if merr, ok := err.(*errors.MultiError); ok {
+		failures = merr.Errors
+	}
+	for _, failure := range failures {
+		writeKubernetesLine(output, kubectl.Line{Time: time.Now(), Banner: kubectl.FailedBanner, Text: failure.Error()}, true, true, options)
+	}
+}
+
+// NewEventLogEntry creates a new LogEntry from the given Kubernetes event line
+//
+// Warning events are at WARN level, the other events at INFO level.
+func NewEventLogEntry(line kubectl.Line) LogEntry {
+	event := line.Event
+	level := LogLevel(logger.INFO)
+	if event.Type == corev1.EventTypeWarning {
+		level = LogLevel(logger.WARN)
+	}
+	component := event.Source.Component
+	if len(component) == 0 {
+		component = event.ReportingController
+	}
+	entry := LogEntry{
+		Time:     line.Time,
+		Level:    level,
+		Hostname: line.Source.Node,
+		Name:     component,
+		Topic:    EventTopic,
+		Scope:    event.Reason,
+		Message:  event.Message,
+		Fields: map[string]any{
+			"object":    strings.ToLower(event.InvolvedObject.Kind) + "/" + event.InvolvedObject.Name,
+			"context":   line.Source.Context,
+			"namespace": event.InvolvedObject.Namespace,
+			"reason":    event.Reason,
+			"type":      event.Type,
+		},
+		Blobs: map[string]any{KubernetesBlob: kubernetesMetadata(line.Source)},
+	}
+	if len(line.Source.Container) > 0 {
+		entry.Fields["container"] = line.Source.Container
+	}
+	if event.Count > 1 {
+		entry.Fields["count"] = float64(event.Count)
+	}
+	return entry
+}
+
+// writeKubernetesLine writes the given line, prefixed with its source if prefix is set, or the banner of the line
+//
+// If tagged is set, the source contains the context and the namespace.
+// Events are written as JSON log entries, so they can be filtered like the logs
+func writeKubernetesLine(output io.Writer, line kubectl.Line, prefix, tagged bool, options *OutputOptions) {
+	if line.Event != nil {
+		if payload, err := json.Marshal(NewEventLogEntry(line)); err == nil {
+			_, _ = fmt.Fprintln(output, string(payload))
+		}
+		return
+	}
+	source := fmt.Sprintf("pod/%s/%s", line.Source.Pod, line.Source.Container)
+	if tagged {
+		source = fmt.Sprintf("%s/%s/%s", line.Source.Context, line.Source.Namespace, source)
+	}
+	var banner, color string
+
+	switch line.Banner {
+	case kubectl.AttachedBanner:
+		banner, color = "attached "+source, Green
+	case kubectl.DetachedBanner:
+		banner, color = "detached "+source, Yellow
+	case kubectl.SkippedBanner:
+		banner, color = "cannot attach "+source, Red
+	case kubectl.RestartedBanner:
+		banner, color = "restarted "+source, Yellow
+	case kubectl.FailedBanner:
+		banner, color = "cannot stream", Red
+		if len(line.Source.Context) > 0 || len(line.Source.Namespace) > 0 {
+			banner += " " + kubectl.Target{Context: line.Source.Context, Namespace: line.Source.Namespace}.String()
+		}
+	default:
+		text := withKubernetesMetadata(line.Text, line.Source)
+		if prefix {
+			_, _ = fmt.Fprintf(output, "[%s] %s\n", source, text)
+		} else {
+			_, _ = fmt.Fprintln(output, text)
+		}
+		return
+	}
+	if len(line.Text) > 0 {
+		banner += " (" + line.Text + ")"
+	}
+	if options.UseColors {
+		_, _ = fmt.Fprintf(output, "%s--- %s ---%s\n", color, banner, Reset)
+	} else {
+		_, _ = fmt.Fprintf(output, "--- %s ---\n", banner)
+	}
+}
+
+// kubernetesMetadata gets the metadata of the given source, with the pod labels configured in k8s.labels
+func kubernetesMetadata(source kubectl.Source) map[string]any {
+	metadata := map[string]any{}
+	for key, value := range map[string]string{"context": source.Context, "namespace": source.Namespace, "pod": source.Pod, "container": source.Container, "node": source.Node} {
+		if len(value) > 0 {
+			metadata[key] = value
+		}
+	}
+	labels := map[string]any{}
+	for _, name := range viper.GetStringSlice("k8s.labels") {
+		if value, found := source.Labels[name]; found {
+			labels[name] = value
+		}
+	}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	return metadata
+}
+
+// withKubernetesMetadata adds the metadata of the source to the given line if it is a JSON object
+//
+// The metadata is added after the timestamp written by --timestamps, if any.
+// The metadata is written first, so a k8s key already in the line wins
+func withKubernetesMetadata(text string, source kubectl.Source) string {
+	if timestamp, rest := SplitTimestampPrefix([]byte(text)); len(timestamp) > 0 {
+		return timestamp + " " + withKubernetesMetadata(string(rest), source)
+	}
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "{") || !strings.HasSuffix(trimmed, "}") {
+		return text
+	}
+	payload, err := json.Marshal(map[string]any{KubernetesBlob: kubernetesMetadata(source)})
+	if err != nil {
+		return text
+	}
+	if rest := strings.TrimSpace(trimmed[1:]); rest != "}" {
+		return string(payload[:len(payload)-1]) + "," + rest
+	}
+	return string(payload)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/kubectl"
+	"github.com/stretchr/testify/suite"
+)
+
+type KubernetesSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestKubernetesSuite(t *testing.T) {
+	suite.Run(t, new(KubernetesSuite))
+}
+
+func (suite *KubernetesSuite) SetupSuite() {
+	suite.Name = "Kubernetes"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+func (suite *KubernetesSuite) TestCanAddKubernetesMetadata() {
+	source := kubectl.Source{Context: "prod", Namespace: "shop", Pod: "api-1", Container: "main"}
+	var entry map[string]any
+
+	text := withKubernetesMetadata(`{"msg": "hello"}`, source)
+	suite.Require().NoError(json.Unmarshal([]byte(text), &entry))
+	suite.Assert().Equal("hello", entry["msg"])
+	suite.Assert().Equal("api-1", entry[KubernetesBlob].(map[string]any)["pod"])
+
+	suite.Assert().Equal("not json", withKubernetesMetadata("not json", source))
+	suite.Assert().Equal("2026-10-18T10:00:00Z not json", withKubernetesMetadata("2026-10-18T10:00:00Z not json", source))
+}
+
+func (suite *KubernetesSuite) TestCanAddKubernetesMetadataAfterTimestamp() {
+	source := kubectl.Source{Context: "prod", Namespace: "shop", Pod: "api-1", Container: "main"}
+	text := withKubernetesMetadata(`2026-10-18T10:00:00.123456789Z {"msg": "hello"}`, source)
+
+	timestamp, payload := SplitTimestampPrefix([]byte(text))
+	suite.Assert().Equal("2026-10-18T10:00:00.123456789Z", timestamp)
+	var entry map[string]any
+	suite.Require().NoError(json.Unmarshal(payload, &entry), "The timestamp should be kept before the JSON object")
+	suite.Assert().Equal("hello", entry["msg"])
+	suite.Assert().Equal("shop", entry[KubernetesBlob].(map[string]any)["namespace"])
+}
+
+func (suite *KubernetesSuite) TestCanWritePrefixedLineWithMetadata() {
+	var output bytes.Buffer
+	line := kubectl.Line{Source: kubectl.Source{Context: "prod", Namespace: "shop", Pod: "api-1", Container: "main"}, Text: `2026-10-18T10:00:00Z {"msg": "hello"}`}
+	writeKubernetesLine(&output, line, true, true, &OutputOptions{})
+
+	source, rest := SplitSourcePrefix(output.Bytes())
+	suite.Assert().Equal("prod/shop/pod/api-1/main", source)
+	timestamp, payload := SplitTimestampPrefix(bytes.TrimSpace(rest))
+	suite.Assert().Equal("2026-10-18T10:00:00Z", timestamp)
+	var entry map[string]any
+	suite.Require().NoError(json.Unmarshal(payload, &entry))
+	suite.Assert().Equal("main", entry[KubernetesBlob].(map[string]any)["container"])
+}
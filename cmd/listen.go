@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/listen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var listenCmd = &cobra.Command{
+	Use:   "listen [flags] <url>",
+	Short: "receive log entries from the network",
+	Long: `Receives log entries sent with a network protocol and shows them like the entries of a followed file, with the same filters and outputs.
+The protocol is given by the scheme of the URL:
+  fifo:///path            newline-delimited JSON or text entries written to a named pipe (created if needed)
+  forward://[host]:port   Fluentd and Fluent Bit events with the Fluent Forward protocol over TCP
+  loki://[host]:port      Loki pushes (JSON or snappy protobuf) posted to /loki/api/v1/push
+  otlp://[host]:port      OpenTelemetry logs over OTLP/HTTP (JSON or protobuf) posted to /v1/logs
+  syslog://[host]:port    syslog messages (RFC 5424 and RFC 3164) over UDP and TCP (syslog+udp:// or syslog+tcp:// for only one of them)
+  syslog:///path          syslog messages over a unix datagram socket (like /dev/log)
+  unix:///path            newline-delimited JSON or text entries from the processes connected to a unix socket
+Each entry is prefixed with its source (e.g. [syslog:10.0.0.1], [unix:api.test/4242]).`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: validListenArgs,
+	RunE:              runListenCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(listenCmd)
+}
+
+// validListenArgs completes the URL schemes of the listen command
+func validListenArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	schemes := []string{}
+	for _, scheme := range listen.Schemes() {
+		schemes = append(schemes, scheme+"://")
+	}
+	return schemes, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// runListenCommand executes the listen Command
+func runListenCommand(cmd *cobra.Command, args []string) (err error) {
+	log := logger.Must(logger.FromContext(cmd.Context())).Child("listen", "run")
+
+	if err = initializeOutputOptions(cmd); err != nil {
+		return err
+	}
+	CmdOptions.UsePager = false
+	viper.Set("follow", true) // the entries are shown as they arrive
+
+	listener, err := listen.New(args[0])
+	if err != nil {
+		log.Errorf("Failed to create listener for %s", args[0], err)
+		return err
+	}
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		log.Fatalf("Failed to create pipe: %s", err)
+		return err
+	}
+	defer func() { _ = pipeReader.Close() }()
+
+	go func() {
+		defer func() { _ = pipeWriter.Close() }()
+		// the listener must release its sockets when interrupted
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := listener.Listen(ctx, func(record listen.Record) { writeRecord(ctx, pipeWriter, record) }); err != nil {
+			log.Fatalf("Failed to listen on %s: %s", args[0], err)
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}()
+	return viewEntries(cmd, bufio.NewReader(pipeReader))
+}
+
+// writeRecord writes the given record as a JSON log entry prefixed with its source
+func writeRecord(ctx context.Context, output io.Writer, record listen.Record) {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "write")
+
+	payload, err := json.Marshal(record.Fields)
+	if err != nil {
+		log.Errorf("Failed to convert record from %s", record.Source, err)
+		return
+	}
+	if len(record.Source) > 0 {
+		_, _ = fmt.Fprintf(output, "[%s] %s\n", record.Source, payload)
+	} else {
+		_, _ = fmt.Fprintln(output, string(payload))
+	}
+}
@@ -0,0 +1,288 @@
+package listen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+)
+
+// ForwardListener receives the events of Fluentd and Fluent Bit with the Fluent Forward protocol over TCP
+//
+// The Message, Forward, PackedForward, and CompressedPackedForward modes are supported.
+// When the client asks for an acknowledgment (with the chunk option), it is sent once the events are handled.
+//
+// See https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1.5
+type ForwardListener struct {
+	Address string
+	lock    sync.Mutex
+}
+
+// forwardEvent is an event received with the Fluent Forward protocol
+type forwardEvent struct {
+	Time   time.Time
+	Record map[string]any
+}
+
+// NewForwardListener creates a new ForwardListener for the given URL
+func NewForwardListener(address *url.URL) (Listener, error) {
+	if len(address.Host) == 0 {
+		return nil, errors.ArgumentMissing.With("address")
+	}
+	return &ForwardListener{Address: address.Host}, nil
+}
+
+// Listen receives the Fluent Forward events and sends them to the handler until the context is done
+//
+// implements Listener
+func (listener *ForwardListener) Listen(ctx context.Context, handle func(record Record)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "forward")
+
+	tcpListener, err := net.Listen("tcp", listener.Address)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = tcpListener.Close() })
+	defer stop()
+	log.Infof("Listening to Fluent Forward events on %s", listener.Address)
+
+	for {
+		conn, err := tcpListener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		log.Debugf("Accepted forward connection from %s", conn.RemoteAddr())
+		go func() {
+			defer func() { _ = conn.Close() }()
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			defer stop()
+			if err := listener.readMessages(conn, handle); err != nil && ctx.Err() == nil {
+				log.Warnf("Forward connection from %s ended: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// readMessages reads the messages of a connection until it is closed
+//
+// Each message is an array: [tag, time, record, option] (Message), [tag, [[time, record], ...], option] (Forward),
+// or [tag, entries, option] where entries is a MessagePack stream of [time, record] (PackedForward)
+func (listener *ForwardListener) readMessages(conn net.Conn, handle func(record Record)) error {
+	decoder := newMsgpackDecoder(conn)
+	for {
+		value, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		message, ok := value.([]any)
+		if !ok || len(message) < 2 {
+			return errors.ArgumentInvalid.With("message", value)
+		}
+		tag, ok := forwardString(message[0])
+		if !ok {
+			return errors.ArgumentInvalid.With("tag", message[0])
+		}
+		var events []forwardEvent
+		var option any
+		switch entries := message[1].(type) {
+		case []any: // Forward
+			for _, entry := range entries {
+				if event, ok := newForwardEvent(entry); ok {
+					events = append(events, event)
+				}
+			}
+			if len(message) > 2 {
+				option = message[2]
+			}
+		case []byte, string: // PackedForward
+			if len(message) > 2 {
+				option = message[2]
+			}
+			if events, err = unpackForwardEvents(entries, option); err != nil {
+				return err
+			}
+		default: // Message
+			if len(message) < 3 {
+				return errors.ArgumentInvalid.With("message", value)
+			}
+			if event, ok := newForwardEvent([]any{message[1], message[2]}); ok {
+				events = append(events, event)
+			}
+			if len(message) > 3 {
+				option = message[3]
+			}
+		}
+		listener.emit(handle, tag, events)
+
+		if options, ok := option.(map[string]any); ok {
+			if chunk, ok := forwardString(options["chunk"]); ok && len(chunk) > 0 {
+				ack := appendMsgpackString(append([]byte{0x81}, 0xa3, 'a', 'c', 'k'), chunk)
+				if _, err := conn.Write(ack); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// emit sends the events to the handler, calls are serialized
+func (listener *ForwardListener) emit(handle func(record Record), tag string, events []forwardEvent) {
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	source := "forward:" + strings.NewReplacer(" ", "_", "]", "_").Replace(tag)
+	for _, event := range events {
+		handle(Record{Source: source, Fields: forwardFields(event)})
+	}
+}
+
+// unpackForwardEvents decodes the MessagePack stream of [time, record] entries of the PackedForward mode
+//
+// The stream is decompressed first when the option compressed is "gzip" (CompressedPackedForward)
+func unpackForwardEvents(entries any, option any) (events []forwardEvent, err error) {
+	var data []byte
+	switch entries := entries.(type) {
+	case []byte:
+		data = entries
+	case string:
+		data = []byte(entries)
+	}
+	var reader io.Reader = bytes.NewReader(data)
+	if options, ok := option.(map[string]any); ok {
+		if compressed, _ := forwardString(options["compressed"]); compressed == "gzip" {
+			gzipReader, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, err
+			}
+			defer func() { _ = gzipReader.Close() }()
+			reader = gzipReader
+		} else if len(compressed) > 0 {
+			return nil, errors.Unsupported.With("compression", compressed)
+		}
+	}
+	decoder := newMsgpackDecoder(reader)
+	for {
+		entry, err := decoder.Decode()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if event, ok := newForwardEvent(entry); ok {
+			events = append(events, event)
+		}
+	}
+}
+
+// newForwardEvent gets the event of a [time, record] entry
+//
+// With the Fluent Bit v2 event format, the time is [time, metadata]
+func newForwardEvent(value any) (forwardEvent, bool) {
+	entry, ok := value.([]any)
+	if !ok || len(entry) < 2 {
+		return forwardEvent{}, false
+	}
+	record, ok := entry[1].(map[string]any)
+	if !ok {
+		return forwardEvent{}, false
+	}
+	eventTime := entry[0]
+	if timeAndMetadata, ok := eventTime.([]any); ok && len(timeAndMetadata) > 0 {
+		eventTime = timeAndMetadata[0]
+	}
+	return forwardEvent{Time: forwardTime(eventTime), Record: record}, true
+}
+
+// forwardTime gets the time of an event: an EventTime extension (seconds and nanoseconds) or a number of seconds
+func forwardTime(value any) time.Time {
+	switch value := value.(type) {
+	case msgpackExt:
+		if value.Type == 0 && len(value.Data) == 8 {
+			return time.Unix(int64(binary.BigEndian.Uint32(value.Data[:4])), int64(binary.BigEndian.Uint32(value.Data[4:])))
+		}
+	case int64:
+		return time.Unix(value, 0)
+	case uint64:
+		return time.Unix(int64(value), 0)
+	case float64:
+		seconds, fraction := int64(value), value-float64(int64(value))
+		return time.Unix(seconds, int64(fraction*1e9))
+	}
+	return time.Now()
+}
+
+// forwardFields converts the record of an event into the fields of a bunyan entry
+//
+// When the record has no msg, its log or message (like the records of container logs) is used.
+// If it is a JSON object, it is parsed as a bunyan entry whose fields win over the record.
+// The time of the event is used when the record has none, and the level is INFO when the record has none.
+func forwardFields(event forwardEvent) map[string]any {
+	fields := make(map[string]any, len(event.Record)+2)
+	for key, value := range event.Record {
+		fields[key] = forwardValue(value)
+	}
+	if _, found := fields["msg"]; !found {
+		for _, key := range []string{"log", "message"} {
+			if text, ok := fields[key].(string); ok {
+				delete(fields, key)
+				setMessage(fields, strings.TrimRight(text, "\r\n"))
+				break
+			}
+		}
+	}
+	if _, found := fields["time"]; !found {
+		fields["time"] = event.Time.Format(time.RFC3339Nano)
+	}
+	if _, found := fields["level"]; !found {
+		fields["level"] = 30
+	}
+	return fields
+}
+
+// forwardValue converts a MessagePack value into a value that can be marshaled in JSON
+func forwardValue(value any) any {
+	switch value := value.(type) {
+	case []byte:
+		return string(value)
+	case msgpackExt:
+		if value.Type == 0 && len(value.Data) == 8 {
+			return forwardTime(value).Format(time.RFC3339Nano)
+		}
+		return value.Data
+	case []any:
+		for index, item := range value {
+			value[index] = forwardValue(item)
+		}
+		return value
+	case map[string]any:
+		for key, item := range value {
+			value[key] = forwardValue(item)
+		}
+		return value
+	}
+	return value
+}
+
+// forwardString gets a MessagePack str or bin as a string
+func forwardString(value any) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case []byte:
+		return string(value), true
+	}
+	return "", false
+}
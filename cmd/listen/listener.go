@@ -0,0 +1,234 @@
+package listen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Record is a log entry received by a Listener, as the fields of a bunyan entry (time, level, hostname, name, pid, msg, ...)
+type Record struct {
+	Source string // Where the record comes from (e.g. "syslog:10.0.0.1"), without spaces
+	Fields map[string]any
+}
+
+// Listener receives log records from a network protocol
+type Listener interface {
+	// Listen receives the records and sends them to the handler until the context is done
+	//
+	// The calls to handle are serialized
+	Listen(ctx context.Context, handle func(record Record)) error
+}
+
+// listeners are the Listener constructors by URL scheme
+var listeners = map[string]func(address *url.URL) (Listener, error){
+	"fifo":        NewUnixListener,
+	"forward":     NewForwardListener,
+	"loki":        NewLokiListener,
+	"otlp":        NewOTLPListener,
+	"syslog":      NewSyslogListener,
+	"syslog+tcp":  NewSyslogListener,
+	"syslog+udp":  NewSyslogListener,
+	"syslog+unix": NewSyslogListener,
+	"unix":        NewUnixListener,
+}
+
+// New creates a new Listener for the given URL, its scheme tells the protocol (e.g. syslog://:5514)
+func New(rawURL string) (Listener, error) {
+	address, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.ArgumentInvalid.With("url", rawURL)
+	}
+	if len(address.Scheme) == 0 {
+		return nil, errors.ArgumentMissing.With("scheme")
+	}
+	newListener, found := listeners[strings.ToLower(address.Scheme)]
+	if !found {
+		return nil, errors.Unsupported.With("scheme", address.Scheme)
+	}
+	return newListener(address)
+}
+
+// Schemes gets the supported URL schemes, sorted
+func Schemes() []string {
+	schemes := make([]string, 0, len(listeners))
+	for scheme := range listeners {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// serveHTTP serves the given handler on the address until the context is done
+func serveHTTP(ctx context.Context, address string, handler http.Handler) error {
+	server := &http.Server{Addr: address, Handler: handler, BaseContext: func(net.Listener) context.Context { return ctx }}
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// httpMaxBodySize is the largest body accepted by the HTTP listeners, compressed or not, to not run out of memory
+const httpMaxBodySize = 64 * 1024 * 1024
+
+// readBody reads the body of the request, decompressing it if needed
+//
+// If the body is larger than httpMaxBodySize, before or after decompression, errors.HTTPStatusRequestEntityTooLarge is returned
+func readBody(res http.ResponseWriter, req *http.Request) ([]byte, error) {
+	var reader io.Reader = http.MaxBytesReader(res, req.Body, httpMaxBodySize)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		defer func() { _ = gzipReader.Close() }()
+		reader = io.LimitReader(gzipReader, httpMaxBodySize+1)
+	}
+	var buffer bytes.Buffer
+	if _, err := buffer.ReadFrom(reader); err != nil {
+		return nil, bodyError(err)
+	}
+	if buffer.Len() > httpMaxBodySize {
+		return nil, errors.HTTPStatusRequestEntityTooLarge.With("body", buffer.Len())
+	}
+	return buffer.Bytes(), nil
+}
+
+// bodyError converts the error of http.MaxBytesReader into errors.HTTPStatusRequestEntityTooLarge
+func bodyError(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return errors.HTTPStatusRequestEntityTooLarge.With("body", maxBytesError.Limit)
+	}
+	return err
+}
+
+// bodyStatus gets the HTTP status of the error returned when reading or decoding a body
+func bodyStatus(err error) int {
+	if errors.Is(err, errors.HTTPStatusRequestEntityTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// readLine reads a line with its new line, a line longer than maxSize fails with errors.ArgumentInvalid
+//
+// At the end of the stream, the last line is returned with io.EOF
+func readLine(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	var line []byte
+	for {
+		slice, err := reader.ReadSlice('\n') // bounded by the size of the buffer
+		if len(line)+len(slice) > maxSize {
+			return nil, errors.ArgumentInvalid.With("line length", len(line)+len(slice))
+		}
+		line = append(line, slice...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return line, err
+		}
+	}
+}
+
+// removeSocket removes the unix socket left at the given path by a previous listener
+//
+// Nothing is removed if there is nothing at the path, and anything else than a socket is left as is and fails with errors.ArgumentInvalid
+func removeSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.ArgumentInvalid.With("socket", path)
+	}
+	return os.Remove(path)
+}
+
+// remoteHost gets the host of the given remote address
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// setMessage sets the msg of the fields
+//
+// If the message is a JSON object, it is parsed as a bunyan entry whose fields win over the given ones
+func setMessage(fields map[string]any, message string) {
+	fields["msg"] = message
+	if trimmed := strings.TrimSpace(message); strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(trimmed), &payload); err == nil {
+			if _, found := payload["msg"]; !found {
+				delete(fields, "msg")
+			}
+			for key, value := range payload {
+				fields[key] = value
+			}
+		}
+	}
+}
+
+// protoValue is the value of a protobuf field, bytes for length-delimited fields, number for the others
+type protoValue struct {
+	bytes  []byte
+	number uint64
+}
+
+// decodeProtobuf calls field for each field of the given protobuf message, groups are skipped
+func decodeProtobuf(payload []byte, field func(number protowire.Number, value protoValue) error) error {
+	for len(payload) > 0 {
+		number, kind, length := protowire.ConsumeTag(payload)
+		if length < 0 {
+			return protowire.ParseError(length)
+		}
+		payload = payload[length:]
+
+		var value protoValue
+		switch kind {
+		case protowire.VarintType:
+			value.number, length = protowire.ConsumeVarint(payload)
+		case protowire.Fixed32Type:
+			var fixed uint32
+			fixed, length = protowire.ConsumeFixed32(payload)
+			value.number = uint64(fixed)
+		case protowire.Fixed64Type:
+			value.number, length = protowire.ConsumeFixed64(payload)
+		case protowire.BytesType:
+			value.bytes, length = protowire.ConsumeBytes(payload)
+		default:
+			length = protowire.ConsumeFieldValue(number, kind, payload)
+		}
+		if length < 0 {
+			return protowire.ParseError(length)
+		}
+		payload = payload[length:]
+		if kind == protowire.StartGroupType {
+			continue
+		}
+		if err := field(number, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package listen
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// LokiListener receives the log lines pushed to the Loki push API, encoded in JSON or snappy compressed protobuf
+//
+// The lines are posted to /loki/api/v1/push, like Promtail, Grafana Alloy, and the Loki clients do.
+type LokiListener struct {
+	Address string
+	lock    sync.Mutex
+}
+
+// LokiPushPath is the path of the Loki push API
+const LokiPushPath = "/loki/api/v1/push"
+
+// LokiPushRequest is the payload of the Loki push API
+type LokiPushRequest struct {
+	Streams []LokiStream `json:"streams"`
+}
+
+// LokiStream is a stream of log lines with its labels, as pushed to or queried from Loki
+type LokiStream struct {
+	Labels map[string]string `json:"stream"`
+	Values []LokiEntry       `json:"values"`
+}
+
+// LokiEntry is a log line of a LokiStream
+//
+// In JSON, it is an array: ["<unix epoch in nanoseconds>", "<line>", {<structured metadata>}]
+type LokiEntry struct {
+	Time     time.Time
+	Line     string
+	Metadata map[string]string
+}
+
+// lokiLevels are the level label values that are not bunyan level names
+var lokiLevels = map[string]string{
+	"warning":  "warn",
+	"err":      "error",
+	"critical": "fatal",
+	"crit":     "fatal",
+	"dbug":     "debug",
+}
+
+// NewLokiListener creates a new LokiListener for the given URL
+func NewLokiListener(address *url.URL) (Listener, error) {
+	if len(address.Host) == 0 {
+		return nil, errors.ArgumentMissing.With("address")
+	}
+	return &LokiListener{Address: address.Host}, nil
+}
+
+// Listen receives the pushed log lines and sends them to the handler until the context is done
+//
+// implements Listener
+func (listener *LokiListener) Listen(ctx context.Context, handle func(record Record)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "loki")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+LokiPushPath, func(res http.ResponseWriter, req *http.Request) {
+		listener.servePush(ctx, res, req, handle)
+	})
+	log.Infof("Listening to Loki pushes on %s%s", listener.Address, LokiPushPath)
+	return serveHTTP(ctx, listener.Address, mux)
+}
+
+// servePush converts the pushed streams into records
+func (listener *LokiListener) servePush(ctx context.Context, res http.ResponseWriter, req *http.Request, handle func(record Record)) {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "loki")
+
+	payload, err := readBody(res, req)
+	if err != nil {
+		log.Errorf("Failed to read the push request from %s", req.RemoteAddr, err)
+		http.Error(res, err.Error(), bodyStatus(err))
+		return
+	}
+	var request LokiPushRequest
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if contentType == "application/x-protobuf" {
+		if size, lenErr := snappy.DecodedLen(payload); lenErr != nil {
+			err = lenErr
+		} else if size > httpMaxBodySize {
+			err = errors.HTTPStatusRequestEntityTooLarge.With("body", size)
+		} else if payload, err = snappy.Decode(nil, payload); err == nil {
+			err = request.unmarshalProtobuf(payload)
+		}
+	} else {
+		err = json.Unmarshal(payload, &request)
+	}
+	if err != nil {
+		log.Errorf("Failed to decode the push request from %s", req.RemoteAddr, err)
+		http.Error(res, err.Error(), bodyStatus(err))
+		return
+	}
+
+	listener.lock.Lock()
+	for _, stream := range request.Streams {
+		for _, record := range stream.Records() {
+			handle(record)
+		}
+	}
+	listener.lock.Unlock()
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// Records converts the lines of the stream into records
+//
+// The source of the records is made of the labels of the stream (e.g. loki:app=api,namespace=shop).
+// If a line is a JSON object, it is parsed as a bunyan entry, otherwise it becomes the msg.
+// The structured metadata become fields, and the level label (or level, detected_level metadata) is used when the line has no level.
+func (stream LokiStream) Records() []Record {
+	source := stream.Source()
+	records := make([]Record, 0, len(stream.Values))
+	for _, entry := range stream.Values {
+		fields := map[string]any{"time": entry.Time.UTC().Format(time.RFC3339Nano)}
+		for key, value := range entry.Metadata {
+			fields[key] = value
+		}
+		setMessage(fields, strings.TrimRight(entry.Line, "\r\n"))
+		if _, found := fields["level"]; !found {
+			fields["level"] = 30
+		levels:
+			for _, labels := range []map[string]string{entry.Metadata, stream.Labels} {
+				for _, name := range []string{"level", "detected_level"} {
+					if level, found := labels[name]; found {
+						fields["level"] = lokiLevel(level)
+						break levels
+					}
+				}
+			}
+		}
+		records = append(records, Record{Source: source, Fields: fields})
+	}
+	return records
+}
+
+// Source gets the source of the stream: its labels, sorted by name
+func (stream LokiStream) Source() string {
+	names := make([]string, 0, len(stream.Labels))
+	for name := range stream.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	labels := make([]string, 0, len(names))
+	for _, name := range names {
+		labels = append(labels, name+"="+stream.Labels[name])
+	}
+	return "loki:" + strings.NewReplacer(" ", "_", "]", "_").Replace(strings.Join(labels, ","))
+}
+
+// lokiLevel gets the bunyan level name of a level label
+func lokiLevel(level string) string {
+	level = strings.ToLower(level)
+	if name, found := lokiLevels[level]; found {
+		return name
+	}
+	return level
+}
+
+// UnmarshalJSON decodes the JSON array of a LokiEntry
+//
+// implements json.Unmarshaler
+func (entry *LokiEntry) UnmarshalJSON(payload []byte) error {
+	var values []json.RawMessage
+	if err := json.Unmarshal(payload, &values); err != nil {
+		return errors.JSONUnmarshalError.Wrap(err)
+	}
+	if len(values) < 2 {
+		return errors.ArgumentInvalid.With("entry", string(payload))
+	}
+	var timestamp string
+	if err := json.Unmarshal(values[0], &timestamp); err != nil {
+		return errors.JSONUnmarshalError.Wrap(err)
+	}
+	nanoseconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.ArgumentInvalid.With("timestamp", timestamp)
+	}
+	entry.Time = time.Unix(0, nanoseconds)
+	if err := json.Unmarshal(values[1], &entry.Line); err != nil {
+		return errors.JSONUnmarshalError.Wrap(err)
+	}
+	if len(values) > 2 {
+		if err := json.Unmarshal(values[2], &entry.Metadata); err != nil {
+			return errors.JSONUnmarshalError.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// unmarshalProtobuf decodes a logproto.PushRequest
+func (request *LokiPushRequest) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		if number == 1 {
+			var stream LokiStream
+			if err := stream.unmarshalProtobuf(value.bytes); err != nil {
+				return err
+			}
+			request.Streams = append(request.Streams, stream)
+		}
+		return nil
+	})
+}
+
+// unmarshalProtobuf decodes a logproto.StreamAdapter, its labels are formatted like {name="value", ...}
+func (stream *LokiStream) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1:
+			labels, err := ParseLokiLabels(string(value.bytes))
+			if err != nil {
+				return err
+			}
+			stream.Labels = labels
+		case 2:
+			var entry LokiEntry
+			if err := entry.unmarshalProtobuf(value.bytes); err != nil {
+				return err
+			}
+			stream.Values = append(stream.Values, entry)
+		}
+		return nil
+	})
+}
+
+// unmarshalProtobuf decodes a logproto.EntryAdapter
+func (entry *LokiEntry) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1: // google.protobuf.Timestamp
+			var seconds, nanoseconds int64
+			err := decodeProtobuf(value.bytes, func(number protowire.Number, value protoValue) error {
+				switch number {
+				case 1:
+					seconds = int64(value.number)
+				case 2:
+					nanoseconds = int64(value.number)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			entry.Time = time.Unix(seconds, nanoseconds)
+		case 2:
+			entry.Line = string(value.bytes)
+		case 3: // LabelPairAdapter
+			var name, label string
+			err := decodeProtobuf(value.bytes, func(number protowire.Number, value protoValue) error {
+				switch number {
+				case 1:
+					name = string(value.bytes)
+				case 2:
+					label = string(value.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if entry.Metadata == nil {
+				entry.Metadata = map[string]string{}
+			}
+			entry.Metadata[name] = label
+		}
+		return nil
+	})
+}
+
+// ParseLokiLabels parses labels formatted like Prometheus: {name="value", other="value"}
+func ParseLokiLabels(text string) (map[string]string, error) {
+	labels := map[string]string{}
+	rest := strings.TrimSpace(text)
+	if !strings.HasPrefix(rest, "{") || !strings.HasSuffix(rest, "}") {
+		return nil, errors.ArgumentInvalid.With("labels", text)
+	}
+	rest = strings.TrimSpace(rest[1 : len(rest)-1])
+	for len(rest) > 0 {
+		name, value, found := strings.Cut(rest, "=")
+		if !found {
+			return nil, errors.ArgumentInvalid.With("labels", text)
+		}
+		value = strings.TrimSpace(value)
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return nil, errors.ArgumentInvalid.With("labels", text)
+		}
+		if labels[strings.TrimSpace(name)], err = strconv.Unquote(quoted); err != nil {
+			return nil, errors.ArgumentInvalid.With("labels", text)
+		}
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value[len(quoted):]), ","))
+	}
+	return labels, nil
+}
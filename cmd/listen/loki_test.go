@@ -0,0 +1,126 @@
+package listen
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type LokiSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestLokiSuite(t *testing.T) {
+	suite.Run(t, new(LokiSuite))
+}
+
+func (suite *LokiSuite) SetupSuite() {
+	suite.Name = "Loki"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// push posts the given payload to a LokiListener and returns the status and the received records
+func (suite *LokiSuite) push(contentType string, payload []byte) (int, []Record) {
+	listener := &LokiListener{}
+	records := []Record{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		listener.servePush(suite.ctx, res, req, func(record Record) { records = append(records, record) })
+	}))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+LokiPushPath, contentType, bytes.NewReader(payload))
+	suite.Require().NoError(err)
+	defer func() { _ = res.Body.Close() }()
+	return res.StatusCode, records
+}
+
+func (suite *LokiSuite) TestCanParseLokiLabels() {
+	labels, err := ParseLokiLabels(`{app="api", namespace="shop" , msg="a \"quoted\", value"}`)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[string]string{"app": "api", "namespace": "shop", "msg": `a "quoted", value`}, labels)
+
+	labels, err = ParseLokiLabels(" {} ")
+	suite.Require().NoError(err)
+	suite.Assert().Empty(labels)
+
+	for _, text := range []string{`app="api"`, `{app}`, `{app=api}`, `{app="api}`} {
+		_, err = ParseLokiLabels(text)
+		suite.Assert().ErrorIs(err, errors.ArgumentInvalid, "%s should be invalid", text)
+	}
+}
+
+func (suite *LokiSuite) TestCanReceiveJSONPush() {
+	status, records := suite.push("application/json", []byte(`{"streams": [{
+		"stream": {"namespace": "shop", "app": "api", "level": "warning"},
+		"values": [
+			["1700000000000000000", "plain line"],
+			["1700000001000000000", "{\"level\": 50, \"msg\": \"json line\"}", {"trace_id": "abc"}]
+		]
+	}]}`))
+	suite.Require().Equal(http.StatusNoContent, status)
+	suite.Require().Len(records, 2)
+	suite.Assert().Equal("loki:app=api,level=warning,namespace=shop", records[0].Source)
+	suite.Assert().Equal("plain line", records[0].Fields["msg"])
+	suite.Assert().Equal("warn", records[0].Fields["level"], "The level label should give the level")
+	suite.Assert().Equal(time.Unix(1700000000, 0).UTC().Format(time.RFC3339Nano), records[0].Fields["time"])
+	suite.Assert().Equal("json line", records[1].Fields["msg"])
+	suite.Assert().Equal(float64(50), records[1].Fields["level"], "The level of the line should win")
+	suite.Assert().Equal("abc", records[1].Fields["trace_id"])
+}
+
+func (suite *LokiSuite) TestCanReceiveSnappyProtobufPush() {
+	var timestamp, metadata, entry, stream, request []byte
+	timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, 1700000000)
+	timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, 500)
+	metadata = protowire.AppendTag(metadata, 1, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, "detected_level")
+	metadata = protowire.AppendTag(metadata, 2, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, "error")
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, timestamp)
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, "protobuf line\n")
+	entry = protowire.AppendTag(entry, 3, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, metadata)
+	stream = protowire.AppendTag(stream, 1, protowire.BytesType)
+	stream = protowire.AppendString(stream, `{app="api", pod="api-1"}`)
+	stream = protowire.AppendTag(stream, 2, protowire.BytesType)
+	stream = protowire.AppendBytes(stream, entry)
+	request = protowire.AppendTag(request, 1, protowire.BytesType)
+	request = protowire.AppendBytes(request, stream)
+
+	status, records := suite.push("application/x-protobuf", snappy.Encode(nil, request))
+	suite.Require().Equal(http.StatusNoContent, status)
+	suite.Require().Len(records, 1)
+	suite.Assert().Equal("loki:app=api,pod=api-1", records[0].Source)
+	suite.Assert().Equal("protobuf line", records[0].Fields["msg"])
+	suite.Assert().Equal("error", records[0].Fields["level"])
+	suite.Assert().Equal("error", records[0].Fields["detected_level"])
+	suite.Assert().Equal(time.Unix(1700000000, 500).UTC().Format(time.RFC3339Nano), records[0].Fields["time"])
+}
+
+func (suite *LokiSuite) TestShouldRejectInvalidPush() {
+	status, records := suite.push("application/json", []byte(`{"streams": [{"values": [["not a time", "line"]]}]}`))
+	suite.Assert().Equal(http.StatusBadRequest, status)
+	suite.Assert().Empty(records)
+
+	status, _ = suite.push("application/x-protobuf", []byte("not snappy"))
+	suite.Assert().Equal(http.StatusBadRequest, status)
+
+	tooLarge := protowire.AppendVarint(nil, httpMaxBodySize+1) // the decoded length of a snappy block comes first
+	status, _ = suite.push("application/x-protobuf", append(tooLarge, 0))
+	suite.Assert().Equal(http.StatusRequestEntityTooLarge, status)
+}
@@ -0,0 +1,257 @@
+package listen
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/gildas/go-errors"
+)
+
+// msgpackDecoder decodes the MessagePack values of a stream
+//
+// The values are decoded as nil, bool, int64, uint64, float64, string, []byte (bin), []any, map[string]any, or msgpackExt
+type msgpackDecoder struct {
+	reader *bufio.Reader
+	depth  int // the nesting of the array or map being decoded
+}
+
+// msgpackExt is a MessagePack extension value
+type msgpackExt struct {
+	Type int8
+	Data []byte
+}
+
+// msgpackMaxSize is the largest string, binary, array, or map accepted, to not allocate garbage lengths
+const msgpackMaxSize = 64 * 1024 * 1024
+
+// msgpackMaxDepth is the maximum nesting of arrays and maps, to not exhaust the stack
+const msgpackMaxDepth = 100
+
+// newMsgpackDecoder creates a new msgpackDecoder reading from the given reader
+func newMsgpackDecoder(reader io.Reader) *msgpackDecoder {
+	if buffered, ok := reader.(*bufio.Reader); ok {
+		return &msgpackDecoder{reader: buffered}
+	}
+	return &msgpackDecoder{reader: bufio.NewReader(reader)}
+}
+
+// Decode decodes the next value of the stream, io.EOF is returned at the end of the stream
+func (decoder *msgpackDecoder) Decode() (any, error) {
+	code, err := decoder.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case code <= 0x7f: // positive fixint
+		return int64(code), nil
+	case code >= 0xe0: // negative fixint
+		return int64(int8(code)), nil
+	case code&0xf0 == 0x80: // fixmap
+		return decoder.decodeMap(int(code & 0x0f))
+	case code&0xf0 == 0x90: // fixarray
+		return decoder.decodeArray(int(code & 0x0f))
+	case code&0xe0 == 0xa0: // fixstr
+		data, err := decoder.read(int(code & 0x1f))
+		return string(data), err
+	}
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8, 16, 32
+		size, err := decoder.readSize(1 << (code - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.read(size)
+	case 0xc7, 0xc8, 0xc9: // ext 8, 16, 32
+		size, err := decoder.readSize(1 << (code - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.decodeExt(size)
+	case 0xca:
+		data, err := decoder.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case 0xcb:
+		data, err := decoder.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint 8, 16, 32, 64
+		value, err := decoder.readUint(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if value > math.MaxInt64 {
+			return value, nil
+		}
+		return int64(value), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int 8, 16, 32, 64
+		width := 1 << (code - 0xd0)
+		value, err := decoder.readUint(width)
+		if err != nil {
+			return nil, err
+		}
+		shift := 64 - 8*width
+		return int64(value<<shift) >> shift, nil // sign extension
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8: // fixext 1, 2, 4, 8, 16
+		return decoder.decodeExt(1 << (code - 0xd4))
+	case 0xd9, 0xda, 0xdb: // str 8, 16, 32
+		size, err := decoder.readSize(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		data, err := decoder.read(size)
+		return string(data), err
+	case 0xdc, 0xdd: // array 16, 32
+		size, err := decoder.readSize(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.decodeArray(size)
+	case 0xde, 0xdf: // map 16, 32
+		size, err := decoder.readSize(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.decodeMap(size)
+	}
+	return nil, errors.Unsupported.With("msgpack type", fmt.Sprintf("0x%02x", code))
+}
+
+// decodeArray decodes the given number of values
+func (decoder *msgpackDecoder) decodeArray(size int) ([]any, error) {
+	if err := decoder.nest(); err != nil {
+		return nil, err
+	}
+	defer decoder.unnest()
+	values := make([]any, 0, min(size, 1024))
+	for range size {
+		value, err := decoder.Decode()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// decodeMap decodes the given number of key/value pairs, the keys that are not strings are formatted as strings
+func (decoder *msgpackDecoder) decodeMap(size int) (map[string]any, error) {
+	if err := decoder.nest(); err != nil {
+		return nil, err
+	}
+	defer decoder.unnest()
+	values := make(map[string]any, min(size, 1024))
+	for range size {
+		key, err := decoder.Decode()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		value, err := decoder.Decode()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		switch key := key.(type) {
+		case string:
+			values[key] = value
+		case []byte:
+			values[string(key)] = value
+		default:
+			values[fmt.Sprint(key)] = value
+		}
+	}
+	return values, nil
+}
+
+// nest enters an array or a map, nesting past msgpackMaxDepth fails with errors.ArgumentInvalid
+func (decoder *msgpackDecoder) nest() error {
+	if decoder.depth >= msgpackMaxDepth {
+		return errors.ArgumentInvalid.With("msgpack depth", decoder.depth+1)
+	}
+	decoder.depth++
+	return nil
+}
+
+// unnest leaves an array or a map
+func (decoder *msgpackDecoder) unnest() {
+	decoder.depth--
+}
+
+// decodeExt decodes the type and the data of an extension value
+func (decoder *msgpackDecoder) decodeExt(size int) (msgpackExt, error) {
+	extType, err := decoder.reader.ReadByte()
+	if err != nil {
+		return msgpackExt{}, unexpectedEOF(err)
+	}
+	data, err := decoder.read(size)
+	return msgpackExt{Type: int8(extType), Data: data}, err
+}
+
+// readUint reads a big endian unsigned integer of the given width in bytes
+func (decoder *msgpackDecoder) readUint(width int) (uint64, error) {
+	data, err := decoder.read(width)
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+// readSize reads the size of a string, binary, extension, array, or map
+func (decoder *msgpackDecoder) readSize(width int) (int, error) {
+	size, err := decoder.readUint(width)
+	if err != nil {
+		return 0, err
+	}
+	if size > msgpackMaxSize {
+		return 0, errors.ArgumentInvalid.With("msgpack size", size)
+	}
+	return int(size), nil
+}
+
+// read reads exactly size bytes
+func (decoder *msgpackDecoder) read(size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(decoder.reader, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return data, nil
+}
+
+// unexpectedEOF tells a stream that ends in the middle of a value from a stream that ends between values
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// appendMsgpackString appends the MessagePack encoding of the given string
+func appendMsgpackString(buffer []byte, value string) []byte {
+	switch size := len(value); {
+	case size < 32:
+		buffer = append(buffer, 0xa0|byte(size))
+	case size <= math.MaxUint8:
+		buffer = append(buffer, 0xd9, byte(size))
+	case size <= math.MaxUint16:
+		buffer = binary.BigEndian.AppendUint16(append(buffer, 0xda), uint16(size))
+	default:
+		buffer = binary.BigEndian.AppendUint32(append(buffer, 0xdb), uint32(size))
+	}
+	return append(buffer, value...)
+}
@@ -0,0 +1,125 @@
+package listen
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type MsgpackSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestMsgpackSuite(t *testing.T) {
+	suite.Run(t, new(MsgpackSuite))
+}
+
+func (suite *MsgpackSuite) SetupSuite() {
+	suite.Name = "Msgpack"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// nestedMsgpackArrays encodes a nil nested in the given number of arrays
+func nestedMsgpackArrays(depth int) []byte {
+	return append(bytes.Repeat([]byte{0x91}, depth), 0xc0)
+}
+
+func (suite *MsgpackSuite) TestCanDecodeValues() {
+	tests := []struct {
+		name     string
+		payload  []byte
+		expected any
+	}{
+		{"nil", []byte{0xc0}, nil},
+		{"true", []byte{0xc3}, true},
+		{"positive fixint", []byte{0x2a}, int64(42)},
+		{"negative fixint", []byte{0xff}, int64(-1)},
+		{"int 16", []byte{0xd1, 0xff, 0x00}, int64(-256)},
+		{"uint 64", []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, uint64(math.MaxUint64)},
+		{"float 32", []byte{0xca, 0x3f, 0x00, 0x00, 0x00}, float64(0.5)},
+		{"float 64", []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, 1.5},
+		{"str 8", appendMsgpackString(nil, strings.Repeat("a", 40)), strings.Repeat("a", 40)},
+		{"bin 8", []byte{0xc4, 0x02, 0x01, 0x02}, []byte{1, 2}},
+		{"fixext 4", []byte{0xd6, 0x00, 0x01, 0x02, 0x03, 0x04}, msgpackExt{Type: 0, Data: []byte{1, 2, 3, 4}}},
+		{"array 16", []byte{0xdc, 0x00, 0x02, 0x01, 0xa1, 'b'}, []any{int64(1), "b"}},
+		{"fixmap", []byte{0x82, 0xa3, 'm', 's', 'g', 0xa2, 'h', 'i', 0x01, 0xc2}, map[string]any{"msg": "hi", "1": false}},
+	}
+	for _, test := range tests {
+		suite.Run(test.name, func() {
+			value, err := newMsgpackDecoder(bytes.NewReader(test.payload)).Decode()
+			suite.Require().NoError(err)
+			suite.Assert().Equal(test.expected, value)
+		})
+	}
+}
+
+func (suite *MsgpackSuite) TestShouldFailWithTruncatedValues() {
+	decoder := newMsgpackDecoder(bytes.NewReader(nil))
+	_, err := decoder.Decode()
+	suite.Assert().ErrorIs(err, io.EOF, "An empty stream should end between values")
+
+	for name, payload := range map[string][]byte{
+		"str":      {0xa5, 'a', 'b'},
+		"uint 32":  {0xce, 0x00, 0x01},
+		"str size": {0xda, 0x01},
+		"array":    {0x92, 0x01},
+		"map key":  {0x81},
+		"map":      {0x81, 0xa1, 'k'},
+		"ext type": {0xd4},
+	} {
+		_, err := newMsgpackDecoder(bytes.NewReader(payload)).Decode()
+		suite.Assert().ErrorIs(err, io.ErrUnexpectedEOF, name)
+	}
+}
+
+func (suite *MsgpackSuite) TestShouldRejectOversizedValues() {
+	for name, payload := range map[string][]byte{
+		"str 32":   {0xdb, 0xff, 0xff, 0xff, 0xff},
+		"bin 32":   {0xc6, 0x04, 0x00, 0x00, 0x01},
+		"array 32": {0xdd, 0xff, 0xff, 0xff, 0xff},
+		"map 32":   {0xdf, 0x10, 0x00, 0x00, 0x00},
+		"ext 32":   {0xc9, 0x7f, 0xff, 0xff, 0xff, 0x01},
+	} {
+		_, err := newMsgpackDecoder(bytes.NewReader(payload)).Decode()
+		suite.Assert().ErrorIs(err, errors.ArgumentInvalid, name)
+	}
+
+	_, err := newMsgpackDecoder(bytes.NewReader([]byte{0xc1})).Decode()
+	suite.Assert().ErrorIs(err, errors.Unsupported, "0xc1 is never used")
+}
+
+func (suite *MsgpackSuite) TestShouldRejectTooDeeplyNestedValues() {
+	value, err := newMsgpackDecoder(bytes.NewReader(nestedMsgpackArrays(msgpackMaxDepth))).Decode()
+	suite.Require().NoError(err)
+	for range msgpackMaxDepth {
+		suite.Require().IsType([]any{}, value)
+		value = value.([]any)[0]
+	}
+	suite.Assert().Nil(value)
+
+	_, err = newMsgpackDecoder(bytes.NewReader(nestedMsgpackArrays(msgpackMaxDepth + 1))).Decode()
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+
+	nestedMaps := append(bytes.Repeat([]byte{0x81, 0xa1, 'k'}, msgpackMaxDepth+1), 0xc0)
+	_, err = newMsgpackDecoder(bytes.NewReader(nestedMaps)).Decode()
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+
+	// the depth is not carried over to the next values of the stream
+	stream := append(nestedMsgpackArrays(msgpackMaxDepth), nestedMsgpackArrays(msgpackMaxDepth)...)
+	decoder := newMsgpackDecoder(bytes.NewReader(stream))
+	for range 2 {
+		_, err = decoder.Decode()
+		suite.Require().NoError(err)
+	}
+	_, err = decoder.Decode()
+	suite.Assert().ErrorIs(err, io.EOF)
+}
@@ -0,0 +1,417 @@
+package listen
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLPListener receives OpenTelemetry logs over OTLP/HTTP, encoded in JSON or protobuf
+//
+// The logs are posted to /v1/logs, like OpenTelemetry SDKs and collectors do with the otlphttp exporter.
+type OTLPListener struct {
+	Address string
+	lock    sync.Mutex
+}
+
+// OTLPLogsPath is the path the OTLP/HTTP exporters post their logs to
+const OTLPLogsPath = "/v1/logs"
+
+// otlpRequest is an ExportLogsServiceRequest
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         otlpInteger    `json:"timeUnixNano"`
+	ObservedTimeUnixNano otlpInteger    `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"` // hexadecimal
+	SpanID               string         `json:"spanId"`  // hexadecimal
+	EventName            string         `json:"eventName"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string      `json:"stringValue,omitempty"`
+	BoolValue   *bool        `json:"boolValue,omitempty"`
+	IntValue    *otlpInteger `json:"intValue,omitempty"`
+	DoubleValue *float64     `json:"doubleValue,omitempty"`
+	ArrayValue  *struct {
+		Values []otlpAnyValue `json:"values"`
+	} `json:"arrayValue,omitempty"`
+	KvlistValue *struct {
+		Values []otlpKeyValue `json:"values"`
+	} `json:"kvlistValue,omitempty"`
+	BytesValue *string `json:"bytesValue,omitempty"` // base64
+}
+
+// otlpInteger is a 64-bit integer, OTLP/JSON encodes them as strings or numbers
+type otlpInteger int64
+
+// otlpMaxDepth is the maximum nesting of the array and kvlist values of a protobuf payload
+const otlpMaxDepth = 100
+
+// NewOTLPListener creates a new OTLPListener for the given URL
+func NewOTLPListener(address *url.URL) (Listener, error) {
+	if len(address.Host) == 0 {
+		return nil, errors.ArgumentMissing.With("address")
+	}
+	return &OTLPListener{Address: address.Host}, nil
+}
+
+// Listen receives the OTLP logs and sends them to the handler until the context is done
+//
+// implements Listener
+func (listener *OTLPListener) Listen(ctx context.Context, handle func(record Record)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "otlp")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+OTLPLogsPath, func(res http.ResponseWriter, req *http.Request) {
+		listener.serveLogs(ctx, res, req, handle)
+	})
+	log.Infof("Listening to OTLP/HTTP logs on %s%s", listener.Address, OTLPLogsPath)
+	return serveHTTP(ctx, listener.Address, mux)
+}
+
+// serveLogs converts the posted ExportLogsServiceRequest into records
+func (listener *OTLPListener) serveLogs(ctx context.Context, res http.ResponseWriter, req *http.Request, handle func(record Record)) {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "otlp")
+
+	payload, err := readBody(res, req)
+	if err != nil {
+		log.Errorf("Failed to read OTLP request from %s", req.RemoteAddr, err)
+		http.Error(res, err.Error(), bodyStatus(err))
+		return
+	}
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+
+	var request otlpRequest
+	if contentType == "application/json" {
+		err = json.Unmarshal(payload, &request)
+	} else {
+		err = request.unmarshalProtobuf(payload)
+	}
+	if err != nil {
+		log.Errorf("Failed to decode OTLP request from %s", req.RemoteAddr, err)
+		http.Error(res, err.Error(), bodyStatus(err))
+		return
+	}
+
+	source := "otlp:" + remoteHost(req.RemoteAddr)
+	listener.lock.Lock()
+	for _, resourceLogs := range request.ResourceLogs {
+		for _, scopeLogs := range resourceLogs.ScopeLogs {
+			for _, logRecord := range scopeLogs.LogRecords {
+				handle(Record{Source: source, Fields: logRecord.fields(resourceLogs, scopeLogs)})
+			}
+		}
+	}
+	listener.lock.Unlock()
+
+	// the response is an empty ExportLogsServiceResponse
+	if contentType == "application/json" {
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte("{}"))
+	} else {
+		res.Header().Set("Content-Type", "application/x-protobuf")
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+// fields converts the log record into the fields of a bunyan entry
+//
+// The severity becomes the level, the body the msg, and the attributes the fields.
+// The resource attributes host.name, service.name, and process.pid become the hostname, name, and pid, the other ones go in the resource field.
+func (logRecord otlpLogRecord) fields(resourceLogs otlpResourceLogs, scopeLogs otlpScopeLogs) map[string]any {
+	fields := map[string]any{"level": 30}
+
+	timestamp := time.Now()
+	if logRecord.TimeUnixNano > 0 {
+		timestamp = time.Unix(0, int64(logRecord.TimeUnixNano))
+	} else if logRecord.ObservedTimeUnixNano > 0 {
+		timestamp = time.Unix(0, int64(logRecord.ObservedTimeUnixNano))
+	}
+	fields["time"] = timestamp.UTC().Format(time.RFC3339Nano)
+
+	resource := map[string]any{}
+	for _, attribute := range resourceLogs.Resource.Attributes {
+		switch value := attribute.Value.value(); attribute.Key {
+		case "host.name":
+			fields["hostname"] = value
+		case "service.name":
+			fields["name"] = value
+		case "process.pid":
+			fields["pid"] = value
+		default:
+			resource[attribute.Key] = value
+		}
+	}
+	if len(resource) > 0 {
+		fields["resource"] = resource
+	}
+	if len(scopeLogs.Scope.Name) > 0 {
+		fields["otel.scope"] = scopeLogs.Scope.Name
+	}
+	for _, attribute := range logRecord.Attributes {
+		fields[attribute.Key] = attribute.Value.value()
+	}
+
+	switch {
+	case logRecord.SeverityNumber > 0:
+		// OTLP has 4 severities per level: TRACE (1-4), DEBUG (5-8), INFO (9-12), WARN (13-16), ERROR (17-20), FATAL (21-24)
+		fields["level"] = 10 * (1 + min((logRecord.SeverityNumber-1)/4, 5))
+	case len(logRecord.SeverityText) > 0:
+		fields["level"] = logRecord.SeverityText
+	}
+	if body := logRecord.Body.value(); body != nil {
+		if message, ok := body.(string); ok {
+			fields["msg"] = message
+		} else {
+			fields["body"] = body
+		}
+	}
+	if len(logRecord.TraceID) > 0 {
+		fields["trace_id"] = logRecord.TraceID
+	}
+	if len(logRecord.SpanID) > 0 {
+		fields["span_id"] = logRecord.SpanID
+	}
+	if len(logRecord.EventName) > 0 {
+		fields["event.name"] = logRecord.EventName
+	}
+	return fields
+}
+
+// value converts the OTLP value into a JSON value
+func (value otlpAnyValue) value() any {
+	switch {
+	case value.StringValue != nil:
+		return *value.StringValue
+	case value.BoolValue != nil:
+		return *value.BoolValue
+	case value.IntValue != nil:
+		return float64(*value.IntValue)
+	case value.DoubleValue != nil:
+		return *value.DoubleValue
+	case value.ArrayValue != nil:
+		values := []any{}
+		for _, item := range value.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case value.KvlistValue != nil:
+		values := map[string]any{}
+		for _, item := range value.KvlistValue.Values {
+			values[item.Key] = item.Value.value()
+		}
+		return values
+	case value.BytesValue != nil:
+		return *value.BytesValue
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes an integer given as a string or a number
+//
+// implements json.Unmarshaler
+func (integer *otlpInteger) UnmarshalJSON(payload []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(payload, &number); err != nil {
+		return err
+	}
+	value, err := strconv.ParseInt(number.String(), 10, 64)
+	if err != nil {
+		return errors.ArgumentInvalid.With("integer", number.String())
+	}
+	*integer = otlpInteger(value)
+	return nil
+}
+
+// unmarshalProtobuf decodes an ExportLogsServiceRequest encoded in protobuf
+func (request *otlpRequest) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		if number == 1 {
+			var resourceLogs otlpResourceLogs
+			if err := resourceLogs.unmarshalProtobuf(value.bytes); err != nil {
+				return err
+			}
+			request.ResourceLogs = append(request.ResourceLogs, resourceLogs)
+		}
+		return nil
+	})
+}
+
+func (resourceLogs *otlpResourceLogs) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1: // Resource
+			return decodeProtobuf(value.bytes, func(number protowire.Number, value protoValue) error {
+				if number == 1 {
+					return appendKeyValue(&resourceLogs.Resource.Attributes, value.bytes, 0)
+				}
+				return nil
+			})
+		case 2, 1000: // ScopeLogs, or the InstrumentationLibraryLogs of older exporters
+			var scopeLogs otlpScopeLogs
+			if err := scopeLogs.unmarshalProtobuf(value.bytes); err != nil {
+				return err
+			}
+			resourceLogs.ScopeLogs = append(resourceLogs.ScopeLogs, scopeLogs)
+		}
+		return nil
+	})
+}
+
+func (scopeLogs *otlpScopeLogs) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1: // InstrumentationScope
+			return decodeProtobuf(value.bytes, func(number protowire.Number, value protoValue) error {
+				switch number {
+				case 1:
+					scopeLogs.Scope.Name = string(value.bytes)
+				case 2:
+					scopeLogs.Scope.Version = string(value.bytes)
+				}
+				return nil
+			})
+		case 2:
+			var logRecord otlpLogRecord
+			if err := logRecord.unmarshalProtobuf(value.bytes); err != nil {
+				return err
+			}
+			scopeLogs.LogRecords = append(scopeLogs.LogRecords, logRecord)
+		}
+		return nil
+	})
+}
+
+func (logRecord *otlpLogRecord) unmarshalProtobuf(payload []byte) error {
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1:
+			logRecord.TimeUnixNano = otlpInteger(value.number)
+		case 2:
+			logRecord.SeverityNumber = int(value.number)
+		case 3:
+			logRecord.SeverityText = string(value.bytes)
+		case 5:
+			return logRecord.Body.unmarshalProtobuf(value.bytes, 0)
+		case 6:
+			return appendKeyValue(&logRecord.Attributes, value.bytes, 0)
+		case 9:
+			logRecord.TraceID = hex.EncodeToString(value.bytes)
+		case 10:
+			logRecord.SpanID = hex.EncodeToString(value.bytes)
+		case 11:
+			logRecord.ObservedTimeUnixNano = otlpInteger(value.number)
+		case 12:
+			logRecord.EventName = string(value.bytes)
+		}
+		return nil
+	})
+}
+
+// unmarshalProtobuf decodes an AnyValue nested in depth array or kvlist values
+func (anyValue *otlpAnyValue) unmarshalProtobuf(payload []byte, depth int) error {
+	if depth > otlpMaxDepth {
+		return errors.ArgumentInvalid.With("depth", depth)
+	}
+	return decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1:
+			text := string(value.bytes)
+			anyValue.StringValue = &text
+		case 2:
+			flag := value.number != 0
+			anyValue.BoolValue = &flag
+		case 3:
+			integer := otlpInteger(value.number)
+			anyValue.IntValue = &integer
+		case 4:
+			double := math.Float64frombits(value.number)
+			anyValue.DoubleValue = &double
+		case 5:
+			anyValue.ArrayValue = &struct {
+				Values []otlpAnyValue `json:"values"`
+			}{}
+			return decodeProtobuf(value.bytes, func(number protowire.Number, value protoValue) error {
+				if number == 1 {
+					var item otlpAnyValue
+					if err := item.unmarshalProtobuf(value.bytes, depth+1); err != nil {
+						return err
+					}
+					anyValue.ArrayValue.Values = append(anyValue.ArrayValue.Values, item)
+				}
+				return nil
+			})
+		case 6:
+			anyValue.KvlistValue = &struct {
+				Values []otlpKeyValue `json:"values"`
+			}{}
+			return decodeProtobuf(value.bytes, func(number protowire.Number, value protoValue) error {
+				if number == 1 {
+					return appendKeyValue(&anyValue.KvlistValue.Values, value.bytes, depth+1)
+				}
+				return nil
+			})
+		case 7:
+			encoded := base64.StdEncoding.EncodeToString(value.bytes)
+			anyValue.BytesValue = &encoded
+		}
+		return nil
+	})
+}
+
+// appendKeyValue decodes a KeyValue encoded in protobuf, with its value nested in depth array or kvlist values, and appends it to the given list
+func appendKeyValue(list *[]otlpKeyValue, payload []byte, depth int) error {
+	var keyValue otlpKeyValue
+	err := decodeProtobuf(payload, func(number protowire.Number, value protoValue) error {
+		switch number {
+		case 1:
+			keyValue.Key = string(value.bytes)
+		case 2:
+			return keyValue.Value.unmarshalProtobuf(value.bytes, depth)
+		}
+		return nil
+	})
+	if err == nil {
+		*list = append(*list, keyValue)
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package listen
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type OTLPSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestOTLPSuite(t *testing.T) {
+	suite.Run(t, new(OTLPSuite))
+}
+
+func (suite *OTLPSuite) SetupSuite() {
+	suite.Name = "OTLP"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// post posts the given payload to an OTLPListener and returns the status, the response body, and the received records
+func (suite *OTLPSuite) post(contentType string, payload []byte) (int, string, []Record) {
+	listener := &OTLPListener{}
+	records := []Record{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		listener.serveLogs(suite.ctx, res, req, func(record Record) { records = append(records, record) })
+	}))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+OTLPLogsPath, contentType, bytes.NewReader(payload))
+	suite.Require().NoError(err)
+	defer func() { _ = res.Body.Close() }()
+	body, err := io.ReadAll(res.Body)
+	suite.Require().NoError(err)
+	return res.StatusCode, string(body), records
+}
+
+// appendMessage appends the given message as the field of the given number
+func appendMessage(buffer []byte, number protowire.Number, message []byte) []byte {
+	buffer = protowire.AppendTag(buffer, number, protowire.BytesType)
+	return protowire.AppendBytes(buffer, message)
+}
+
+// appendString appends the given string as the field of the given number
+func appendString(buffer []byte, number protowire.Number, value string) []byte {
+	buffer = protowire.AppendTag(buffer, number, protowire.BytesType)
+	return protowire.AppendString(buffer, value)
+}
+
+// keyValue encodes a KeyValue with the given encoded AnyValue
+func keyValue(key string, value []byte) []byte {
+	return appendMessage(appendString(nil, 1, key), 2, value)
+}
+
+// nestedArrays encodes an AnyValue with a string nested in the given number of array values
+func nestedArrays(depth int) []byte {
+	value := appendString(nil, 1, "deep")
+	for range depth {
+		value = appendMessage(nil, 5, appendMessage(nil, 1, value))
+	}
+	return value
+}
+
+func (suite *OTLPSuite) TestCanReceiveJSONLogs() {
+	status, body, records := suite.post("application/json", []byte(`{"resourceLogs": [{
+		"resource": {"attributes": [
+			{"key": "host.name", "value": {"stringValue": "web-1"}},
+			{"key": "service.name", "value": {"stringValue": "api"}},
+			{"key": "process.pid", "value": {"intValue": "42"}},
+			{"key": "k8s.namespace.name", "value": {"stringValue": "shop"}}
+		]},
+		"scopeLogs": [{
+			"scope": {"name": "orders"},
+			"logRecords": [{
+				"timeUnixNano": "1700000000000000000",
+				"severityNumber": 17,
+				"body": {"stringValue": "payment failed"},
+				"attributes": [{"key": "order", "value": {"kvlistValue": {"values": [{"key": "id", "value": {"intValue": 7}}]}}}],
+				"traceId": "5b8efff798038103d269b633813fc60c"
+			}]
+		}]
+	}]}`))
+	suite.Require().Equal(http.StatusOK, status)
+	suite.Assert().Equal("{}", body)
+	suite.Require().Len(records, 1)
+	suite.Assert().Equal(map[string]any{
+		"time":       time.Unix(1700000000, 0).UTC().Format(time.RFC3339Nano),
+		"level":      50,
+		"hostname":   "web-1",
+		"name":       "api",
+		"pid":        float64(42),
+		"resource":   map[string]any{"k8s.namespace.name": "shop"},
+		"otel.scope": "orders",
+		"order":      map[string]any{"id": float64(7)},
+		"msg":        "payment failed",
+		"trace_id":   "5b8efff798038103d269b633813fc60c",
+	}, records[0].Fields)
+}
+
+func (suite *OTLPSuite) TestCanReceiveProtobufLogs() {
+	var resource, scope, logRecord, body []byte
+	resource = appendMessage(resource, 1, keyValue("service.name", appendString(nil, 1, "api")))
+
+	scope = appendString(scope, 1, "orders")
+	scope = appendString(scope, 2, "1.0")
+
+	items := appendMessage(nil, 1, appendString(nil, 1, "a"))
+	items = appendMessage(items, 1, protowire.AppendVarint(protowire.AppendTag(nil, 3, protowire.VarintType), 12))
+	body = appendMessage(body, 1, keyValue("items", appendMessage(nil, 5, items)))
+	body = appendMessage(body, 1, keyValue("ratio", protowire.AppendFixed64(protowire.AppendTag(nil, 4, protowire.Fixed64Type), math.Float64bits(0.5))))
+	body = appendMessage(body, 1, keyValue("ok", protowire.AppendVarint(protowire.AppendTag(nil, 2, protowire.VarintType), 1)))
+	body = appendMessage(body, 1, keyValue("raw", appendString(nil, 7, "\x00\x01")))
+
+	logRecord = protowire.AppendFixed64(protowire.AppendTag(logRecord, 11, protowire.Fixed64Type), 1700000000000000500)
+	logRecord = protowire.AppendVarint(protowire.AppendTag(logRecord, 2, protowire.VarintType), 9)
+	logRecord = appendMessage(logRecord, 5, appendMessage(nil, 6, body))
+	logRecord = appendMessage(logRecord, 6, keyValue("user", appendString(nil, 1, "bob")))
+	logRecord = appendString(logRecord, 10, "\x01\x02\x03\x04\x05\x06\x07\x08")
+	logRecord = appendString(logRecord, 12, "order.paid")
+
+	scopeLogs := appendMessage(appendMessage(nil, 1, scope), 2, logRecord)
+	resourceLogs := appendMessage(appendMessage(nil, 1, resource), 2, scopeLogs)
+	request := appendMessage(nil, 1, resourceLogs)
+
+	status, _, records := suite.post("application/x-protobuf", request)
+	suite.Require().Equal(http.StatusOK, status)
+	suite.Require().Len(records, 1)
+	suite.Assert().Equal(map[string]any{
+		"time":       time.Unix(1700000000, 500).UTC().Format(time.RFC3339Nano),
+		"level":      30,
+		"name":       "api",
+		"otel.scope": "orders",
+		"user":       "bob",
+		"body": map[string]any{
+			"items": []any{"a", float64(12)},
+			"ratio": 0.5,
+			"ok":    true,
+			"raw":   base64.StdEncoding.EncodeToString([]byte{0, 1}),
+		},
+		"span_id":    "0102030405060708",
+		"event.name": "order.paid",
+	}, records[0].Fields)
+}
+
+func (suite *OTLPSuite) TestShouldRejectTooDeeplyNestedValues() {
+	var value otlpAnyValue
+	suite.Require().NoError(value.unmarshalProtobuf(nestedArrays(otlpMaxDepth), 0))
+
+	err := value.unmarshalProtobuf(nestedArrays(otlpMaxDepth+1), 0)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+
+	kvlist := appendString(nil, 1, "deep")
+	for range otlpMaxDepth + 1 {
+		kvlist = appendMessage(nil, 6, appendMessage(nil, 1, keyValue("key", kvlist)))
+	}
+	err = value.unmarshalProtobuf(kvlist, 0)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+
+	logRecord := appendMessage(nil, 5, nestedArrays(otlpMaxDepth+1))
+	request := appendMessage(nil, 1, appendMessage(nil, 2, appendMessage(nil, 2, logRecord)))
+	status, _, records := suite.post("application/x-protobuf", request)
+	suite.Assert().Equal(http.StatusBadRequest, status)
+	suite.Assert().Empty(records)
+}
+
+func (suite *OTLPSuite) TestShouldRejectInvalidLogs() {
+	request := appendMessage(nil, 1, appendMessage(nil, 2, appendMessage(nil, 2, appendString(nil, 12, "event"))))
+	status, _, records := suite.post("application/x-protobuf", request[:len(request)-2])
+	suite.Assert().Equal(http.StatusBadRequest, status, "A truncated payload should be rejected")
+	suite.Assert().Empty(records)
+
+	status, _, records = suite.post("application/json", []byte(`{"resourceLogs": [{"scopeLogs": [{"logRecords": [{"timeUnixNano": "soon"}]}]}]}`))
+	suite.Assert().Equal(http.StatusBadRequest, status)
+	suite.Assert().Empty(records)
+}
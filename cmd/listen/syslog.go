@@ -0,0 +1,375 @@
+package listen
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+)
+
+// SyslogListener receives syslog messages (RFC 5424 and RFC 3164) over UDP, TCP, or a unix datagram socket
+//
+// With syslog://host:port, both UDP and TCP are listened to. syslog+udp:// and syslog+tcp:// listen to only one of them.
+// With syslog:///path/to/socket or syslog+unix:///path/to/socket, a unix datagram socket is created (like /dev/log).
+type SyslogListener struct {
+	Address  string
+	Networks []string // udp, tcp, or unixgram
+	lock     sync.Mutex
+}
+
+// syslogMaxFrameSize is the largest octet-counted frame accepted over TCP, to not allocate garbage lengths
+const syslogMaxFrameSize = 1024 * 1024
+
+// SyslogSeverityLevels are the bunyan levels of the syslog severities (0: emerg, ..., 7: debug)
+var SyslogSeverityLevels = []int{60, 60, 60, 50, 40, 30, 30, 20}
+
+// SyslogFacilities are the names of the syslog facilities
+var SyslogFacilities = []string{"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp", "ntp", "audit", "alert", "clock", "local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7"}
+
+// NewSyslogListener creates a new SyslogListener for the given URL
+func NewSyslogListener(address *url.URL) (Listener, error) {
+	listener := &SyslogListener{Address: address.Host}
+	switch strings.ToLower(address.Scheme) {
+	case "syslog+tcp":
+		listener.Networks = []string{"tcp"}
+	case "syslog+udp":
+		listener.Networks = []string{"udp"}
+	case "syslog+unix":
+		listener.Address, listener.Networks = address.Path, []string{"unixgram"}
+	default:
+		if len(address.Host) == 0 && len(address.Path) > 0 {
+			listener.Address, listener.Networks = address.Path, []string{"unixgram"}
+		} else {
+			listener.Networks = []string{"udp", "tcp"}
+		}
+	}
+	if len(listener.Address) == 0 {
+		return nil, errors.ArgumentMissing.With("address")
+	}
+	return listener, nil
+}
+
+// Listen receives the syslog messages and sends them to the handler until the context is done
+//
+// implements Listener
+func (listener *SyslogListener) Listen(ctx context.Context, handle func(record Record)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "syslog")
+	var waiter sync.WaitGroup
+	var merr errors.MultiError
+	var merrLock sync.Mutex
+
+	// all the sockets are bound before serving, so none is left open if one fails
+	type server struct {
+		network string
+		closer  io.Closer
+		serve   func() error
+	}
+	servers := []server{}
+	closeAll := func() {
+		for _, server := range servers {
+			_ = server.closer.Close()
+		}
+	}
+	for _, network := range listener.Networks {
+		switch network {
+		case "tcp":
+			tcpListener, err := net.Listen(network, listener.Address)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			servers = append(servers, server{network, tcpListener, func() error { return listener.serveStream(ctx, tcpListener, handle) }})
+		case "unixgram":
+			if err := removeSocket(listener.Address); err != nil { // a previous socket
+				closeAll()
+				return err
+			}
+			conn, err := net.ListenPacket(network, listener.Address)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			defer func() { _ = removeSocket(listener.Address) }()
+			servers = append(servers, server{network, conn, func() error { return listener.servePackets(ctx, conn, handle) }})
+		default:
+			conn, err := net.ListenPacket(network, listener.Address)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			servers = append(servers, server{network, conn, func() error { return listener.servePackets(ctx, conn, handle) }})
+		}
+		log.Infof("Listening to syslog messages on %s %s", network, listener.Address)
+	}
+
+	for _, server := range servers {
+		waiter.Add(2)
+		go func() {
+			defer waiter.Done()
+			<-ctx.Done()
+			_ = server.closer.Close()
+		}()
+		go func() {
+			defer waiter.Done()
+			if err := server.serve(); err != nil && ctx.Err() == nil {
+				log.Errorf("Failed to receive syslog messages on %s", server.network, err)
+				merrLock.Lock()
+				merr.Append(err)
+				merrLock.Unlock()
+			}
+		}()
+	}
+	waiter.Wait()
+	return merr.AsError()
+}
+
+// servePackets receives one syslog message per datagram
+func (listener *SyslogListener) servePackets(ctx context.Context, conn net.PacketConn, handle func(record Record)) error {
+	buffer := make([]byte, 64*1024)
+	for {
+		size, peer, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		listener.emit(handle, syslogSource(peer), buffer[:size])
+	}
+}
+
+// serveStream accepts the TCP connections and reads their syslog messages
+func (listener *SyslogListener) serveStream(ctx context.Context, tcpListener net.Listener, handle func(record Record)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "syslog")
+
+	for {
+		conn, err := tcpListener.Accept()
+		if err != nil {
+			return err
+		}
+		log.Debugf("Accepted syslog connection from %s", conn.RemoteAddr())
+		go func() {
+			defer func() { _ = conn.Close() }()
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			defer stop()
+			if err := listener.readFrames(conn, syslogSource(conn.RemoteAddr()), handle); err != nil && ctx.Err() == nil {
+				log.Warnf("Syslog connection from %s ended: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// readFrames reads the syslog messages of a TCP connection (RFC 6587)
+//
+// The messages are framed by octet counting ("123 <34>1 ...") or separated by new lines.
+// A frame length out of 1..syslogMaxFrameSize or a line longer than syslogMaxFrameSize ends the connection.
+func (listener *SyslogListener) readFrames(reader io.Reader, source string, handle func(record Record)) error {
+	buffered := bufio.NewReader(reader)
+	for {
+		first, err := buffered.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if first[0] >= '0' && first[0] <= '9' {
+			slice, err := buffered.ReadSlice(' ') // bounded by the size of the buffer
+			if err != nil {
+				return err
+			}
+			length := strings.TrimSpace(string(slice))
+			size, err := strconv.Atoi(length)
+			if err != nil || size < 1 || size > syslogMaxFrameSize {
+				return errors.ArgumentInvalid.With("frame length", length)
+			}
+			message := make([]byte, size)
+			if _, err := io.ReadFull(buffered, message); err != nil {
+				return err
+			}
+			listener.emit(handle, source, message)
+			continue
+		}
+		message, err := readLine(buffered, syslogMaxFrameSize)
+		if len(strings.TrimSpace(string(message))) > 0 {
+			listener.emit(handle, source, message)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// emit parses the message and sends it to the handler, calls are serialized
+func (listener *SyslogListener) emit(handle func(record Record), source string, message []byte) {
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	handle(Record{Source: source, Fields: ParseSyslog(string(message), time.Now())})
+}
+
+// syslogSource gets the source of the messages sent by the given peer
+func syslogSource(peer net.Addr) string {
+	if peer == nil || len(peer.String()) == 0 {
+		return "syslog:local"
+	}
+	if host, _, err := net.SplitHostPort(peer.String()); err == nil {
+		return "syslog:" + host
+	}
+	return "syslog:" + peer.String()
+}
+
+// ParseSyslog parses the given RFC 5424 or RFC 3164 message into the fields of a bunyan entry
+//
+// The structured data of RFC 5424 messages become fields named {SD-ID}.{PARAM-NAME}.
+// If the MSG part is a JSON object, it is parsed as a bunyan entry whose fields win over the syslog header.
+// Messages that cannot be parsed are kept as the msg at the INFO level. now is used if the message has no time or year.
+func ParseSyslog(message string, now time.Time) map[string]any {
+	message = strings.TrimRight(message, "\r\n\x00")
+	fields := map[string]any{"time": now.Format(time.RFC3339Nano), "level": 30, "msg": message}
+
+	if !strings.HasPrefix(message, "<") {
+		return fields
+	}
+	end := strings.Index(message, ">")
+	if end < 2 || end > 4 {
+		return fields
+	}
+	priority, err := strconv.ParseUint(message[1:end], 10, 8) // no sign, like "<-1>"
+	if err != nil || priority > 191 {
+		return fields
+	}
+	fields["level"] = SyslogSeverityLevels[priority%8]
+	fields["facility"] = SyslogFacilities[priority/8]
+	rest := message[end+1:]
+
+	var msg string
+	if strings.HasPrefix(rest, "1 ") {
+		msg = parseRFC5424(rest[2:], fields)
+	} else {
+		msg = parseRFC3164(rest, fields, now)
+	}
+	msg = strings.TrimPrefix(msg, "\ufeff") // the BOM of UTF-8 messages
+	setMessage(fields, msg)
+	return fields
+}
+
+// parseRFC5424 parses "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG" and returns the MSG
+func parseRFC5424(rest string, fields map[string]any) string {
+	header := make([]string, 5)
+	for index := range header {
+		var found bool
+		if header[index], rest, found = strings.Cut(rest, " "); !found {
+			break
+		}
+	}
+	if timestamp, err := time.Parse(time.RFC3339Nano, header[0]); err == nil {
+		fields["time"] = timestamp.Format(time.RFC3339Nano)
+	}
+	setSyslogHeader(fields, header[1], header[2], header[3])
+	if header[4] != "-" && len(header[4]) > 0 {
+		fields["msgid"] = header[4]
+	}
+	if strings.HasPrefix(rest, "-") {
+		return strings.TrimPrefix(strings.TrimPrefix(rest, "-"), " ")
+	}
+	for strings.HasPrefix(rest, "[") {
+		rest = parseStructuredData(rest[1:], fields)
+	}
+	return strings.TrimPrefix(rest, " ")
+}
+
+// parseStructuredData parses one SD-ELEMENT after its "[" into fields and returns what follows its "]"
+//
+// The closing "]" of the element is found first, so the parameters of an element never run into the next one
+func parseStructuredData(rest string, fields map[string]any) string {
+	end, quoted := len(rest), false
+	for index := 0; index < len(rest) && end == len(rest); index++ {
+		switch {
+		case quoted && rest[index] == '\\':
+			index++
+		case rest[index] == '"':
+			quoted = !quoted
+		case !quoted && rest[index] == ']':
+			end = index
+		}
+	}
+	element, after := rest[:end], ""
+	if end < len(rest) {
+		after = rest[end+1:]
+	}
+
+	id, params, _ := strings.Cut(element, " ")
+	for {
+		name, value, found := strings.Cut(strings.TrimLeft(params, " "), "=\"")
+		if !found {
+			return after
+		}
+		var builder strings.Builder
+		index := 0
+		for ; index < len(value); index++ {
+			if value[index] == '\\' && index+1 < len(value) && strings.ContainsRune(`"\]`, rune(value[index+1])) {
+				index++
+			} else if value[index] == '"' {
+				break
+			}
+			builder.WriteByte(value[index])
+		}
+		fields[id+"."+name] = builder.String()
+		if index >= len(value) {
+			return after
+		}
+		params = value[index+1:]
+	}
+}
+
+// parseRFC3164 parses "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG" and returns the MSG
+//
+// The timestamp has no year nor time zone, the ones of now are used
+func parseRFC3164(rest string, fields map[string]any, now time.Time) string {
+	if len(rest) < 16 {
+		return rest
+	}
+	timestamp, err := time.ParseInLocation(time.Stamp, rest[:15], now.Location())
+	if err != nil {
+		return rest
+	}
+	timestamp = timestamp.AddDate(now.Year(), 0, 0)
+	if timestamp.After(now.AddDate(0, 1, 0)) {
+		timestamp = timestamp.AddDate(-1, 0, 0) // a message from last December received in January
+	}
+	fields["time"] = timestamp.Format(time.RFC3339Nano)
+
+	hostname, rest, _ := strings.Cut(strings.TrimPrefix(rest[15:], " "), " ")
+	tag, msg, found := strings.Cut(rest, ": ")
+	if !found || strings.ContainsAny(tag, " ") {
+		setSyslogHeader(fields, hostname, "-", "-")
+		return rest
+	}
+	procid := "-"
+	if open := strings.Index(tag, "["); open > 0 && strings.HasSuffix(tag, "]") {
+		tag, procid = tag[:open], tag[open+1:len(tag)-1]
+	}
+	setSyslogHeader(fields, hostname, tag, procid)
+	return msg
+}
+
+// setSyslogHeader sets the hostname, name, and pid fields, "-" means no value
+func setSyslogHeader(fields map[string]any, hostname, appName, procid string) {
+	if len(hostname) > 0 && hostname != "-" {
+		fields["hostname"] = hostname
+	}
+	if len(appName) > 0 && appName != "-" {
+		fields["name"] = appName
+	}
+	if pid, err := strconv.Atoi(procid); err == nil {
+		fields["pid"] = pid
+	} else if len(procid) > 0 && procid != "-" {
+		fields["procid"] = procid
+	}
+}
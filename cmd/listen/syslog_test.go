@@ -0,0 +1,176 @@
+package listen
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type SyslogSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestSyslogSuite(t *testing.T) {
+	suite.Run(t, new(SyslogSuite))
+}
+
+func (suite *SyslogSuite) SetupSuite() {
+	suite.Name = "Syslog"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+func (suite *SyslogSuite) TestCanParseSyslog() {
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		message  string
+		expected map[string]any
+	}{
+		{
+			name:    "RFC 5424",
+			message: `<165>1 2026-10-18T09:30:00.123Z web-1 api 42 ID47 [exampleSDID@32473 iut="3" eventSource="Application"] started` + "\n",
+			expected: map[string]any{
+				"time": "2026-10-18T09:30:00.123Z", "level": 30, "facility": "local4", "hostname": "web-1", "name": "api", "pid": 42, "msgid": "ID47",
+				"exampleSDID@32473.iut": "3", "exampleSDID@32473.eventSource": "Application", "msg": "started",
+			},
+		},
+		{
+			name:     "RFC 5424 without structured data",
+			message:  "<11>1 - - - - - - \ufeffdisk failed",
+			expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": 50, "facility": "user", "msg": "disk failed"},
+		},
+		{
+			name:    "RFC 5424 with successive elements",
+			message: `<14>1 - host app - - [a][b x="1" y="a \"quoted\] value"] msg`,
+			expected: map[string]any{
+				"time": "2026-10-18T10:00:00Z", "level": 30, "facility": "user", "hostname": "host", "name": "app",
+				"b.x": "1", "b.y": `a "quoted] value`, "msg": "msg",
+			},
+		},
+		{
+			name:     "RFC 5424 with JSON message",
+			message:  `<14>1 - host app - - - {"msg": "from json", "level": 40}`,
+			expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": float64(40), "facility": "user", "hostname": "host", "name": "app", "msg": "from json"},
+		},
+		{
+			name:     "RFC 3164",
+			message:  "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed",
+			expected: map[string]any{"time": "2026-10-11T22:14:15Z", "level": 60, "facility": "auth", "hostname": "mymachine", "name": "su", "pid": 123, "msg": "'su root' failed"},
+		},
+		{
+			name:     "RFC 3164 of last year",
+			message:  "<13>Dec 31 23:59:59 host cron: tick",
+			expected: map[string]any{"time": "2025-12-31T23:59:59Z", "level": 30, "facility": "user", "hostname": "host", "name": "cron", "msg": "tick"},
+		},
+		{name: "negative PRI", message: "<-1>boom", expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": 30, "msg": "<-1>boom"}},
+		{name: "signed PRI", message: "<+1>boom", expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": 30, "msg": "<+1>boom"}},
+		{name: "PRI too large", message: "<192>boom", expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": 30, "msg": "<192>boom"}},
+		{name: "PRI not a number", message: "<ab>boom", expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": 30, "msg": "<ab>boom"}},
+		{name: "no PRI", message: "plain text", expected: map[string]any{"time": "2026-10-18T10:00:00Z", "level": 30, "msg": "plain text"}},
+	}
+	for _, test := range tests {
+		suite.Run(test.name, func() {
+			suite.Assert().Equal(test.expected, ParseSyslog(test.message, now))
+		})
+	}
+}
+
+func (suite *SyslogSuite) TestCanReadFrames() {
+	stream := "25 <14>1 - - - - - - counted\n" + // octet counted, the new line is part of the frame
+		"<14>1 - - - - - - by line\n" +
+		"\n" +
+		"8 <14>last" +
+		"<14>no new line"
+	listener := &SyslogListener{}
+	messages := []string{}
+	err := listener.readFrames(strings.NewReader(stream), "syslog:local", func(record Record) {
+		suite.Assert().Equal("syslog:local", record.Source)
+		messages = append(messages, record.Fields["msg"].(string))
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"counted", "by line", "last", "no new line"}, messages)
+}
+
+func (suite *SyslogSuite) TestShouldRejectTooLargeFrames() {
+	listener := &SyslogListener{}
+	for name, stream := range map[string]string{
+		"length too large":     "9999999999 <14>boom",
+		"length zero":          "0 <14>boom",
+		"length not a number":  "12a <14>boom",
+		"line too long":        "<14>" + strings.Repeat("x", syslogMaxFrameSize) + "\n",
+		"last line too long":   strings.Repeat("x", syslogMaxFrameSize+1),
+		"frame length too big": "1048577 <14>boom",
+	} {
+		messages := 0
+		err := listener.readFrames(strings.NewReader(stream), "syslog:local", func(record Record) { messages++ })
+		suite.Require().Error(err, name)
+		suite.Assert().ErrorIs(err, errors.ArgumentInvalid, name)
+		suite.Assert().Zero(messages, name)
+	}
+}
+
+func (suite *SyslogSuite) TestShouldNotRemoveFileThatIsNotSocket() {
+	dir, err := os.MkdirTemp("", "lv-syslog") // the path of a unix socket must be short
+	suite.Require().NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log")
+	suite.Require().NoError(os.WriteFile(path, []byte("precious"), 0o600))
+
+	listener, err := NewSyslogListener(&url.URL{Scheme: "syslog", Path: path})
+	suite.Require().NoError(err)
+	err = listener.Listen(suite.ctx, func(record Record) {})
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+	content, err := os.ReadFile(path)
+	suite.Require().NoError(err, "The file should not be removed")
+	suite.Assert().Equal("precious", string(content))
+}
+
+func (suite *SyslogSuite) TestCanReceiveOnUnixSocket() {
+	dir, err := os.MkdirTemp("", "lv-syslog")
+	suite.Require().NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "log")
+	previous, err := net.ListenPacket("unixgram", path) // a socket left by a previous listener
+	suite.Require().NoError(err)
+	_ = previous.Close()
+
+	listener, err := NewSyslogListener(&url.URL{Scheme: "syslog", Path: path})
+	suite.Require().NoError(err)
+	ctx, cancel := context.WithCancel(suite.ctx)
+	defer cancel()
+	received := make(chan Record, 1)
+	done := make(chan error, 1)
+	go func() { done <- listener.Listen(ctx, func(record Record) { received <- record }) }()
+
+	var conn net.Conn
+	suite.Require().Eventually(func() bool {
+		conn, err = net.Dial("unixgram", path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write([]byte("<14>1 - host app - - - hello"))
+	suite.Require().NoError(err)
+	select {
+	case record := <-received:
+		suite.Assert().Equal("hello", record.Fields["msg"])
+	case <-time.After(5 * time.Second):
+		suite.FailNow("No record received")
+	}
+
+	cancel()
+	suite.Require().NoError(<-done)
+	_, err = os.Lstat(path)
+	suite.Assert().ErrorIs(err, os.ErrNotExist, "The socket should be removed")
+}
@@ -0,0 +1,174 @@
+package listen
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+)
+
+// UnixListener receives newline-delimited log entries (JSON or text) written to a unix socket or to a named pipe
+//
+// With unix:///path/to/socket, a unix stream socket is created and several writers can connect to it at the same time,
+// their entries are tagged with the process that connected (e.g. [unix:api.test/4242]) where the system tells it.
+// With fifo:///path/to/pipe, a named pipe is read (and created if needed), its entries are tagged with its name.
+type UnixListener struct {
+	Path  string
+	FIFO  bool
+	lock  sync.Mutex
+	conns int // the number of accepted connections, to tag the writers whose process is unknown
+}
+
+// unixMaxLineSize is the longest line accepted from a writer, to not buffer a stream without new lines
+const unixMaxLineSize = 1024 * 1024
+
+// NewUnixListener creates a new UnixListener for the given URL
+func NewUnixListener(address *url.URL) (Listener, error) {
+	path := address.Path
+	if len(address.Host) > 0 { // unix://relative/path
+		path = address.Host + address.Path
+	}
+	if len(path) == 0 {
+		return nil, errors.ArgumentMissing.With("path")
+	}
+	return &UnixListener{Path: path, FIFO: strings.EqualFold(address.Scheme, "fifo")}, nil
+}
+
+// Listen receives the entries and sends them to the handler until the context is done
+//
+// implements Listener
+func (listener *UnixListener) Listen(ctx context.Context, handle func(record Record)) error {
+	if listener.FIFO {
+		return listener.listenFIFO(ctx, handle)
+	}
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "unix")
+
+	if err := removeSocket(listener.Path); err != nil { // a previous socket
+		return err
+	}
+	socket, err := net.Listen("unix", listener.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = removeSocket(listener.Path) }()
+	stop := context.AfterFunc(ctx, func() { _ = socket.Close() })
+	defer stop()
+	log.Infof("Listening to log entries on unix socket %s", listener.Path)
+
+	var waiter sync.WaitGroup
+	defer waiter.Wait()
+	for {
+		conn, err := socket.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		source, pid := listener.peer(conn)
+		log.Debugf("Accepted connection from %s", source)
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			defer func() { _ = conn.Close() }()
+			stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			defer stop()
+			if err := listener.readLines(conn, source, pid, handle); err != nil && ctx.Err() == nil {
+				log.Warnf("Connection from %s ended: %s", source, err)
+			}
+		}()
+	}
+}
+
+// listenFIFO reads the entries written to the named pipe, which is created if it does not exist
+//
+// The pipe is also opened for writing, so it does not reach its end when its writers close it
+func (listener *UnixListener) listenFIFO(ctx context.Context, handle func(record Record)) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("listen", "fifo")
+
+	if _, err := os.Stat(listener.Path); errors.Is(err, os.ErrNotExist) {
+		if err := mkfifo(listener.Path); err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(listener.Path) }()
+	} else if err != nil {
+		return err
+	}
+	pipe, err := os.OpenFile(listener.Path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = pipe.Close() })
+	defer stop()
+	log.Infof("Listening to log entries on named pipe %s", listener.Path)
+
+	if err := listener.readLines(pipe, "fifo:"+filepath.Base(listener.Path), 0, handle); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+// peer gets the source of the entries of the given connection and the PID of its process (0 if unknown)
+func (listener *UnixListener) peer(conn net.Conn) (string, int) {
+	listener.lock.Lock()
+	listener.conns++
+	number := listener.conns
+	listener.lock.Unlock()
+
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		if pid, ok := peerPID(unixConn); ok && pid > 0 {
+			if name := processName(pid); len(name) > 0 {
+				return fmt.Sprintf("unix:%s/%d", name, pid), pid
+			}
+			return fmt.Sprintf("unix:%d", pid), pid
+		}
+	}
+	return fmt.Sprintf("unix:#%d", number), 0
+}
+
+// readLines reads the entries of a writer, one per line, until its end
+//
+// A line longer than unixMaxLineSize fails with errors.ArgumentInvalid
+func (listener *UnixListener) readLines(reader io.Reader, source string, pid int, handle func(record Record)) error {
+	buffered := bufio.NewReader(reader)
+	for {
+		data, err := readLine(buffered, unixMaxLineSize)
+		if line := strings.TrimRight(string(data), "\r\n"); len(strings.TrimSpace(line)) > 0 {
+			listener.emit(handle, source, unixFields(line, pid, time.Now()))
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// emit sends the fields to the handler, calls are serialized
+func (listener *UnixListener) emit(handle func(record Record), source string, fields map[string]any) {
+	listener.lock.Lock()
+	defer listener.lock.Unlock()
+	handle(Record{Source: source, Fields: fields})
+}
+
+// unixFields converts a line written by a process into the fields of a bunyan entry
+//
+// A JSON line is parsed as a bunyan entry whose fields win, a text line becomes the msg of an info entry received at now
+func unixFields(line string, pid int, now time.Time) map[string]any {
+	fields := map[string]any{"time": now.UTC().Format(time.RFC3339Nano), "level": 30}
+	if pid > 0 {
+		fields["pid"] = pid
+	}
+	setMessage(fields, line)
+	return fields
+}
@@ -0,0 +1,31 @@
+package listen
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerPID gets the PID of the process connected to the unix socket, with LOCAL_PEERPID
+func peerPID(conn *net.UnixConn) (pid int, ok bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	_ = raw.Control(func(fd uintptr) {
+		if value, err := unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID); err == nil {
+			pid, ok = value, true
+		}
+	})
+	return pid, ok
+}
+
+// processName gets the command name of the given process, empty if unknown
+func processName(pid int) string {
+	return ""
+}
+
+// mkfifo creates a named pipe
+func mkfifo(path string) error {
+	return unix.Mkfifo(path, 0o600)
+}
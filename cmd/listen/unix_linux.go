@@ -0,0 +1,38 @@
+package listen
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerPID gets the PID of the process connected to the unix socket, with SO_PEERCRED
+func peerPID(conn *net.UnixConn) (pid int, ok bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, false
+	}
+	_ = raw.Control(func(fd uintptr) {
+		if credentials, err := unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED); err == nil {
+			pid, ok = int(credentials.Pid), true
+		}
+	})
+	return pid, ok
+}
+
+// processName gets the command name of the given process, empty if unknown
+func processName(pid int) string {
+	name, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.NewReplacer(" ", "_", "]", "_", "/", "_").Replace(strings.TrimSpace(string(name)))
+}
+
+// mkfifo creates a named pipe
+func mkfifo(path string) error {
+	return unix.Mkfifo(path, 0o600)
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin
+
+package listen
+
+import (
+	"net"
+
+	"github.com/gildas/go-errors"
+)
+
+// peerPID gets the PID of the process connected to the unix socket, this system does not tell it
+func peerPID(conn *net.UnixConn) (int, bool) {
+	return 0, false
+}
+
+// processName gets the command name of the given process, empty if unknown
+func processName(pid int) string {
+	return ""
+}
+
+// mkfifo creates a named pipe, this system does not support them
+func mkfifo(path string) error {
+	return errors.Unsupported.With("named pipe", path)
+}
@@ -0,0 +1,124 @@
+package listen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnixSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestUnixSuite(t *testing.T) {
+	suite.Run(t, new(UnixSuite))
+}
+
+func (suite *UnixSuite) SetupSuite() {
+	suite.Name = "Unix"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// socketPath gets the path of a socket in a new temporary folder
+func (suite *UnixSuite) socketPath() string {
+	dir, err := os.MkdirTemp("", "lv-unix") // the path of a unix socket must be short
+	suite.Require().NoError(err)
+	suite.T().Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "lv.sock")
+}
+
+func (suite *UnixSuite) TestCanReadLines() {
+	listener := &UnixListener{}
+	records := []Record{}
+	err := listener.readLines(strings.NewReader("text line\r\n\n   \n{\"msg\": \"json line\", \"level\": 50}\nlast"), "unix:test", 42, func(record Record) {
+		records = append(records, record)
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(records, 3)
+	suite.Assert().Equal("unix:test", records[0].Source)
+	suite.Assert().Equal("text line", records[0].Fields["msg"])
+	suite.Assert().Equal(42, records[0].Fields["pid"])
+	suite.Assert().Equal("json line", records[1].Fields["msg"])
+	suite.Assert().Equal(float64(50), records[1].Fields["level"])
+	suite.Assert().Equal("last", records[2].Fields["msg"])
+}
+
+func (suite *UnixSuite) TestShouldRejectTooLongLines() {
+	listener := &UnixListener{}
+	for name, stream := range map[string]string{
+		"line too long":      strings.Repeat("x", unixMaxLineSize) + "\n",
+		"last line too long": "first\n" + strings.Repeat("x", unixMaxLineSize+1),
+	} {
+		messages := []any{}
+		err := listener.readLines(strings.NewReader(stream), "unix:test", 0, func(record Record) {
+			messages = append(messages, record.Fields["msg"])
+		})
+		suite.Require().Error(err, name)
+		suite.Assert().ErrorIs(err, errors.ArgumentInvalid, name)
+		suite.Assert().NotContains(fmt.Sprint(messages), "xxx", name)
+	}
+}
+
+func (suite *UnixSuite) TestShouldNotRemoveFileThatIsNotSocket() {
+	path := suite.socketPath()
+	suite.Require().NoError(os.WriteFile(path, []byte("precious"), 0o600))
+
+	listener, err := NewUnixListener(&url.URL{Scheme: "unix", Path: path})
+	suite.Require().NoError(err)
+	err = listener.Listen(suite.ctx, func(record Record) {})
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+	content, err := os.ReadFile(path)
+	suite.Require().NoError(err, "The file should not be removed")
+	suite.Assert().Equal("precious", string(content))
+}
+
+func (suite *UnixSuite) TestCanReceiveOnUnixSocket() {
+	path := suite.socketPath()
+	previous, err := net.Listen("unix", path) // a socket left by a previous listener
+	suite.Require().NoError(err)
+	previous.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = previous.Close()
+
+	listener, err := NewUnixListener(&url.URL{Scheme: "unix", Path: path})
+	suite.Require().NoError(err)
+	ctx, cancel := context.WithCancel(suite.ctx)
+	defer cancel()
+	received := make(chan Record, 1)
+	done := make(chan error, 1)
+	go func() { done <- listener.Listen(ctx, func(record Record) { received <- record }) }()
+
+	var conn net.Conn
+	suite.Require().Eventually(func() bool {
+		conn, err = net.Dial("unix", path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer func() { _ = conn.Close() }()
+	_, err = conn.Write([]byte("hello\n"))
+	suite.Require().NoError(err)
+	select {
+	case record := <-received:
+		suite.Assert().Equal("hello", record.Fields["msg"])
+		suite.Assert().True(strings.HasPrefix(record.Source, "unix:"), record.Source)
+	case <-time.After(5 * time.Second):
+		suite.FailNow("No record received")
+	}
+
+	cancel()
+	_ = conn.Close()
+	suite.Require().NoError(<-done)
+	_, err = os.Lstat(path)
+	suite.Assert().ErrorIs(err, os.ErrNotExist, "The socket should be removed")
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gildas/go-errors"
 	"github.com/gildas/go-logger"
 )
 
+// hiddenBlobs are the blobs that describe the source of the entries, they can be filtered but are not written with the other blobs
+var hiddenBlobs = map[string]bool{KubernetesBlob: true, JournalBlob: true, DockerBlob: true}
+
 // LogEntry represents a log entry
 type LogEntry struct {
 	Time     time.Time `json:"time"`
@@ -28,11 +33,14 @@ type LogEntry struct {
 }
 
 // GetField retrieves the value of a specific field from the LogEntry.
+//
+// Nested values in blobs are retrieved with a dotted path (e.g. "user.id").
 func (entry LogEntry) GetField(name string) string {
 	if value, ok := entry.Fields[name]; ok {
-		if str, ok := value.(string); ok {
-			return str
-		}
+		return stringify(value)
+	}
+	if value, ok := lookupPath(entry.Blobs, name); ok {
+		return stringify(value)
 	}
 	if name == "level" {
 		return entry.Level.String()
@@ -69,11 +77,7 @@ func (entry LogEntry) Write(context context.Context, output io.Writer, options *
 	entry.writeHeader(output, options)
 	entry.writeString(output, options, ": ")
 	entry.writeTopicAndScope(output, options)
-	message, err := log.Unobfuscate(entry.Message)
-	if err != nil {
-		log.Errorf("Failed to Unobfuscate message (%s)", entry.Message, err)
-	}
-	entry.writeStringWithColor(output, options, message, Cyan)
+	entry.writeStringWithColor(output, options, entry.Message, Cyan)
 
 	log.Debugf("Fields: %v", entry.Fields)
 	entry.writeString(output, options, " (")
@@ -94,10 +98,13 @@ func (entry LogEntry) Write(context context.Context, output io.Writer, options *
 	entry.writeString(output, options, ")")
 
 	log.Debugf("Blobs: %v", entry.Blobs)
-	if len(entry.Blobs) > 0 {
+	if entry.hasVisibleBlobs() {
 		index := 0
 		entry.writeString(output, options, "\n")
 		for key, field := range entry.Blobs {
+			if hiddenBlobs[key] {
+				continue // can be filtered, the Kubernetes source is shown in its column if requested
+			}
 			if index > 0 {
 				entry.writeString(output, options, ", ")
 				entry.writeString(output, options, "\n")
@@ -108,6 +115,64 @@ func (entry LogEntry) Write(context context.Context, output io.Writer, options *
 	}
 }
 
+// Unobfuscate decrypts the obfuscated strings (!ENC!:{...}) of every string of the entry with the given keyring:
+// its header, its message, its fields, and the nested values of its blobs
+//
+// The values that cannot be decrypted are left as they are, an error tells how many there are.
+func (entry *LogEntry) Unobfuscate(keyring *Keyring) error {
+	if keyring.IsEmpty() {
+		return nil
+	}
+	failures := 0
+	unobfuscate := func(value string) string {
+		unobfuscated, err := keyring.Unobfuscate(value)
+		if err != nil {
+			failures++
+		}
+		return unobfuscated
+	}
+	for _, value := range []*string{&entry.Hostname, &entry.Name, &entry.Topic, &entry.Scope, &entry.Message} {
+		*value = unobfuscate(*value)
+	}
+	for key, value := range entry.Fields {
+		entry.Fields[key] = unobfuscateValue(value, unobfuscate)
+	}
+	for key, value := range entry.Blobs {
+		entry.Blobs[key] = unobfuscateValue(value, unobfuscate)
+	}
+	if failures > 0 {
+		return errors.ArgumentInvalid.With("obfuscated values", failures)
+	}
+	return nil
+}
+
+// unobfuscateValue decrypts the strings of the given value, and of its nested values for objects and arrays
+func unobfuscateValue(value any, unobfuscate func(string) string) any {
+	switch actual := value.(type) {
+	case string:
+		return unobfuscate(actual)
+	case map[string]any:
+		for key, nested := range actual {
+			actual[key] = unobfuscateValue(nested, unobfuscate)
+		}
+	case []any:
+		for index, nested := range actual {
+			actual[index] = unobfuscateValue(nested, unobfuscate)
+		}
+	}
+	return value
+}
+
+// hasVisibleBlobs tells if the entry has blobs that are written after its fields
+func (entry LogEntry) hasVisibleBlobs() bool {
+	for key := range entry.Blobs {
+		if !hiddenBlobs[key] {
+			return true
+		}
+	}
+	return false
+}
+
 func (entry LogEntry) writeIndent(output io.Writer, _ *OutputOptions, indent int) {
 	for i := 0; i < indent; i++ {
 		_, _ = output.Write([]byte(" "))
@@ -235,6 +300,7 @@ func (entry LogEntry) writeTimestamp(output io.Writer, options *OutputOptions) {
 
 func (entry LogEntry) writeHeader(output io.Writer, options *OutputOptions) {
 	entry.writeTimestamp(output, options)
+	entry.writeKubernetesColumn(output, options)
 	entry.Level.Write(output, options)
 
 	if options.Output == "short" {
@@ -258,6 +324,29 @@ func (entry LogEntry) writeHeader(output io.Writer, options *OutputOptions) {
 	}
 }
 
+// writeKubernetesColumn writes the namespace, pod, and container the entry was read from, if requested
+//
+// Each pod gets its own color
+func (entry LogEntry) writeKubernetesColumn(output io.Writer, options *OutputOptions) {
+	metadata, ok := entry.Blobs[KubernetesBlob].(map[string]any)
+	if !options.KubernetesColumn || !ok {
+		return
+	}
+	parts := []string{}
+	for _, key := range []string{"namespace", "pod", "container"} {
+		if value := stringify(metadata[key]); len(value) > 0 {
+			parts = append(parts, value)
+		}
+	}
+	if len(parts) == 0 {
+		return
+	}
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(stringify(metadata["pod"])))
+	entry.writeStringWithColor(output, options, strings.Join(parts, "/"), SourceColors[hash.Sum32()%uint32(len(SourceColors))])
+	entry.writeString(output, options, " ")
+}
+
 func (entry LogEntry) writeTopicAndScope(output io.Writer, options *OutputOptions) {
 	if len(entry.Topic) > 0 {
 		entry.writeStringWithColor(output, options, entry.Topic, Green)
@@ -295,6 +384,39 @@ func (entry LogEntry) writeField(output io.Writer, options *OutputOptions, field
 	}
 }
 
+// lookupPath finds the value at the given dotted path in the given map
+//
+// As keys can contain dots, the longest matching key is tried first at each level.
+func lookupPath(values map[string]any, path string) (any, bool) {
+	if value, ok := values[path]; ok {
+		return value, true
+	}
+	for index := len(path) - 1; index > 0; index-- {
+		if path[index] != '.' {
+			continue
+		}
+		if child, ok := values[path[:index]].(map[string]any); ok {
+			if value, ok := lookupPath(child, path[index+1:]); ok {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// stringify converts a literal value to a string, other values are converted to an empty string
+func stringify(value any) string {
+	switch actual := value.(type) {
+	case string:
+		return actual
+	case float64:
+		return strconv.FormatFloat(actual, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(actual)
+	}
+	return ""
+}
+
 func isLiteral(value any) bool {
 	switch value.(type) {
 	case nil, string, float64, bool:
@@ -321,6 +443,9 @@ func (entry *LogEntry) UnmarshalJSON(payload []byte) (err error) {
 	if err := json.Unmarshal(payload, &data); err != nil {
 		return err
 	}
+	if _, found := data[JournalTimestampField]; found {
+		data = journalFields(data) // from journalctl -o json or -o export
+	}
 	entry.Fields = map[string]any{}
 	entry.Blobs = map[string]any{}
 	for key, value := range data {
@@ -393,3 +518,26 @@ func (entry *LogEntry) UnmarshalJSON(payload []byte) (err error) {
 	}
 	return merr.AsError()
 }
+
+// MarshalJSON marshals this into JSON
+//
+// Fields and Blobs are written at the top level like bunyan does
+func (entry LogEntry) MarshalJSON() ([]byte, error) {
+	data := map[string]any{}
+	for key, value := range entry.Blobs {
+		data[key] = value
+	}
+	for key, value := range entry.Fields {
+		data[key] = value
+	}
+	data["time"] = entry.Time.Format(time.RFC3339Nano)
+	data["level"] = int(entry.Level)
+	data["hostname"] = entry.Hostname
+	data["name"] = entry.Name
+	data["pid"] = entry.PID
+	data["tid"] = entry.TaskID
+	data["topic"] = entry.Topic
+	data["scope"] = entry.Scope
+	data["msg"] = entry.Message
+	return json.Marshal(data)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"crypto/aes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type LogEntrySuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestLogEntrySuite(t *testing.T) {
+	suite.Run(t, new(LogEntrySuite))
+}
+
+func (suite *LogEntrySuite) SetupSuite() {
+	suite.Name = "LogEntry"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// keyring creates a keyring with the given keys
+func (suite *LogEntrySuite) keyring(keys ...string) *Keyring {
+	keyring, err := NewKeyring(suite.ctx, "test", keys)
+	suite.Require().NoError(err)
+	return keyring
+}
+
+// obfuscate obfuscates the given value with the given key
+func (suite *LogEntrySuite) obfuscate(key, value string) string {
+	obfuscated, err := suite.keyring(key).Obfuscate(value)
+	suite.Require().NoError(err)
+	return obfuscated
+}
+
+func (suite *LogEntrySuite) TestCanUnobfuscateEntry() {
+	entry := LogEntry{
+		Hostname: suite.obfuscate(oldKey, "web-1"),
+		Name:     suite.obfuscate(otherKey, "api"),
+		Topic:    suite.obfuscate(oldKey, "orders"),
+		Scope:    suite.obfuscate(oldKey, "pay"),
+		Message:  "paid by " + suite.obfuscate(oldKey, "bob"),
+		Fields:   map[string]any{"card": suite.obfuscate(oldKey, "4111"), "amount": float64(12)},
+		Blobs: map[string]any{
+			"user": map[string]any{"name": suite.obfuscate(otherKey, "bob"), "roles": []any{suite.obfuscate(oldKey, "admin"), "user"}},
+		},
+	}
+	suite.Require().NoError(entry.Unobfuscate(suite.keyring(oldKey, otherKey)))
+	suite.Assert().Equal("web-1", entry.Hostname)
+	suite.Assert().Equal("api", entry.Name)
+	suite.Assert().Equal("orders", entry.Topic)
+	suite.Assert().Equal("pay", entry.Scope)
+	suite.Assert().Equal("paid by bob", entry.Message)
+	suite.Assert().Equal(map[string]any{"card": "4111", "amount": float64(12)}, entry.Fields)
+	suite.Assert().Equal(map[string]any{"user": map[string]any{"name": "bob", "roles": []any{"admin", "user"}}}, entry.Blobs)
+}
+
+func (suite *LogEntrySuite) TestShouldCountValuesThatCannotBeUnobfuscated() {
+	unknown := suite.obfuscate(newKey, "hidden")
+	entry := LogEntry{
+		Message: unknown,
+		Fields:  map[string]any{"card": suite.obfuscate(oldKey, "4111"), "token": unknown},
+		Blobs:   map[string]any{"list": []any{unknown}},
+	}
+	err := entry.Unobfuscate(suite.keyring(oldKey))
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.ArgumentInvalid)
+	suite.Assert().Contains(err.Error(), "3")
+	suite.Assert().Equal(unknown, entry.Message, "The values that cannot be decrypted should be left as they are")
+	suite.Assert().Equal("4111", entry.Fields["card"])
+	suite.Assert().Equal(unknown, entry.Fields["token"])
+	suite.Assert().Equal([]any{unknown}, entry.Blobs["list"])
+
+	entry = LogEntry{Message: unknown}
+	suite.Require().NoError(entry.Unobfuscate(&Keyring{}), "An empty keyring should leave the entry as it is")
+	suite.Assert().Equal(unknown, entry.Message)
+	suite.Require().NoError(entry.Unobfuscate(nil))
+}
+
+func (suite *LogEntrySuite) TestCanUnobfuscateEntriesOfGoLogger() {
+	block, err := aes.NewCipher([]byte(oldKey))
+	suite.Require().NoError(err)
+	path := filepath.Join(suite.T().TempDir(), "app.log")
+	log := logger.Create("app", &logger.FileStream{Path: path, Unbuffered: true})
+	log.SetObfuscationKey(block)
+	log.Record("card", log.Obfuscate("4111")).Record("user", map[string]any{"name": log.Obfuscate("bob")}).Infof("paid by %s", log.Obfuscate("bob"))
+	log.Close()
+
+	content, err := os.ReadFile(path)
+	suite.Require().NoError(err)
+	suite.Require().Contains(string(content), "!ENC!:{")
+	suite.Require().NotContains(string(content), "bob")
+
+	var entry LogEntry
+	suite.Require().NoError(json.Unmarshal([]byte(strings.TrimSpace(string(content))), &entry))
+	suite.Require().NoError(entry.Unobfuscate(suite.keyring(otherKey, oldKey)))
+	suite.Assert().Equal("paid by bob", entry.Message)
+	suite.Assert().Equal("4111", entry.Fields["card"])
+	suite.Assert().Equal(map[string]any{"name": "bob"}, entry.Blobs["user"])
+
+	// and go-logger can decrypt what the keyring obfuscates
+	unobfuscated, err := log.Unobfuscate("paid by " + suite.obfuscate(oldKey, "bob"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal("paid by bob", unobfuscated)
+}
@@ -0,0 +1,17 @@
+package cmd
+
+import "context"
+
+type BypassLogFilter struct {
+	Level   LogLevel
+	Wrapped LogFilter
+}
+
+// NewBypassLogFilter creates a filter that lets entries at or above the given level bypass the given filter
+func NewBypassLogFilter(level LogLevel, filter LogFilter) *BypassLogFilter {
+	return &BypassLogFilter{Level: level, Wrapped: filter}
+}
+
+func (filter BypassLogFilter) Filter(context context.Context, entry LogEntry) bool {
+	return entry.Level >= filter.Level || filter.Wrapped.Filter(context, entry)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+type RateLogFilter struct {
+	Rate     float64       // The number of entries allowed per Period
+	Period   time.Duration // The period of the rate
+	Unit     string        // The unit of the period (s, m, h)
+	Output   io.Writer     // Where the dropped entries notices are written
+	Options  *OutputOptions
+	tokens   float64
+	last     time.Time // the time of the last entry
+	seen     time.Time // when the last entry was seen, to advance the clock of the entries when none comes
+	dropped  int64
+	notified time.Time
+}
+
+// NewRateLogFilter creates a filter that lets at most the given rate of entries through (like "100/s", "1000/m", or "10")
+//
+// The number of dropped entries is written periodically to the given output
+func NewRateLogFilter(rate string, output io.Writer, options *OutputOptions) (*RateLogFilter, error) {
+	count, unit, _ := strings.Cut(rate, "/")
+	value, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || value <= 0 {
+		return nil, errors.ArgumentInvalid.With("max-rate", rate)
+	}
+	unit = strings.TrimSpace(unit)
+	if len(unit) == 0 {
+		unit = "s"
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return nil, errors.ArgumentInvalid.With("max-rate", rate)
+	}
+	return &RateLogFilter{Rate: value, Period: period, Unit: unit, Output: output, Options: options, tokens: value}, nil
+}
+
+// Filter lets the entry through if the rate allows it
+//
+// The rate is measured with the time of the entries, so files and bundles are limited like live logs.
+// The entries without a time are measured with the Clock of the filter.
+func (filter *RateLogFilter) Filter(context context.Context, entry LogEntry) bool {
+	now := entry.Time
+	if now.IsZero() {
+		now = filter.Clock()
+	}
+	filter.seen = time.Now()
+	if filter.last.IsZero() {
+		filter.last = now
+	} else if now.After(filter.last) { // entries merged from several sources can go back in time a little
+		filter.tokens += now.Sub(filter.last).Seconds() / filter.Period.Seconds() * filter.Rate
+		if filter.tokens > filter.Rate {
+			filter.tokens = filter.Rate
+		}
+		filter.last = now
+	}
+
+	if filter.tokens < 1 {
+		filter.dropped++
+		if filter.notified.IsZero() {
+			filter.notified = now // the first notice comes after a Period of drops
+		}
+		filter.Notify(now, false)
+		return false
+	}
+	filter.tokens--
+	filter.Notify(now, false)
+	return true
+}
+
+// Clock gives the current time on the clock of the entries
+//
+// It is the time of the last entry, advanced by the time elapsed since it was seen, or the current time before any entry.
+func (filter *RateLogFilter) Clock() time.Time {
+	if filter.last.IsZero() {
+		return time.Now()
+	}
+	return filter.last.Add(time.Since(filter.seen))
+}
+
+// Notify writes how many entries were dropped since the last notice, at most once per Period unless forced
+//
+// now is given with the Clock of the filter.
+// When following, it must also be called periodically, as no entry may come to report the last dropped ones
+func (filter *RateLogFilter) Notify(now time.Time, force bool) {
+	if filter.dropped == 0 || filter.Output == nil || (!force && now.Sub(filter.notified) < filter.Period) {
+		return
+	}
+	notice := fmt.Sprintf("--- dropped %d entries (max rate: %g/%s) ---", filter.dropped, filter.Rate, filter.Unit)
+	if filter.Options != nil && filter.Options.UseColors {
+		notice = Gray + notice + Reset
+	}
+	_, _ = fmt.Fprintln(filter.Output, notice)
+	filter.dropped = 0
+	filter.notified = now
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type RateFilterSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestRateFilterSuite(t *testing.T) {
+	suite.Run(t, new(RateFilterSuite))
+}
+
+func (suite *RateFilterSuite) SetupSuite() {
+	suite.Name = "RateFilter"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+func (suite *RateFilterSuite) TestShouldRejectInvalidRate() {
+	for _, rate := range []string{"", "0", "-1/s", "ten/s", "10/d"} {
+		_, err := NewRateLogFilter(rate, nil, nil)
+		suite.Assert().Error(err, "Rate %q should be rejected", rate)
+	}
+}
+
+func (suite *RateFilterSuite) TestCanNotifyWithTheClockOfTheEntries() {
+	var output bytes.Buffer
+	filter, err := NewRateLogFilter("1/s", &output, nil)
+	suite.Require().NoError(err)
+
+	start := time.Now().Add(-time.Hour) // like entries replayed from a file
+	suite.Assert().True(filter.Filter(suite.ctx, LogEntry{Time: start}))
+	suite.Assert().False(filter.Filter(suite.ctx, LogEntry{Time: start.Add(100 * time.Millisecond)}))
+	suite.Assert().False(filter.Filter(suite.ctx, LogEntry{Time: start.Add(200 * time.Millisecond)}))
+
+	clock := filter.Clock()
+	suite.Assert().False(clock.Before(start.Add(200*time.Millisecond)), "The clock should start from the last entry")
+	suite.Assert().True(clock.Before(start.Add(time.Minute)), "The clock should not be the current time")
+	filter.Notify(clock, false)
+	suite.Assert().Empty(output.String(), "No notice should be written before a period of the entries")
+
+	suite.Assert().True(filter.Filter(suite.ctx, LogEntry{Time: start.Add(1500 * time.Millisecond)}))
+	suite.Assert().Equal("--- dropped 2 entries (max rate: 1/s) ---\n", output.String())
+}
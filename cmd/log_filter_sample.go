@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+)
+
+type SampleLogFilter struct {
+	Numerator   uint32
+	Denominator uint32
+	Field       string
+	counter     uint32
+}
+
+// NewSampleLogFilter creates a filter that keeps a ratio of the entries (like "1/100" or "100")
+//
+// If field is given, the sampling is based on the hash of the field value, so all entries with the same value are kept or dropped together
+func NewSampleLogFilter(ratio string, field string) (*SampleLogFilter, error) {
+	numerator, denominator := "1", ratio
+	if before, after, found := strings.Cut(ratio, "/"); found {
+		numerator, denominator = before, after
+	}
+	num, err := strconv.ParseUint(strings.TrimSpace(numerator), 10, 32)
+	if err != nil {
+		return nil, errors.ArgumentInvalid.With("sample", ratio)
+	}
+	den, err := strconv.ParseUint(strings.TrimSpace(denominator), 10, 32)
+	if err != nil || den == 0 || num > den {
+		return nil, errors.ArgumentInvalid.With("sample", ratio)
+	}
+	return &SampleLogFilter{Numerator: uint32(num), Denominator: uint32(den), Field: field}, nil
+}
+
+func (filter *SampleLogFilter) Filter(context context.Context, entry LogEntry) bool {
+	log := logger.Must(logger.FromContext(context)).Child("filter", "filter", "type", "sample")
+
+	if len(filter.Field) > 0 {
+		if value := entry.GetField(filter.Field); len(value) > 0 {
+			hash := fnv.New32a()
+			_, _ = hash.Write([]byte(value))
+			keep := hash.Sum32()%filter.Denominator < filter.Numerator
+			log.Debugf("Should %s=%s be kept? %t", filter.Field, value, keep)
+			return keep
+		}
+	}
+	keep := filter.counter%filter.Denominator < filter.Numerator
+	filter.counter++
+	return keep
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import "context"
+
+type TraceLogFilter struct {
+	ID   string
+	Keys []string
+}
+
+func NewTraceLogFilter(id string, keys []string) *TraceLogFilter {
+	return &TraceLogFilter{ID: id, Keys: keys}
+}
+
+func (filter TraceLogFilter) Filter(context context.Context, entry LogEntry) bool {
+	for _, key := range filter.Keys {
+		if entry.GetField(key) == filter.ID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/kubectl"
+	"github.com/gildas/lv/cmd/listen"
+	"golang.org/x/net/websocket"
+)
+
+// LokiQueryRangePath is the path of the Loki API that queries the log lines of a time range
+const LokiQueryRangePath = "/loki/api/v1/query_range"
+
+// LokiTailPath is the path of the Loki API that streams the log lines as they arrive, over a websocket
+const LokiTailPath = "/loki/api/v1/tail"
+
+// lokiDefaultSince is how far back the lines are queried when neither --since nor --since-time is given, like logcli
+const lokiDefaultSince = time.Hour
+
+// lokiBatchSize is the number of lines queried per request
+const lokiBatchSize = 1000
+
+// lokiQueryResponse is the response of the query_range API
+type lokiQueryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string              `json:"resultType"`
+		Result     []listen.LokiStream `json:"result"`
+	} `json:"data"`
+}
+
+// lokiTailResponse is a message of the tail API
+type lokiTailResponse struct {
+	Streams        []listen.LokiStream `json:"streams"`
+	DroppedEntries []struct {
+		Labels    map[string]string `json:"labels"`
+		Timestamp string            `json:"timestamp"`
+	} `json:"dropped_entries"`
+}
+
+// lokiLine is a line of a Loki stream, converted to a record
+type lokiLine struct {
+	Time   time.Time
+	Key    string // to skip the lines already written when paging
+	Record listen.Record
+}
+
+// queryLoki queries the lines matching the LogQL query from the Loki server and writes them to the given io.Writer output, prefixed with their labels
+//
+// The time range starts at --since or --since-time (by default, one hour ago). With --tail, only the last lines are queried.
+// When following, the lines are streamed from the tail API until the context is done.
+//
+// The credentials of the URL are sent with basic authentication, and the tenant is given by the LOKI_ORG_ID environment variable.
+func queryLoki(ctx context.Context, serverURL, query string, options *kubectl.LogsOptions, follow bool, output io.Writer) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("loki", "query")
+
+	server, err := url.Parse(serverURL)
+	if err != nil || len(server.Host) == 0 {
+		return errors.ArgumentInvalid.With("loki", serverURL)
+	}
+	header := http.Header{}
+	if server.User != nil {
+		password, _ := server.User.Password()
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(server.User.Username()+":"+password)))
+		server.User = nil
+	}
+	if orgID := os.Getenv("LOKI_ORG_ID"); len(orgID) > 0 {
+		header.Set("X-Scope-OrgID", orgID)
+	}
+
+	start := time.Now().Add(-lokiDefaultSince)
+	if options.Since > 0 {
+		start = time.Now().Add(-options.Since)
+	} else if !options.SinceTime.IsZero() {
+		start = options.SinceTime
+	}
+	log.Infof("Querying %s from %s since %s", query, server, start)
+
+	if follow {
+		return tailLoki(ctx, server, header, query, start, options.Tail, output)
+	}
+	if options.Tail > 0 {
+		lines, err := queryLokiRange(ctx, server, header, query, start, time.Now(), options.Tail, "backward")
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			writeRecord(ctx, output, line.Record)
+		}
+		return nil
+	}
+
+	end := time.Now()
+	written := map[string]bool{} // the lines of the last time already written
+	write := func(lines []lokiLine) (count int) {
+		for _, line := range lines {
+			if line.Time.Equal(start) && written[line.Key] {
+				continue
+			}
+			if !line.Time.Equal(start) {
+				start, written = line.Time, map[string]bool{}
+			}
+			written[line.Key] = true
+			writeRecord(ctx, output, line.Record)
+			count++
+		}
+		return count
+	}
+	for {
+		lines, err := queryLokiRange(ctx, server, header, query, start, end, lokiBatchSize, "forward")
+		if err != nil {
+			return err
+		}
+		if write(lines) > 0 {
+			if len(lines) < lokiBatchSize {
+				return nil
+			}
+			continue
+		}
+		if len(lines) < lokiBatchSize {
+			return nil
+		}
+		// the whole batch has the time of start, the lines of that nanosecond are queried with a larger limit before moving on
+		for limit := int64(2 * lokiBatchSize); ; limit *= 2 {
+			lines, err := queryLokiRange(ctx, server, header, query, start, start.Add(time.Nanosecond), limit, "forward")
+			if err != nil {
+				return err
+			}
+			if int64(len(lines)) < limit {
+				write(lines)
+				break
+			}
+		}
+		start, written = start.Add(time.Nanosecond), map[string]bool{}
+		if !start.Before(end) {
+			return nil
+		}
+	}
+}
+
+// queryLokiRange queries the lines of the time range, from start (inclusive) to end (exclusive), sorted by time
+func queryLokiRange(ctx context.Context, server *url.URL, header http.Header, query string, start, end time.Time, limit int64, direction string) ([]lokiLine, error) {
+	log := logger.Must(logger.FromContext(ctx)).Child("loki", "query_range")
+
+	parameters := url.Values{}
+	parameters.Set("query", query)
+	parameters.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	parameters.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	parameters.Set("limit", strconv.FormatInt(limit, 10))
+	parameters.Set("direction", direction)
+	queryURL := server.JoinPath(LokiQueryRangePath)
+	queryURL.RawQuery = parameters.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	log.Debugf("Querying %s", queryURL)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	payload, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Join(errors.FromHTTPStatusCode(res.StatusCode), fmt.Errorf("%s", strings.TrimSpace(string(payload))))
+	}
+	var response lokiQueryResponse
+	if err := json.Unmarshal(payload, &response); err != nil {
+		return nil, errors.JSONUnmarshalError.Wrap(err)
+	}
+	if response.Data.ResultType != "streams" {
+		return nil, errors.Unsupported.With("result type", response.Data.ResultType)
+	}
+	if direction == "backward" {
+		for _, stream := range response.Data.Result {
+			slices.Reverse(stream.Values)
+		}
+	}
+	return lokiLines(response.Data.Result), nil
+}
+
+// tailLoki streams the lines from the tail API until the context is done
+func tailLoki(ctx context.Context, server *url.URL, header http.Header, query string, start time.Time, limit int64, output io.Writer) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("loki", "tail")
+
+	parameters := url.Values{}
+	parameters.Set("query", query)
+	parameters.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	if limit > 0 {
+		parameters.Set("limit", strconv.FormatInt(limit, 10))
+	}
+	tailURL := server.JoinPath(LokiTailPath)
+	tailURL.RawQuery = parameters.Encode()
+	if tailURL.Scheme == "https" {
+		tailURL.Scheme = "wss"
+	} else {
+		tailURL.Scheme = "ws"
+	}
+
+	config, err := websocket.NewConfig(tailURL.String(), server.String())
+	if err != nil {
+		return err
+	}
+	config.Header = header.Clone()
+	log.Debugf("Tailing %s", tailURL)
+	conn, err := config.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	for {
+		var response lokiTailResponse
+		if err := websocket.JSON.Receive(conn, &response); err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		for _, line := range lokiLines(response.Streams) {
+			writeRecord(ctx, output, line.Record)
+		}
+		if len(response.DroppedEntries) > 0 {
+			log.Warnf("Loki dropped %d entries while tailing %s", len(response.DroppedEntries), query)
+		}
+	}
+}
+
+// lokiLines converts the lines of the streams into records, sorted by time
+func lokiLines(streams []listen.LokiStream) []lokiLine {
+	lines := []lokiLine{}
+	for _, stream := range streams {
+		for index, record := range stream.Records() {
+			entry := stream.Values[index]
+			lines = append(lines, lokiLine{Time: entry.Time, Key: record.Source + "\x00" + entry.Line, Record: record})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	return lines
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/kubectl"
+	"github.com/stretchr/testify/suite"
+)
+
+type LokiSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestLokiSuite(t *testing.T) {
+	suite.Run(t, new(LokiSuite))
+}
+
+func (suite *LokiSuite) SetupSuite() {
+	suite.Name = "Loki"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// lokiServer serves the given lines, sorted by time, with the query_range API like Loki: start is inclusive, end is exclusive
+func (suite *LokiSuite) lokiServer(times []time.Time, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		suite.Require().Equal(LokiQueryRangePath, req.URL.Path)
+		suite.Require().Equal(`{app="api"}`, req.URL.Query().Get("query"))
+		suite.Require().Equal("forward", req.URL.Query().Get("direction"))
+		start, _ := strconv.ParseInt(req.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(req.URL.Query().Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(req.URL.Query().Get("limit"))
+		*requests++
+
+		values := [][]string{}
+		for index, timestamp := range times {
+			if timestamp.UnixNano() >= start && timestamp.UnixNano() < end && len(values) < limit {
+				values = append(values, []string{strconv.FormatInt(timestamp.UnixNano(), 10), fmt.Sprintf("line %d", index)})
+			}
+		}
+		response := map[string]any{
+			"status": "success",
+			"data": map[string]any{
+				"resultType": "streams",
+				"result":     []any{map[string]any{"stream": map[string]string{"app": "api"}, "values": values}},
+			},
+		}
+		suite.Require().NoError(json.NewEncoder(res).Encode(response))
+	}))
+}
+
+func (suite *LokiSuite) query(server *httptest.Server, since time.Time) []string {
+	var output bytes.Buffer
+	err := queryLoki(suite.ctx, server.URL, `{app="api"}`, &kubectl.LogsOptions{SinceTime: since}, false, &output)
+	suite.Require().NoError(err)
+	return strings.Split(strings.TrimSpace(output.String()), "\n")
+}
+
+func (suite *LokiSuite) TestCanQueryRangeWithPaging() {
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Millisecond)
+	times := []time.Time{}
+	for index := range 2500 {
+		times = append(times, start.Add(time.Duration(index/10)*time.Millisecond)) // 10 lines per millisecond
+	}
+	requests := 0
+	server := suite.lokiServer(times, &requests)
+	defer server.Close()
+
+	lines := suite.query(server, start)
+	suite.Require().Len(lines, len(times), "Each line should be written once")
+	suite.Assert().Contains(lines[0], `"msg":"line 0"`)
+	suite.Assert().Contains(lines[len(lines)-1], `"msg":"line 2499"`)
+	suite.Assert().True(strings.HasPrefix(lines[0], "[loki:app=api] "))
+	suite.Assert().Equal(3, requests)
+}
+
+func (suite *LokiSuite) TestCanQueryRangeWhenBatchSharesTheSameTime() {
+	start := time.Now().Add(-30 * time.Minute).Truncate(time.Millisecond)
+	times := []time.Time{}
+	for range lokiBatchSize + 500 {
+		times = append(times, start)
+	}
+	for index := range 20 {
+		times = append(times, start.Add(time.Duration(index+1)*time.Millisecond))
+	}
+	requests := 0
+	server := suite.lokiServer(times, &requests)
+	defer server.Close()
+
+	lines := suite.query(server, start)
+	suite.Require().Len(lines, len(times), "The lines after a full batch of the same time should not be lost")
+	seen := map[string]bool{}
+	for _, line := range lines {
+		suite.Assert().False(seen[line], "The line %s should be written once", line)
+		seen[line] = true
+	}
+	suite.Assert().Contains(lines[len(lines)-1], fmt.Sprintf(`"msg":"line %d"`, len(times)-1))
+}
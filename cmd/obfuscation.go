@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+)
+
+// ObfuscationOptions contains the options of the obfuscation commands
+var ObfuscationOptions struct {
+	NewKey  string
+	InPlace bool
+}
+
+var obfuscationCmd = &cobra.Command{
+	Use:   "obfuscation",
+	Short: "manage the obfuscated strings of log files",
+}
+
+var obfuscationRotateCmd = &cobra.Command{
+	Use:   "rotate [flags] [file]",
+	Short: "re-encrypt the obfuscated strings of a log file under a new key",
+	Long: `Re-encrypts the obfuscated strings (!ENC!:{...}) of a log file (or stdin) under the key given with --new-key.
+The strings are decrypted with the keys of --key and --keyring, the strings that cannot be decrypted are left as they are.
+The log file is written to stdout, or replaced with --in-place.
+The keys are given as themselves, or loaded with file:<path>, env:<variable>, or cmd:<command>.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runObfuscationRotateCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(obfuscationCmd)
+	obfuscationCmd.AddCommand(obfuscationRotateCmd)
+
+	obfuscationRotateCmd.Flags().StringVar(&ObfuscationOptions.NewKey, "new-key", "", "The key to re-encrypt the obfuscated strings with: the key itself, file:<path>, env:<variable>, or cmd:<command>")
+	obfuscationRotateCmd.Flags().BoolVarP(&ObfuscationOptions.InPlace, "in-place", "i", false, "Replace the log file instead of writing it to stdout")
+	_ = obfuscationRotateCmd.MarkFlagRequired("new-key")
+}
+
+// runObfuscationRotateCommand executes the obfuscation rotate Command
+func runObfuscationRotateCommand(cmd *cobra.Command, args []string) (err error) {
+	log := logger.Must(logger.FromContext(cmd.Context())).Child("obfuscation", "rotate")
+
+	keyring, err := LoadKeyring(cmd.Context())
+	if err != nil {
+		log.Errorf("Failed to load the obfuscation keys", err)
+		return err
+	}
+	if keyring.IsEmpty() {
+		return errors.ArgumentMissing.With("key or keyring")
+	}
+	newKeyring, err := NewKeyring(cmd.Context(), "", []string{ObfuscationOptions.NewKey})
+	if err != nil {
+		log.Errorf("Failed to load the new obfuscation key", err)
+		return err
+	}
+	if ObfuscationOptions.InPlace && len(args) == 0 {
+		return errors.ArgumentMissing.With("file")
+	}
+
+	var input io.Reader = os.Stdin
+	if len(args) > 0 {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return errors.Join(fmt.Errorf("Failed to open file %s", args[0]), err)
+		}
+		defer func() { _ = file.Close() }()
+		input = file
+	}
+	if !ObfuscationOptions.InPlace {
+		rotated, failed, err := rotateObfuscation(input, os.Stdout, keyring, newKeyring)
+		reportRotation(rotated, failed)
+		return err
+	}
+
+	info, err := os.Stat(args[0])
+	if err != nil {
+		return err
+	}
+	output, err := os.CreateTemp(filepath.Dir(args[0]), "."+filepath.Base(args[0])+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(output.Name()) }() // does nothing once renamed
+	rotated, failed, err := rotateObfuscation(input, output, keyring, newKeyring)
+	if cerr := output.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Errorf("Failed to rotate the obfuscated strings of %s", args[0], err)
+		return err
+	}
+	if err = os.Chmod(output.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = os.Rename(output.Name(), args[0]); err != nil {
+		return err
+	}
+	reportRotation(rotated, failed)
+	return nil
+}
+
+// rotateObfuscation copies the lines of the input to the output with their obfuscated strings re-encrypted from keyring to newKeyring
+//
+// It returns how many strings were re-encrypted and how many could not be decrypted.
+func rotateObfuscation(input io.Reader, output io.Writer, keyring, newKeyring *Keyring) (rotated, failed int, err error) {
+	reader := bufio.NewReader(input)
+	writer := bufio.NewWriter(output)
+	for {
+		line, rerr := reader.ReadString('\n')
+		if len(line) > 0 {
+			line = obfuscatedRex.ReplaceAllStringFunc(line, func(segment string) string {
+				decrypted, err := keyring.decrypt(obfuscatedRex.FindStringSubmatch(segment)[1])
+				if err != nil {
+					failed++
+					return segment
+				}
+				obfuscated, err := newKeyring.Obfuscate(string(decrypted))
+				if err != nil {
+					failed++
+					return segment
+				}
+				rotated++
+				return obfuscated
+			})
+			if _, err = writer.WriteString(line); err != nil {
+				return rotated, failed, err
+			}
+		}
+		if errors.Is(rerr, io.EOF) {
+			return rotated, failed, writer.Flush()
+		} else if rerr != nil {
+			return rotated, failed, rerr
+		}
+	}
+}
+
+// reportRotation tells on stderr how many obfuscated strings were re-encrypted
+func reportRotation(rotated, failed int) {
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Re-encrypted %d obfuscated strings, %d could not be decrypted and were left as they are\n", rotated, failed)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Re-encrypted %d obfuscated strings\n", rotated)
+}
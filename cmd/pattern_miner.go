@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pattern represents a message template mined from log entries
+type Pattern struct {
+	Template  []string
+	Count     int64
+	Levels    map[LogLevel]int64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// PatternMiner groups similar messages into patterns (Drain-style template mining)
+//
+// Messages are tokenized, variable tokens are replaced by placeholders,
+// and messages with the same number of tokens and the same leading tokens
+// are merged into the most similar pattern if the similarity reaches the threshold.
+type PatternMiner struct {
+	Depth      int     // The number of leading tokens used to group messages
+	Similarity float64 // The minimum ratio of identical tokens to merge a message into a pattern
+	groups     map[string][]*Pattern
+	patterns   []*Pattern
+}
+
+// Wildcard is the placeholder of tokens that vary between messages of a pattern
+const Wildcard = "<*>"
+
+var variableMasks = []struct {
+	Regex       *regexp.Regexp
+	Placeholder string
+	Accept      func(value string) bool // if set, only the matches accepted by this func are replaced
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<UUID>", nil},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`), "<IP>", nil},
+	{regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){3,7}[0-9a-f]{1,4}\b`), "<IP>", nil},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<HEX>", nil},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`), "<HEX>", func(value string) bool {
+		// plain numbers are handled by <NUM>, plain words are not variables
+		return strings.ContainsAny(value, "0123456789") && strings.ContainsAny(strings.ToLower(value), "abcdef")
+	}},
+	{regexp.MustCompile(`\b\d+(?:\.\d+)?\b`), "<NUM>", nil},
+}
+
+// NewPatternMiner creates a new PatternMiner
+func NewPatternMiner(similarity float64) *PatternMiner {
+	return &PatternMiner{
+		Depth:      2,
+		Similarity: similarity,
+		groups:     map[string][]*Pattern{},
+	}
+}
+
+// Add adds the message of the given LogEntry to the best matching pattern or creates a new one
+func (miner *PatternMiner) Add(entry LogEntry) *Pattern {
+	tokens := Tokenize(entry.Message)
+	key := miner.groupKey(tokens)
+
+	var best *Pattern
+	var bestSimilarity float64
+	for _, pattern := range miner.groups[key] {
+		if similarity := pattern.similarity(tokens); similarity > bestSimilarity {
+			best, bestSimilarity = pattern, similarity
+		}
+	}
+	if best == nil || bestSimilarity < miner.Similarity {
+		best = &Pattern{
+			Template:  tokens,
+			Levels:    map[LogLevel]int64{},
+			FirstSeen: entry.Time,
+			LastSeen:  entry.Time,
+		}
+		miner.groups[key] = append(miner.groups[key], best)
+		miner.patterns = append(miner.patterns, best)
+	} else {
+		best.merge(tokens)
+	}
+	best.Count++
+	best.Levels[entry.Level]++
+	if entry.Time.Before(best.FirstSeen) {
+		best.FirstSeen = entry.Time
+	}
+	if entry.Time.After(best.LastSeen) {
+		best.LastSeen = entry.Time
+	}
+	return best
+}
+
+// Patterns returns the mined patterns, the most frequent first
+func (miner PatternMiner) Patterns() []*Pattern {
+	patterns := make([]*Pattern, len(miner.patterns))
+	copy(patterns, miner.patterns)
+	sort.SliceStable(patterns, func(i, j int) bool {
+		return patterns[i].Count > patterns[j].Count
+	})
+	return patterns
+}
+
+// Tokenize splits the message in tokens and replaces the variable ones (numbers, UUIDs, IPs, hex) with placeholders
+func Tokenize(message string) []string {
+	tokens := strings.Fields(message)
+	for index, token := range tokens {
+		for _, mask := range variableMasks {
+			if mask.Accept == nil {
+				token = mask.Regex.ReplaceAllString(token, mask.Placeholder)
+				continue
+			}
+			token = mask.Regex.ReplaceAllStringFunc(token, func(value string) string {
+				if mask.Accept(value) {
+					return mask.Placeholder
+				}
+				return value
+			})
+		}
+		tokens[index] = token
+	}
+	return tokens
+}
+
+// String returns the template of the pattern
+func (pattern Pattern) String() string {
+	return strings.Join(pattern.Template, " ")
+}
+
+func (miner PatternMiner) groupKey(tokens []string) string {
+	key := strings.Builder{}
+	key.WriteString(fmt.Sprintf("%d", len(tokens)))
+	for index := 0; index < miner.Depth && index < len(tokens); index++ {
+		key.WriteString("|")
+		if strings.ContainsAny(tokens[index], "<>0123456789") {
+			key.WriteString(Wildcard)
+		} else {
+			key.WriteString(tokens[index])
+		}
+	}
+	return key.String()
+}
+
+func (pattern Pattern) similarity(tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 1
+	}
+	same := 0
+	for index, token := range tokens {
+		if pattern.Template[index] == token || pattern.Template[index] == Wildcard {
+			same++
+		}
+	}
+	return float64(same) / float64(len(tokens))
+}
+
+func (pattern *Pattern) merge(tokens []string) {
+	for index, token := range tokens {
+		if pattern.Template[index] != token {
+			pattern.Template[index] = Wildcard
+		}
+	}
+}
+
+// Write writes the pattern with its count, time span and level distribution to the given io.Writer output
+func (pattern Pattern) Write(output io.Writer, options *OutputOptions) {
+	timestampFormat := "2006-01-02T15:04:05.000"
+	if options.Location != nil {
+		timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+	}
+	firstSeen, lastSeen := pattern.FirstSeen.UTC(), pattern.LastSeen.UTC()
+	if options.Location != nil {
+		firstSeen, lastSeen = pattern.FirstSeen.In(options.Location), pattern.LastSeen.In(options.Location)
+	}
+
+	_, _ = fmt.Fprintf(output, "%8d [%s - %s] ", pattern.Count, firstSeen.Format(timestampFormat), lastSeen.Format(timestampFormat))
+
+	levels := make([]LogLevel, 0, len(pattern.Levels))
+	for level := range pattern.Levels {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+	for index, level := range levels {
+		if index > 0 {
+			_, _ = output.Write([]byte(","))
+		}
+		if options.UseColors {
+			_, _ = output.Write([]byte(LevelColors[int(level)]))
+		}
+		_, _ = fmt.Fprintf(output, "%s=%d", level, pattern.Levels[level])
+		if options.UseColors {
+			_, _ = output.Write([]byte(Reset))
+		}
+	}
+	_, _ = output.Write([]byte(": "))
+	if options.UseColors {
+		_, _ = output.Write([]byte(Cyan))
+	}
+	_, _ = output.Write([]byte(pattern.String()))
+	if options.UseColors {
+		_, _ = output.Write([]byte(Reset))
+	}
+}
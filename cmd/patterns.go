@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-logger"
+	"github.com/spf13/cobra"
+)
+
+// PatternsOptions contains the options of the patterns command
+var PatternsOptions struct {
+	After      string
+	Similarity float64
+}
+
+var patternsCmd = &cobra.Command{
+	Use:   "patterns [flags] [file]",
+	Short: "group similar log messages into patterns",
+	Long: `Groups similar log messages into patterns by replacing their variable parts (numbers, UUIDs, IP addresses, hexadecimal values) with placeholders.
+Each pattern is listed with its count, the time it was first and last seen, and its level distribution.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPatternsCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(patternsCmd)
+
+	patternsCmd.Flags().StringVar(&PatternsOptions.After, "after", "", "Only shows patterns first seen after the given time (RFC3339) or duration ago (like 5m, 2h)")
+	patternsCmd.Flags().Float64Var(&PatternsOptions.Similarity, "similarity", 0.5, "Minimum ratio of identical tokens for a message to join a pattern (between 0 and 1)")
+}
+
+// runPatternsCommand executes the patterns Command
+func runPatternsCommand(cmd *cobra.Command, args []string) (err error) {
+	log := logger.Must(logger.FromContext(cmd.Context())).Child("patterns", "run")
+
+	if err = initializeOutputOptions(cmd); err != nil {
+		return err
+	}
+
+	var after time.Time
+	if len(PatternsOptions.After) > 0 {
+		if after, err = ParseTime(PatternsOptions.After); err != nil {
+			log.Errorf("Failed to parse time %s", PatternsOptions.After, err)
+			return err
+		}
+	}
+
+	reader, closeInput, err := openInput(cmd, args)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	miner := NewPatternMiner(PatternsOptions.Similarity)
+	err = readEntries(cmd.Context(), reader, func(entry LogEntry) {
+		miner.Add(entry)
+	})
+	if err != nil {
+		log.Fatalf("Failed to read from input", err)
+		return err
+	}
+
+	for _, pattern := range miner.Patterns() {
+		if !after.IsZero() && !pattern.FirstSeen.After(after) {
+			continue
+		}
+		output := strings.Builder{}
+		pattern.Write(&output, &CmdOptions.OutputOptions)
+		_, _ = fmt.Fprintln(os.Stdout, output.String())
+	}
+	return nil
+}
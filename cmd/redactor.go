@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gildas/go-errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// RedactionProfile describes how the log entries are redacted with --redact, the profiles are configured in redact.<name>
+type RedactionProfile struct {
+	Drop       []string `json:"drop"       yaml:"drop"`       // The paths of the fields to remove (e.g. password, user.ssn)
+	Hash       []string `json:"hash"       yaml:"hash"`       // The paths of the fields whose value is replaced (e.g. user.email, client.ip)
+	Masks      []string `json:"masks"      yaml:"masks"`      // The regular expressions (or built-in masks) replaced in the message, the fields, and the blobs
+	Pseudonyms bool     `json:"pseudonyms" yaml:"pseudonyms"` // Replaces the values with consistent pseudonyms (e.g. email-3fa85f64) instead of ***
+	Salt       string   `json:"salt"       yaml:"salt"`       // The salt of the pseudonyms, to get the same pseudonyms from one run to another (random by default)
+}
+
+// Redactor removes or replaces the personal data of the log entries, as described by a RedactionProfile
+type Redactor struct {
+	Name       string
+	drop       []string
+	hash       []string
+	masks      []redactionMask
+	pseudonyms bool
+	salt       []byte
+}
+
+// redactionMask is a regular expression whose matches are replaced, or only the match of its first group if it has one
+type redactionMask struct {
+	name  string // the prefix of the pseudonyms
+	regex *regexp.Regexp
+	check func(match string) bool // if set, the matches it rejects are kept
+}
+
+// RedactionMasks are the built-in masks that can be used in the masks of the redaction profiles
+var RedactionMasks = map[string]redactionMask{
+	"email": {name: "email", regex: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	"ip": {name: "ip", regex: regexp.MustCompile(
+		`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b` + // IPv4
+			`|(?i:\b(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|\b(?:[0-9a-f]{1,4}:){1,6}:(?:[0-9a-f]{1,4}(?::[0-9a-f]{1,4}){0,5})?\b)`, // IPv6
+	)},
+	"card":  {name: "card", regex: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), check: isLuhnValid},
+	"token": {name: "token", regex: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/=-]+)|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*|\b(?:sk|pk|rk)_(?:live|test)_[A-Za-z0-9]{10,}\b|\bgh[pousr]_[A-Za-z0-9]{20,}\b|\bxox[abpr]-[A-Za-z0-9-]{10,}\b`)},
+}
+
+// RedactedValue replaces the redacted values when the profile does not use pseudonyms
+const RedactedValue = "***"
+
+// NewRedactor creates a new Redactor with the profile configured in redact.<name>
+func NewRedactor(name string) (*Redactor, error) {
+	if !viper.IsSet("redact." + name) {
+		return nil, errors.NotFound.With("redaction profile", name)
+	}
+	var profile RedactionProfile
+	if err := viper.UnmarshalKey("redact."+name, &profile); err != nil {
+		return nil, errors.Join(fmt.Errorf("Invalid redaction profile %s", name), err)
+	}
+	redactor := &Redactor{Name: name, drop: profile.Drop, hash: profile.Hash, pseudonyms: profile.Pseudonyms, salt: []byte(profile.Salt)}
+	for _, mask := range profile.Masks {
+		if builtin, found := RedactionMasks[mask]; found {
+			redactor.masks = append(redactor.masks, builtin)
+			continue
+		}
+		regex, err := regexp.Compile(mask)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("Invalid mask %s in redaction profile %s", mask, name), err)
+		}
+		redactor.masks = append(redactor.masks, redactionMask{name: "redacted", regex: regex})
+	}
+	if len(redactor.salt) == 0 {
+		redactor.salt = make([]byte, 32)
+		if _, err := rand.Read(redactor.salt); err != nil {
+			return nil, err
+		}
+	}
+	return redactor, nil
+}
+
+// RedactionProfiles gets the names of the redaction profiles of the configuration, sorted
+func RedactionProfiles() []string {
+	profiles := []string{}
+	for name := range viper.GetStringMap("redact") {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// validRedactArgs completes the --redact flag with the redaction profiles of the configuration
+func validRedactArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return RedactionProfiles(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// Redact removes the fields to drop of the entry, replaces the values of the fields to hash, and masks the strings of its header, message, fields, and blobs
+//
+// The paths can be the header fields (hostname, name, topic, scope, msg), fields, or nested values of the blobs (e.g. user.email).
+func (redactor *Redactor) Redact(entry *LogEntry) {
+	if redactor == nil {
+		return
+	}
+	header := map[string]*string{"hostname": &entry.Hostname, "name": &entry.Name, "topic": &entry.Topic, "scope": &entry.Scope, "msg": &entry.Message}
+
+	for _, path := range redactor.drop {
+		if value, found := header[path]; found {
+			*value = ""
+		} else if !deletePath(entry.Fields, path) {
+			deletePath(entry.Blobs, path)
+		}
+	}
+	for _, path := range redactor.hash {
+		kind := path[strings.LastIndex(path, ".")+1:]
+		replace := func(value any) any {
+			if value == nil {
+				return nil
+			}
+			if text, ok := value.(string); ok {
+				return redactor.replacement(kind, text)
+			}
+			return redactor.replacement(kind, fmt.Sprint(value))
+		}
+		if value, found := header[path]; found {
+			if len(*value) > 0 {
+				*value = redactor.replacement(kind, *value)
+			}
+		} else if !updatePath(entry.Fields, path, replace) {
+			updatePath(entry.Blobs, path, replace)
+		}
+	}
+	if len(redactor.masks) == 0 {
+		return
+	}
+	for _, value := range header {
+		*value = redactor.RedactText(*value)
+	}
+	for key, value := range entry.Fields {
+		entry.Fields[key] = redactValue(value, redactor.RedactText)
+	}
+	for key, value := range entry.Blobs {
+		entry.Blobs[key] = redactValue(value, redactor.RedactText)
+	}
+}
+
+// RedactText replaces the matches of the masks in the given text, like the lines that are not log entries
+func (redactor *Redactor) RedactText(text string) string {
+	if redactor == nil {
+		return text
+	}
+	for _, mask := range redactor.masks {
+		text = mask.regex.ReplaceAllStringFunc(text, func(match string) string {
+			if mask.check != nil && !mask.check(match) {
+				return match
+			}
+			if groups := mask.regex.FindStringSubmatchIndex(match); len(groups) > 3 && groups[2] >= 0 {
+				return match[:groups[2]] + redactor.replacement(mask.name, match[groups[2]:groups[3]]) + match[groups[3]:]
+			}
+			return redactor.replacement(mask.name, match)
+		})
+	}
+	return text
+}
+
+// replacement gets the value that replaces the given value: its pseudonym (the same for the same value), or ***
+func (redactor *Redactor) replacement(kind, value string) string {
+	if !redactor.pseudonyms {
+		return RedactedValue
+	}
+	mac := hmac.New(sha256.New, redactor.salt)
+	mac.Write([]byte(value))
+	return kind + "-" + hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// redactValue masks the strings of the given value, and of its nested values for objects and arrays
+func redactValue(value any, redact func(string) string) any {
+	switch actual := value.(type) {
+	case string:
+		return redact(actual)
+	case map[string]any:
+		for key, nested := range actual {
+			actual[key] = redactValue(nested, redact)
+		}
+	case []any:
+		for index, nested := range actual {
+			actual[index] = redactValue(nested, redact)
+		}
+	}
+	return value
+}
+
+// deletePath removes the value at the given dotted path, false if there is none
+func deletePath(values map[string]any, path string) bool {
+	return updatePath(values, path, nil)
+}
+
+// updatePath replaces the value at the given dotted path with the result of update, or removes it if update is nil
+//
+// Like lookupPath, the keys can contain dots. It returns false if there is no value at the path.
+func updatePath(values map[string]any, path string, update func(value any) any) bool {
+	if value, ok := values[path]; ok {
+		if update == nil {
+			delete(values, path)
+		} else {
+			values[path] = update(value)
+		}
+		return true
+	}
+	for index := len(path) - 1; index > 0; index-- {
+		if path[index] != '.' {
+			continue
+		}
+		if child, ok := values[path[:index]].(map[string]any); ok {
+			if updatePath(child, path[index+1:], update) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLuhnValid tells if the digits of the given number pass the Luhn checksum of the card numbers
+func isLuhnValid(number string) bool {
+	sum, count := 0, 0
+	for index := len(number) - 1; index >= 0; index-- {
+		digit := number[index]
+		if digit < '0' || digit > '9' {
+			continue
+		}
+		value := int(digit - '0')
+		if count%2 == 1 {
+			if value *= 2; value > 9 {
+				value -= 9
+			}
+		}
+		sum += value
+		count++
+	}
+	return count >= 13 && sum%10 == 0
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/remote"
+)
+
+// remoteReader reads the lines of a remote object
+//
+// The object is opened only while its lines are read, a remotePool closes the objects read the least recently.
+type remoteReader struct {
+	Source string
+	Since  time.Time // the lines before are skipped
+	Line   []byte    // the current line, nil at the end of the object
+	Time   time.Time // the time of the current line, or of the last line that had one
+	object *remote.Object
+	offset int64 // the offset of the object where the reading started
+	read   int64 // the number of bytes of the content read from offset
+	reader *bufio.Reader
+	closer io.Closer
+	start  bool // true once a line at or after Since was read
+}
+
+// remotePool keeps at most max objects opened, the objects read the least recently are closed first
+type remotePool struct {
+	max  int
+	open []*remoteReader // from the least to the most recently read
+}
+
+// remoteMaxOpen is the maximum number of remote objects opened at once
+const remoteMaxOpen = 16
+
+// streamRemote reads the objects at the given URL (an HTTP(S) URL, or an S3 URL with globs) and writes their lines to the given io.Writer output
+//
+// The objects compressed with gzip or bzip2 are decompressed.
+// With several objects, their lines are merged by time and prefixed with their object (e.g. [s3:bucket/logs/api.log]).
+// If since is not zero, the lines before are skipped, the uncompressed objects are seeked with range requests instead of being read from their start.
+func streamRemote(ctx context.Context, rawURL string, since time.Time, output io.Writer) error {
+	objects, err := remote.List(ctx, rawURL)
+	if err != nil {
+		return err
+	}
+	return mergeRemote(ctx, objects, since, &remotePool{max: remoteMaxOpen}, output)
+}
+
+// mergeRemote merges the lines of the given objects by time and writes them to the given io.Writer output
+//
+// At most pool.max objects are opened at once, the other ones are opened again where their reading stopped when their lines are needed.
+func mergeRemote(ctx context.Context, objects []*remote.Object, since time.Time, pool *remotePool, output io.Writer) error {
+	log := logger.Must(logger.FromContext(ctx)).Child("remote", "stream")
+
+	defer pool.Close()
+	readers := make([]*remoteReader, 0, len(objects))
+	for _, object := range objects {
+		readers = append(readers, newRemoteReader(ctx, object, since))
+	}
+	prefix := len(readers) > 1
+	next := func(reader *remoteReader) error {
+		if err := pool.Use(ctx, reader); err != nil {
+			log.Errorf("Failed to open %s", reader.object.URL, err)
+			return err
+		}
+		if err := reader.Next(); err != nil {
+			return err
+		}
+		if reader.Line == nil {
+			pool.Release(reader)
+		}
+		return nil
+	}
+
+	for _, reader := range readers {
+		if err := next(reader); err != nil {
+			return err
+		}
+	}
+	for {
+		var selected *remoteReader
+		for _, reader := range readers {
+			if reader.Line != nil && (selected == nil || reader.Time.Before(selected.Time)) {
+				selected = reader
+			}
+		}
+		if selected == nil {
+			return nil
+		}
+		if prefix {
+			_, _ = fmt.Fprintf(output, "[%s] %s\n", selected.Source, selected.Line)
+		} else {
+			_, _ = fmt.Fprintf(output, "%s\n", selected.Line)
+		}
+		if err := next(selected); err != nil {
+			return err
+		}
+	}
+}
+
+// newRemoteReader creates a remoteReader for reading the lines of the given object from since
+//
+// The object is seeked, but not opened yet.
+func newRemoteReader(ctx context.Context, object *remote.Object, since time.Time) *remoteReader {
+	log := logger.Must(logger.FromContext(ctx)).Child("remote", "open")
+
+	var offset int64
+	if !since.IsZero() {
+		var err error
+		if offset, err = object.Seek(ctx, since, lineTime); err != nil {
+			log.Warnf("Failed to seek %s, reading it from its start: %s", object.URL, err)
+			offset = 0
+		}
+		log.Debugf("Reading %s from offset %d for the lines since %s", object.URL, offset, since)
+	}
+	return &remoteReader{Source: object.Source(), Since: since, object: object, offset: offset, start: since.IsZero()}
+}
+
+// Use opens the given reader if it is closed, after closing the reader read the least recently if max readers are opened
+func (pool *remotePool) Use(ctx context.Context, reader *remoteReader) error {
+	if index := slices.Index(pool.open, reader); index >= 0 {
+		pool.open = append(slices.Delete(pool.open, index, index+1), reader)
+		return nil
+	}
+	for len(pool.open) >= max(pool.max, 1) {
+		pool.Release(pool.open[0])
+	}
+	if err := reader.Open(ctx); err != nil {
+		return err
+	}
+	pool.open = append(pool.open, reader)
+	return nil
+}
+
+// Release closes the given reader, Use opens it again where its reading stopped
+func (pool *remotePool) Release(reader *remoteReader) {
+	if index := slices.Index(pool.open, reader); index >= 0 {
+		pool.open = slices.Delete(pool.open, index, index+1)
+	}
+	reader.Close()
+}
+
+// Close closes all the opened readers
+func (pool *remotePool) Close() {
+	for _, reader := range pool.open {
+		reader.Close()
+	}
+	pool.open = nil
+}
+
+// Open opens the object where its reading stopped
+//
+// A compressed object cannot be seeked, it is decompressed again from its start and the content read before is skipped.
+func (reader *remoteReader) Open(ctx context.Context) error {
+	offset, skip := reader.offset+reader.read, int64(0)
+	if reader.offset == 0 && reader.read > 0 { // the compressed objects are never seeked
+		compressed, err := reader.object.IsCompressed(ctx)
+		if err != nil {
+			return err
+		}
+		if compressed {
+			offset, skip = 0, reader.read
+		}
+	}
+	body, err := reader.object.Open(ctx, offset)
+	if err != nil {
+		return err
+	}
+	content, err := remote.Decompress(body)
+	if err != nil {
+		_ = body.Close()
+		return errors.Join(fmt.Errorf("Failed to decompress %s", reader.object.URL), err)
+	}
+	if skip > 0 {
+		if _, err := io.CopyN(io.Discard, content, skip); err != nil {
+			_ = body.Close()
+			return err
+		}
+	}
+	reader.reader, reader.closer = bufio.NewReaderSize(content, 64*1024), body
+	if reader.offset > 0 && reader.read == 0 {
+		partial, _ := reader.reader.ReadBytes('\n') // the line at offset is partial
+		reader.read += int64(len(partial))
+	}
+	return nil
+}
+
+// Close closes the object, Open opens it again where its reading stopped
+func (reader *remoteReader) Close() {
+	if reader.closer != nil {
+		_ = reader.closer.Close()
+	}
+	reader.reader, reader.closer = nil, nil
+}
+
+// Next reads the next line, Line is nil at the end of the object
+//
+// The lines without a time get the time of the previous line, to stay with it when merging
+func (reader *remoteReader) Next() error {
+	for {
+		line, err := reader.reader.ReadBytes('\n')
+		reader.read += int64(len(line))
+		if len(line) == 0 && err != nil {
+			reader.Line = nil
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		line = trimEOL(line)
+		if timestamp, ok := lineTime(line); ok {
+			reader.Time = timestamp
+		}
+		if !reader.start {
+			if reader.Time.Before(reader.Since) {
+				continue
+			}
+			reader.start = true
+		}
+		reader.Line = line
+		return nil
+	}
+}
+
+// lineTime gets the time of the log entry of a line, false if the line is not a log entry or has no time
+func lineTime(line []byte) (time.Time, bool) {
+	var entry LogEntry
+
+	_, payload := SplitSourcePrefix(line)
+	_ = json.Unmarshal(payload, &entry)
+	return entry.Time, !entry.Time.IsZero()
+}
+
+// trimEOL removes the end of line of the given line
+func trimEOL(line []byte) []byte {
+	if length := len(line); length > 0 && line[length-1] == '\n' {
+		line = line[:length-1]
+		if length > 1 && line[length-2] == '\r' {
+			line = line[:length-2]
+		}
+	}
+	return line
+}
@@ -0,0 +1,181 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gildas/go-errors"
+)
+
+// Object is a remote file: an HTTP(S) URL or an object of an S3 compatible bucket
+type Object struct {
+	URL  string // the URL of the object (e.g. https://host/file.log, s3://bucket/key)
+	Size int64  // the size of the object, -1 if unknown
+
+	newRequest func(ctx context.Context, header http.Header) (*http.Request, error)
+}
+
+// IsRemote tells if the given path is the URL of a remote file (http://, https://, or s3://)
+func IsRemote(path string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if len(path) > len(scheme) && strings.EqualFold(path[:len(scheme)], scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// List gets the objects at the given URL
+//
+// The key of an S3 URL can contain globs (e.g. s3://bucket/logs/*.log), the matching objects are found by listing the prefix before the first glob, sorted by key.
+func List(ctx context.Context, rawURL string) ([]*Object, error) {
+	address, err := url.Parse(rawURL)
+	if err != nil || len(address.Host) == 0 {
+		return nil, errors.ArgumentInvalid.With("url", rawURL)
+	}
+	switch strings.ToLower(address.Scheme) {
+	case "http", "https":
+		return []*Object{newHTTPObject(ctx, address)}, nil
+	case "s3":
+		return NewS3Client().List(ctx, address.Host, strings.TrimPrefix(address.Path, "/"))
+	}
+	return nil, errors.Unsupported.With("scheme", address.Scheme)
+}
+
+// Source gets the source of the object, as written before its lines when several objects are read (e.g. s3:bucket/key)
+func (object Object) Source() string {
+	return strings.NewReplacer("s3://", "s3:", " ", "%20", "]", "%5D").Replace(object.URL)
+}
+
+// Open opens the object from the given offset, until its end
+//
+// A range request is sent when offset is not 0. If the server does not support them, the bytes before offset are skipped.
+func (object Object) Open(ctx context.Context, offset int64) (io.ReadCloser, error) {
+	return object.OpenRange(ctx, offset, -1)
+}
+
+// OpenRange opens length bytes of the object from the given offset, or until its end if length is negative
+func (object Object) OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if length >= 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	req, err := object.newRequest(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		return res.Body, nil
+	case http.StatusOK:
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, res.Body, offset); err != nil {
+				_ = res.Body.Close()
+				return nil, err
+			}
+		}
+		if length >= 0 {
+			return readCloser{io.LimitReader(res.Body, length), res.Body}, nil
+		}
+		return res.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		_ = res.Body.Close()
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	defer func() { _ = res.Body.Close() }()
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return nil, errors.Join(errors.FromHTTPStatusCode(res.StatusCode), fmt.Errorf("%s: %s", object.URL, strings.TrimSpace(string(message))))
+}
+
+// IsCompressed tells if the object is compressed with gzip or bzip2, by reading its first bytes
+func (object Object) IsCompressed(ctx context.Context) (bool, error) {
+	reader, err := object.OpenRange(ctx, 0, 4)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = reader.Close() }()
+	magic, err := io.ReadAll(reader)
+	if err != nil {
+		return false, err
+	}
+	return isGzip(magic) || isBzip2(magic), nil
+}
+
+// Decompress gets a reader that decompresses the given reader if it is compressed with gzip or bzip2
+//
+// The compression is detected with the first bytes of the content, the reader is returned as is if it is not compressed.
+func Decompress(reader io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(reader)
+	magic, err := buffered.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	switch {
+	case isGzip(magic):
+		return gzip.NewReader(buffered)
+	case isBzip2(magic):
+		return bzip2.NewReader(buffered), nil
+	}
+	return buffered, nil
+}
+
+func isGzip(magic []byte) bool {
+	return len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+func isBzip2(magic []byte) bool {
+	return len(magic) >= 3 && string(magic[:3]) == "BZh"
+}
+
+// readCloser reads from a reader and closes a closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// newHTTPObject creates the Object of an HTTP(S) URL, its size is given by a HEAD request if the server answers it
+//
+// The credentials of the URL are sent with basic authentication.
+func newHTTPObject(ctx context.Context, address *url.URL) *Object {
+	var user *url.Userinfo
+	user, address.User = address.User, nil
+	object := &Object{URL: address.String(), Size: -1}
+	object.newRequest = func(ctx context.Context, header http.Header) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, object.URL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if user != nil {
+			password, _ := user.Password()
+			req.SetBasicAuth(user.Username(), password)
+		}
+		return req, nil
+	}
+	if req, err := object.newRequest(ctx, http.Header{}); err == nil {
+		req.Method = http.MethodHead
+		if res, err := http.DefaultClient.Do(req); err == nil {
+			_ = res.Body.Close()
+			if res.StatusCode == http.StatusOK && res.Header.Get("Content-Encoding") == "" {
+				object.Size = res.ContentLength
+			}
+		}
+	}
+	return object
+}
@@ -0,0 +1,174 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-errors"
+	"github.com/gildas/go-logger"
+	"github.com/stretchr/testify/suite"
+)
+
+type RemoteSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestRemoteSuite(t *testing.T) {
+	suite.Run(t, new(RemoteSuite))
+}
+
+func (suite *RemoteSuite) SetupSuite() {
+	suite.Name = "Remote"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// fakeServer serves a content, with or without range requests, and records the ranges it was asked for
+type fakeServer struct {
+	content []byte
+	ranges  bool
+	asked   []string
+	lock    sync.Mutex
+}
+
+func (server *fakeServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet {
+		server.lock.Lock()
+		server.asked = append(server.asked, req.Header.Get("Range"))
+		server.lock.Unlock()
+	}
+	if server.ranges {
+		http.ServeContent(res, req, "file.log", time.Time{}, bytes.NewReader(server.content))
+		return
+	}
+	res.Header().Set("Content-Length", fmt.Sprint(len(server.content)))
+	_, _ = res.Write(server.content)
+}
+
+// object serves the given content and gets its Object
+func (suite *RemoteSuite) object(content []byte, ranges bool) (*Object, *fakeServer) {
+	server := &fakeServer{content: content, ranges: ranges}
+	httpServer := httptest.NewServer(server)
+	suite.T().Cleanup(httpServer.Close)
+	address, err := url.Parse(httpServer.URL + "/file.log")
+	suite.Require().NoError(err)
+	return newHTTPObject(suite.ctx, address), server
+}
+
+// read reads all the content of the given reader and closes it
+func (suite *RemoteSuite) read(reader io.ReadCloser, err error) string {
+	suite.Require().NoError(err)
+	defer func() { _ = reader.Close() }()
+	content, err := io.ReadAll(reader)
+	suite.Require().NoError(err)
+	return string(content)
+}
+
+// timedLines creates count lines that start with their time, one second apart from start
+func timedLines(start time.Time, count int) []byte {
+	var content bytes.Buffer
+	for index := range count {
+		fmt.Fprintf(&content, "%s line %06d\n", start.Add(time.Duration(index)*time.Second).Format(time.RFC3339), index)
+	}
+	return content.Bytes()
+}
+
+// timeOf gets the time at the start of a line created by timedLines
+func timeOf(line []byte) (time.Time, bool) {
+	text, _, _ := strings.Cut(string(line), " ")
+	timestamp, err := time.Parse(time.RFC3339, text)
+	return timestamp, err == nil
+}
+
+func (suite *RemoteSuite) TestCanOpenRangeWithRangeRequests() {
+	object, server := suite.object([]byte("0123456789abcdef"), true)
+	suite.Assert().Equal(int64(16), object.Size)
+
+	suite.Assert().Equal("6789a", suite.read(object.OpenRange(suite.ctx, 6, 5)))
+	suite.Assert().Equal("abcdef", suite.read(object.Open(suite.ctx, 10)))
+	suite.Assert().Equal("0123456789abcdef", suite.read(object.Open(suite.ctx, 0)))
+	suite.Assert().Empty(suite.read(object.Open(suite.ctx, 16)), "Reading past the end should give nothing")
+	suite.Assert().Equal([]string{"bytes=6-10", "bytes=10-", "", "bytes=16-"}, server.asked)
+}
+
+func (suite *RemoteSuite) TestCanOpenRangeWithoutRangeSupport() {
+	object, server := suite.object([]byte("0123456789abcdef"), false)
+
+	suite.Assert().Equal("6789a", suite.read(object.OpenRange(suite.ctx, 6, 5)))
+	suite.Assert().Equal("abcdef", suite.read(object.Open(suite.ctx, 10)))
+	suite.Assert().Equal([]string{"bytes=6-10", "bytes=10-"}, server.asked, "The ranges should still be asked")
+
+	_, err := object.Open(suite.ctx, 32)
+	suite.Assert().Error(err, "Skipping past the end should fail")
+}
+
+func (suite *RemoteSuite) TestShouldFailWithHTTPError() {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "no such file", http.StatusNotFound)
+	}))
+	defer server.Close()
+	objects, err := List(suite.ctx, server.URL+"/missing.log")
+	suite.Require().NoError(err)
+	suite.Require().Len(objects, 1)
+
+	_, err = objects[0].Open(suite.ctx, 0)
+	suite.Require().Error(err)
+	suite.Assert().ErrorIs(err, errors.HTTPNotFound)
+	suite.Assert().Contains(err.Error(), "no such file")
+}
+
+func (suite *RemoteSuite) TestCanSeek() {
+	start := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	content := timedLines(start, 20000) // about 20 probes
+	since := start.Add(12345 * time.Second)
+	position := int64(bytes.Index(content, []byte(since.Format(time.RFC3339))))
+
+	object, server := suite.object(content, true)
+	offset, err := object.Seek(suite.ctx, since, timeOf)
+	suite.Require().NoError(err)
+	suite.Assert().Positive(offset)
+	suite.Assert().LessOrEqual(offset, position, "The lines since should not be skipped")
+	suite.Assert().LessOrEqual(position-offset, int64(2*SeekProbeSize), "The offset should be close to the lines since")
+	suite.Assert().Less(len(server.asked), 20)
+
+	offset, err = object.Seek(suite.ctx, start.Add(-time.Hour), timeOf)
+	suite.Require().NoError(err)
+	suite.Assert().Zero(offset, "All the lines are after since")
+}
+
+func (suite *RemoteSuite) TestShouldNotSeekCompressedObjects() {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write(timedLines(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), 20000))
+	suite.Require().NoError(writer.Close())
+	suite.Require().Greater(compressed.Len(), SeekProbeSize)
+
+	object, _ := suite.object(compressed.Bytes(), true)
+	isCompressed, err := object.IsCompressed(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Assert().True(isCompressed)
+	offset, err := object.Seek(suite.ctx, time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC), timeOf)
+	suite.Require().NoError(err)
+	suite.Assert().Zero(offset)
+
+	body, err := object.Open(suite.ctx, 0)
+	suite.Require().NoError(err)
+	defer func() { _ = body.Close() }()
+	content, err := Decompress(body)
+	suite.Require().NoError(err)
+	first, err := bufio.NewReader(content).ReadString('\n')
+	suite.Require().NoError(err)
+	suite.Assert().Equal("2026-10-18T00:00:00Z line 000000\n", first)
+}
@@ -0,0 +1,260 @@
+package remote
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gildas/go-errors"
+)
+
+// S3Client reads the objects of S3 compatible buckets (AWS S3, MinIO, ...)
+//
+// Its configuration comes from the standard AWS environment variables:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN for the credentials (anonymous requests without them),
+// AWS_REGION or AWS_DEFAULT_REGION for the region (us-east-1 by default),
+// and AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL for another endpoint than AWS (like MinIO, which is then addressed with path-style URLs).
+type S3Client struct {
+	Endpoint        *url.URL // nil for AWS S3
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// s3EmptyPayloadHash is the SHA256 of an empty payload, the requests of the S3Client have no payload
+const s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3ListResult is the response of ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// NewS3Client creates a new S3Client configured with the AWS environment variables
+func NewS3Client() *S3Client {
+	client := &S3Client{
+		Region:          firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if len(client.Region) == 0 {
+		client.Region = "us-east-1"
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); len(endpoint) > 0 {
+		if address, err := url.Parse(endpoint); err == nil && len(address.Host) > 0 {
+			client.Endpoint = address
+		}
+	}
+	return client
+}
+
+// List gets the objects of the bucket that match the given key
+//
+// If the key contains globs (*, ?, [...]), the objects are listed from the prefix before the first glob and their keys are matched with path.Match.
+func (client *S3Client) List(ctx context.Context, bucket, key string) ([]*Object, error) {
+	globAt := strings.IndexAny(key, "*?[")
+	if globAt < 0 {
+		object := client.newObject(bucket, key, -1)
+		if req, err := client.newRequest(ctx, http.MethodHead, bucket, key, nil, nil); err == nil {
+			if res, err := http.DefaultClient.Do(req); err == nil {
+				_ = res.Body.Close()
+				if res.StatusCode == http.StatusOK {
+					object.Size = res.ContentLength
+				}
+			}
+		}
+		return []*Object{object}, nil
+	}
+	if _, err := path.Match(key, ""); err != nil {
+		return nil, errors.ArgumentInvalid.With("key", key)
+	}
+
+	objects := []*Object{}
+	parameters := url.Values{"list-type": {"2"}, "prefix": {key[:globAt]}}
+	for {
+		req, err := client.newRequest(ctx, http.MethodGet, bucket, "", parameters, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		payload, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, errors.Join(errors.FromHTTPStatusCode(res.StatusCode), fmt.Errorf("s3://%s/%s: %s", bucket, key, strings.TrimSpace(string(payload))))
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal(payload, &result); err != nil {
+			return nil, err
+		}
+		for _, content := range result.Contents {
+			if matched, _ := path.Match(key, content.Key); matched {
+				objects = append(objects, client.newObject(bucket, content.Key, content.Size))
+			}
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			break
+		}
+		parameters.Set("continuation-token", result.NextContinuationToken)
+	}
+	if len(objects) == 0 {
+		return nil, errors.NotFound.With("object", fmt.Sprintf("s3://%s/%s", bucket, key))
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].URL < objects[j].URL })
+	return objects, nil
+}
+
+// newObject creates the Object of the given key
+func (client *S3Client) newObject(bucket, key string, size int64) *Object {
+	return &Object{
+		URL:  fmt.Sprintf("s3://%s/%s", bucket, key),
+		Size: size,
+		newRequest: func(ctx context.Context, header http.Header) (*http.Request, error) {
+			return client.newRequest(ctx, http.MethodGet, bucket, key, nil, header)
+		},
+	}
+}
+
+// newRequest creates a request on the bucket (or on the key of the bucket), signed with AWS Signature Version 4 if the client has credentials
+func (client *S3Client) newRequest(ctx context.Context, method, bucket, key string, parameters url.Values, header http.Header) (*http.Request, error) {
+	address := &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, client.Region), Path: "/" + key}
+	if client.Endpoint != nil {
+		address = client.Endpoint.JoinPath(bucket, key)
+		if len(key) == 0 {
+			address.Path = strings.TrimSuffix(address.Path, "/")
+		}
+	}
+	address.RawPath = s3Escape(address.Path, false)
+	address.RawQuery = s3CanonicalQuery(parameters)
+
+	req, err := http.NewRequestWithContext(ctx, method, address.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if len(client.AccessKeyID) > 0 {
+		client.sign(req, time.Now().UTC())
+	}
+	return req, nil
+}
+
+// sign signs the request with AWS Signature Version 4
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (client *S3Client) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format("20060102"), client.Region)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3EmptyPayloadHash)
+	if len(client.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", client.SessionToken)
+	}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		s3EmptyPayloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + client.SecretAccessKey)
+	for _, part := range []string{now.Format("20060102"), client.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", client.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape escapes the given value like AWS Signature Version 4 wants, the slashes are kept unless escapeSlash is true
+func s3Escape(value string, escapeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		case b == '/' && !escapeSlash:
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+// s3CanonicalQuery encodes the parameters sorted by name, escaped like AWS Signature Version 4 wants
+func s3CanonicalQuery(parameters url.Values) string {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	query := []string{}
+	for _, name := range names {
+		for _, value := range parameters[name] {
+			query = append(query, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(query, "&")
+}
+
+// firstEnv gets the value of the first environment variable that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
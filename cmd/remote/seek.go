@@ -0,0 +1,62 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// SeekProbeSize is the number of bytes read with a range request at each step of Seek
+const SeekProbeSize = 64 * 1024
+
+// Seek finds an offset of the object from where its lines at or after since can be read, with range requests
+//
+// The lines of the object must be sorted by time, timeOf gets the time of a line (false if it has none).
+// The offset is in the middle of a line that comes before since, the lines up to since must still be skipped.
+// Compressed objects and objects of unknown size cannot be seeked, 0 is returned for them.
+func (object Object) Seek(ctx context.Context, since time.Time, timeOf func(line []byte) (time.Time, bool)) (int64, error) {
+	if object.Size <= SeekProbeSize {
+		return 0, nil
+	}
+	if compressed, err := object.IsCompressed(ctx); err != nil || compressed {
+		return 0, err
+	}
+	low, high := int64(0), object.Size
+	for high-low > SeekProbeSize {
+		middle := low + (high-low)/2
+		probe, found, err := object.probeTime(ctx, middle, timeOf)
+		if err != nil {
+			return 0, err
+		}
+		if found && probe.Before(since) {
+			low = middle
+		} else {
+			high = middle
+		}
+	}
+	return low, nil
+}
+
+// probeTime gets the time of the first complete line with a time after the given offset, within SeekProbeSize bytes
+func (object Object) probeTime(ctx context.Context, offset int64, timeOf func(line []byte) (time.Time, bool)) (time.Time, bool, error) {
+	reader, err := object.OpenRange(ctx, offset, SeekProbeSize)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer func() { _ = reader.Close() }()
+	probe, err := io.ReadAll(reader)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	lines := bytes.Split(probe, []byte("\n"))
+	if len(lines) < 3 {
+		return time.Time{}, false, nil
+	}
+	for _, line := range lines[1 : len(lines)-1] { // the first and last lines are partial
+		if timestamp, ok := timeOf(line); ok {
+			return timestamp, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/remote"
+	"github.com/stretchr/testify/suite"
+)
+
+type RemoteSuite struct {
+	suite.Suite
+	Name string
+	ctx  context.Context
+}
+
+func TestRemoteSuite(t *testing.T) {
+	suite.Run(t, new(RemoteSuite))
+}
+
+func (suite *RemoteSuite) SetupSuite() {
+	suite.Name = "Remote"
+	suite.ctx = logger.Create("test", &logger.NilStream{}).ToContext(context.Background())
+}
+
+// serve serves the given files, compressing the ones ending with .gz, and gets their objects and the number of times they were requested
+func (suite *RemoteSuite) serve(files map[string][]string) ([]*remote.Object, map[string]int) {
+	contents := map[string][]byte{}
+	for name, lines := range files {
+		content := []byte(strings.Join(lines, "\n") + "\n")
+		if strings.HasSuffix(name, ".gz") {
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			_, _ = writer.Write(content)
+			suite.Require().NoError(writer.Close())
+			content = compressed.Bytes()
+		}
+		contents["/"+name] = content
+	}
+	requests := map[string]int{}
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && len(req.Header.Get("Range")) == 0 {
+			lock.Lock()
+			requests[req.URL.Path]++
+			lock.Unlock()
+		}
+		http.ServeContent(res, req, req.URL.Path, time.Time{}, bytes.NewReader(contents[req.URL.Path]))
+	}))
+	suite.T().Cleanup(server.Close)
+
+	objects := []*remote.Object{}
+	for _, name := range []string{"a.log", "b.log.gz", "c.log"} {
+		listed, err := remote.List(suite.ctx, server.URL+"/"+name)
+		suite.Require().NoError(err)
+		objects = append(objects, listed...)
+	}
+	return objects, requests
+}
+
+// entry creates the JSON line of a log entry at the given second
+func entry(second int, message string) string {
+	return fmt.Sprintf(`{"time": "2026-10-18T10:00:%02dZ", "msg": "%s"}`, second, message)
+}
+
+func (suite *RemoteSuite) TestCanMergeMoreObjectsThanOpened() {
+	objects, requests := suite.serve(map[string][]string{
+		"a.log":    {entry(1, "a1"), entry(4, "a4"), "a continued", entry(7, "a7")},
+		"b.log.gz": {entry(2, "b2"), entry(5, "b5"), entry(8, "b8")},
+		"c.log":    {entry(3, "c3"), entry(6, "c6"), entry(9, "c9")},
+	})
+	var output bytes.Buffer
+	pool := &remotePool{max: 2}
+	err := mergeRemote(suite.ctx, objects, time.Time{}, pool, &output)
+	suite.Require().NoError(err)
+
+	messages := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		source, payload := SplitSourcePrefix([]byte(line))
+		var logEntry LogEntry
+		if err := logEntry.UnmarshalJSON(payload); err == nil {
+			messages = append(messages, source+" "+logEntry.Message)
+		} else {
+			messages = append(messages, source+" "+string(payload))
+		}
+	}
+	a, b, c := objects[0].Source(), objects[1].Source(), objects[2].Source()
+	suite.Assert().Equal([]string{
+		a + " a1", b + " b2", c + " c3",
+		a + " a4", a + " a continued", b + " b5", c + " c6",
+		a + " a7", b + " b8", c + " c9",
+	}, messages)
+	suite.Assert().Empty(pool.open, "All the objects should be closed")
+	suite.Assert().Greater(requests["/b.log.gz"], 1, "The compressed object should be read again from its start")
+}
+
+func (suite *RemoteSuite) TestCanMergeObjectsSince() {
+	objects, _ := suite.serve(map[string][]string{
+		"a.log":    {entry(1, "a1"), entry(4, "a4")},
+		"b.log.gz": {entry(2, "b2"), entry(5, "b5")},
+		"c.log":    {entry(3, "c3"), entry(6, "c6")},
+	})
+	var output bytes.Buffer
+	since := time.Date(2026, 10, 18, 10, 0, 4, 0, time.UTC)
+	err := mergeRemote(suite.ctx, objects, since, &remotePool{max: 1}, &output)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(3, strings.Count(output.String(), "\n"))
+	suite.Assert().Contains(output.String(), "a4")
+	suite.Assert().NotContains(output.String(), "c3")
+}
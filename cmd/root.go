@@ -3,41 +3,61 @@ package cmd
 import (
 	"bufio"
 	"context"
-	"crypto/aes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/gildas/go-errors"
 	"github.com/gildas/go-flags"
 	"github.com/gildas/go-logger"
+	"github.com/gildas/lv/cmd/docker"
 	"github.com/gildas/lv/cmd/kubectl"
+	"github.com/gildas/lv/cmd/remote"
 	"github.com/gildas/lv/cmd/tail"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
 type OutputOptions struct {
-	LogLevel  string
-	Filter    string
-	Output    string
-	Location  *time.Location
-	UseColors bool
+	LogLevel         string
+	Filter           string
+	Output           string
+	Location         *time.Location
+	UseColors        bool
+	KubernetesColumn bool      // Shows the Kubernetes source of the entries in a column
+	Keyring          *Keyring  // Decrypts the obfuscated strings of the entries
+	Redactor         *Redactor // Redacts the entries before they are written
 }
 
 // CmdOptions contains the global options
 var CmdOptions struct {
 	OutputOptions
-	kubectl.LogsOptions
+	*kubectl.LogsOptions
 	Completion     *flags.EnumFlag
 	ConfigFile     string
 	CipherKey      string
+	KeyringName    string
+	KeepObfuscated bool
+	Redact         string
 	LogDestination string
 	Timezone       string
+	Trace          string
+	Loki           string
+	Sample         string
+	SampleBy       string
+	MaxRate        string
+	KeepErrors     bool
+	Dedup          bool
+	DedupWindow    time.Duration
 	Output         *flags.EnumFlag
 	UseKubernetes  bool
 	Follow         bool
@@ -71,13 +91,26 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&CmdOptions.LogLevel, "level", "", "Only shows log entries with a level at or above the given value.")
 	RootCmd.PersistentFlags().StringVar(&CmdOptions.Filter, "filter", "", "Run each log message through the filter.")
 	RootCmd.PersistentFlags().StringVar(&CmdOptions.Filter, "condition", "", "Run each log message through the filter.")
-	RootCmd.PersistentFlags().StringVarP(&CmdOptions.CipherKey, "key", "k", "", "Use the given key to decrypt obfuscated log entries. The key must be 16, 24, or 32 bytes long.")
+	RootCmd.PersistentFlags().StringVarP(&CmdOptions.CipherKey, "key", "k", "", "Use the given key to decrypt obfuscated log entries: the key itself, file:<path>, env:<variable>, or cmd:<command> to load it. The key must be 16, 24, or 32 bytes long.")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.KeyringName, "keyring", "", "Use the keys of the given keyring of the configuration (obfuscation.keyrings) to decrypt obfuscated log entries, they are tried in order")
+	RootCmd.PersistentFlags().BoolVar(&CmdOptions.KeepObfuscated, "keep-obfuscated", false, "Do not decrypt the obfuscated strings of the log entries, even if a key or a keyring is configured (e.g. when sharing the output)")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.Redact, "redact", "", "Redact the log entries with the given profile of the configuration (redact.<profile>) before they are shown, to share them safely")
 	RootCmd.PersistentFlags().BoolP("local", "L", false, "Display time field in local time, rather than UTC.")
 	RootCmd.PersistentFlags().StringVar(&CmdOptions.Timezone, "time", "", "Display time field in the given timezone (by default local time).")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.Trace, "trace", "", "Only shows the log entries of the given request/trace id as a timeline. The correlation fields are configured with trace.keys")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.Loki, "loki", "", "Query the log lines matching the LogQL selector given as argument from the Loki server at the given URL (with --since, --since-time, --tail, and --follow)")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.Sample, "sample", "", "Only shows a sample of the log entries (like 1/100)")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.SampleBy, "sample-by", "", "Sample the log entries by the hash of the given field, so all the entries with the same value are kept or dropped together")
+	RootCmd.PersistentFlags().StringVar(&CmdOptions.MaxRate, "max-rate", "", "Shows at most the given rate of log entries (like 100/s, 1000/m) and periodically the number of dropped entries")
+	RootCmd.PersistentFlags().BoolVar(&CmdOptions.KeepErrors, "keep-errors", false, "Error log entries are always shown, even when sampling or rate limiting")
+	RootCmd.PersistentFlags().BoolVar(&CmdOptions.Dedup, "dedup", false, "Collapse consecutive repeated log entries into one line with a counter. The fields to ignore are configured with dedup.ignore")
+	RootCmd.PersistentFlags().DurationVar(&CmdOptions.DedupWindow, "dedup-window", 0, "Collapse repeated log entries within the given time window, even if they are not consecutive. Implies --dedup")
 	RootCmd.PersistentFlags().BoolVarP(&CmdOptions.Follow, "follow", "f", false, "Specify if the logs should be streamed (kubernetes or files)")
 	RootCmd.PersistentFlags().BoolVar(&CmdOptions.UsePager, "no-pager", true, "Do not pipe output into a pager. By default, the output is piped throug `less` (or $PAGER if set), if stdout is a TTY")
 	RootCmd.PersistentFlags().BoolVar(&CmdOptions.UseColors, "no-color", false, "Do not colorize output. By default, the output is colorized if stdout is a TTY")
 	RootCmd.PersistentFlags().BoolVar(&CmdOptions.UseColors, "color", true, "Colorize output always, even if the output stream is not a TTY.")
+	RootCmd.PersistentFlags().Bool("k8s-column", false, "Show the namespace, pod, and container of the entries read from Kubernetes in a colored column")
+	RootCmd.PersistentFlags().StringSlice("k8s-labels", []string{}, "The pod labels added to the entries read from Kubernetes (by default app and app.kubernetes.io/name), they can be filtered with .k8s.labels.<name>")
 	RootCmd.PersistentFlags().BoolVar(&CmdOptions.UseKubernetes, "k8s", false, "Use Kubernetes resources instead of files. This flag is automatically set when any of the kubectl logs flags are used.")
 	RootCmd.PersistentFlags().VarP(CmdOptions.Output, "output", "o", "output mode/format. One of long, json, json-N, logviewer, inspect, short, simple, html, serve, server")
 	RootCmd.PersistentFlags().StringVar(&CmdOptions.LogDestination, "log", "", "where logs are writen if given (by default, no log is generated)")
@@ -92,8 +125,12 @@ func init() {
 
 	_ = RootCmd.RegisterFlagCompletionFunc(CmdOptions.Output.CompletionFunc("output"))
 	_ = RootCmd.RegisterFlagCompletionFunc(CmdOptions.Completion.CompletionFunc("completion"))
+	_ = RootCmd.RegisterFlagCompletionFunc("filter", validFilterArgs)
+	_ = RootCmd.RegisterFlagCompletionFunc("condition", validFilterArgs)
+	_ = RootCmd.RegisterFlagCompletionFunc("redact", validRedactArgs)
 
-	RootCmd.SilenceUsage = true // Do not show usage when an error occurs
+	RootCmd.SilenceUsage = true                        // Do not show usage when an error occurs
+	RootCmd.CompletionOptions.DisableDefaultCmd = true // We use the --completion flag instead
 	cobra.OnInitialize(func() {
 		if err := Initialize(RootCmd); err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to initialize: %s\n", err)
@@ -123,30 +160,235 @@ func validRootArgs(cmd *cobra.Command, args []string, toComplete string) ([]stri
 func runRootCommand(cmd *cobra.Command, args []string) (err error) {
 	// Here we should read from stdin or from the files
 	log := logger.Must(logger.FromContext(cmd.Context()))
-	var reader *bufio.Reader
 
 	log.Infof("Config File: %s", viper.ConfigFileUsed())
 	if cmd.Flags().Changed("completion") {
 		return generateCompletion(cmd, CmdOptions.Completion.Value)
 	}
 
-	CmdOptions.UseColors = isStdoutTTY() || viper.GetBool("color")
-	if cmd.Flags().Changed("no-color") {
-		CmdOptions.UseColors = false
+	if err = initializeOutputOptions(cmd); err != nil {
+		return err
 	}
-	CmdOptions.UsePager = isStdoutTTY() && isStdinTTY() && !kubectl.HasLogsFlags(cmd)
+	CmdOptions.UsePager = isStdoutTTY() && isStdinTTY() && (!kubectl.HasLogsFlags(cmd) || (len(args) > 0 && (remote.IsRemote(args[0]) || docker.IsTarget(args[0]) || kubectl.IsBundle(args[0])))) && len(CmdOptions.Loki) == 0
 	if cmd.Flags().Changed("no-pager") || viper.GetBool("no-pager") {
 		CmdOptions.UsePager = false
 	}
-	CmdOptions.OutputOptions.Output = viper.GetString("output")
 
-	if len(viper.GetString("obfuscationKey")) > 0 {
-		cipherBlock, err := aes.NewCipher([]byte(viper.GetString("obfuscationKey")))
+	reader, closeInput, err := openInputs(cmd, args)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+	return viewEntries(cmd, reader)
+}
+
+// viewEntries reads the log entries from the reader and writes the ones that pass the filters to stdout (or the pager)
+func viewEntries(cmd *cobra.Command, reader *bufio.Reader) (err error) {
+	log := logger.Must(logger.FromContext(cmd.Context()))
+
+	var outstream io.WriteCloser = os.Stdout
+
+	if CmdOptions.UsePager {
+		var closer func()
+
+		if outstream, closer, err = GetPager(cmd.Context()); err != nil {
+			log.Fatalf("Failed to get pager", err)
+			return err
+		}
+		defer closer()
+	}
+
+	filters := MultiLogFilter{}
+
+	if len(CmdOptions.LogLevel) > 0 {
+		log.Infof("Adding log level filter at %s", CmdOptions.LogLevel)
+		filters.Add(NewLevelLogFilter(CmdOptions.LogLevel))
+	}
+	if len(CmdOptions.Filter) > 0 {
+		log.Infof("Adding filter: %s", CmdOptions.Filter)
+		filter, err := NewConditionFilter(CmdOptions.Filter)
+		if err != nil {
+			log.Fatalf("Failed to create filter: %s", err)
+			return err
+		}
+		filters.Add(filter)
+		log.Infof("Added Filter: %#v", filter)
+	}
+	var traceView *TraceView
+	if len(CmdOptions.Trace) > 0 {
+		log.Infof("Adding trace filter for %s on %s", CmdOptions.Trace, viper.GetStringSlice("trace.keys"))
+		filters.Add(NewTraceLogFilter(CmdOptions.Trace, viper.GetStringSlice("trace.keys")))
+		traceView = NewTraceView(viper.GetString("trace.span"), viper.GetString("trace.parent"))
+	}
+	if len(CmdOptions.Sample) > 0 || len(CmdOptions.SampleBy) > 0 {
+		ratio := CmdOptions.Sample
+		if len(ratio) == 0 {
+			ratio = "1/10"
+		}
+		log.Infof("Adding sample filter at %s (by: %s)", ratio, CmdOptions.SampleBy)
+		filter, err := NewSampleLogFilter(ratio, CmdOptions.SampleBy)
+		if err != nil {
+			log.Fatalf("Failed to create sample filter: %s", err)
+			return err
+		}
+		if CmdOptions.KeepErrors {
+			filters.Add(NewBypassLogFilter(LogLevel(logger.ERROR), filter))
+		} else {
+			filters.Add(filter)
+		}
+	}
+	var rateFilter *RateLogFilter
+	if len(CmdOptions.MaxRate) > 0 {
+		log.Infof("Adding rate filter at %s", CmdOptions.MaxRate)
+		if rateFilter, err = NewRateLogFilter(CmdOptions.MaxRate, outstream, &CmdOptions.OutputOptions); err != nil {
+			log.Fatalf("Failed to create rate filter: %s", err)
+			return err
+		}
+		if CmdOptions.KeepErrors {
+			filters.Add(NewBypassLogFilter(LogLevel(logger.ERROR), rateFilter))
+		} else {
+			filters.Add(rateFilter)
+		}
+	}
+	var filter = filters.AsFilter()
+
+	var dedup *Deduplicator
+	if (CmdOptions.Dedup || CmdOptions.DedupWindow > 0) && traceView == nil {
+		log.Infof("Deduplicating log entries (window: %s, ignoring: %s)", CmdOptions.DedupWindow, viper.GetStringSlice("dedup.ignore"))
+		dedup = NewDeduplicator(outstream, &CmdOptions.OutputOptions, CmdOptions.DedupWindow, viper.GetStringSlice("dedup.ignore"))
+		dedup.Follow = viper.GetBool("follow")
+		dedup.InPlace = isStdoutTTY() && !CmdOptions.UsePager
+		if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			dedup.Width, dedup.Height = width, height
+		}
+		defer dedup.Flush()
+		if rateFilter != nil {
+			rateFilter.Output = dedup // the notices are counted with the lines to update in place
+		}
+	}
+	if rateFilter != nil {
+		defer func() { rateFilter.Notify(rateFilter.Clock(), true) }() // before the deduplicator is flushed
+	}
+
+	// when following, the notices of the rate filter are also written when no entry comes
+	var lock sync.Mutex
+	if rateFilter != nil && viper.GetBool("follow") {
+		stopped := false
+		ticker := time.NewTicker(rateFilter.Period)
+		defer func() {
+			ticker.Stop()
+			lock.Lock()
+			stopped = true
+			lock.Unlock()
+		}()
+		go func() {
+			for range ticker.C {
+				lock.Lock()
+				if stopped {
+					lock.Unlock()
+					return
+				}
+				rateFilter.Notify(rateFilter.Clock(), false)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for {
+		var line []byte
+
+		line, err = ReadLine(reader)
 		if err != nil {
-			log.Fatalf("Failed to create cipher block: %s", err)
+			if !errors.Is(err, io.EOF) {
+				log.Errorf("Failed to read line: %s", err)
+			}
+			break
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+		log.Infof("%s", string(line))
+		var entry LogEntry
+
+		lock.Lock()
+
+		source, payload := SplitSourcePrefix(line)
+		timestamp, payload := SplitTimestampPrefix(payload)
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			log.Errorf("Failed to parse JSON: %s", err)
+			if dedup != nil {
+				dedup.Passthrough(CmdOptions.Redactor.RedactText(string(line)))
+			} else if traceView == nil {
+				_, _ = fmt.Fprintln(outstream, CmdOptions.Redactor.RedactText(string(line)))
+			}
+			lock.Unlock()
+			continue
+		}
+		if err := entry.Unobfuscate(CmdOptions.Keyring); err != nil {
+			log.Warnf("Failed to unobfuscate the entry: %s", err)
+		}
+		if filter.Filter(cmd.Context(), entry) {
+			output := strings.Builder{}
+
+			CmdOptions.Redactor.Redact(&entry) // after the filter, so it still sees the values
+
+			if traceView == nil {
+				if len(source) > 0 {
+					output.WriteString("[" + source + "] ")
+				}
+				if len(timestamp) > 0 {
+					output.WriteString(timestamp + " ")
+				}
+				entry.Write(cmd.Context(), &output, &CmdOptions.OutputOptions)
+			} else if viper.GetBool("follow") {
+				traceView.WriteEntry(cmd.Context(), &output, &CmdOptions.OutputOptions, source, entry)
+			} else {
+				traceView.Add(source, entry)
+			}
+			if output.Len() > 0 && dedup != nil {
+				dedup.Add(source, entry, output.String())
+			} else if output.Len() > 0 {
+				_, _ = fmt.Fprintln(outstream, output.String())
+			}
+		}
+		lock.Unlock()
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Fatalf("Failed to read from input", err)
+		return err
+	}
+	if traceView != nil && !viper.GetBool("follow") {
+		traceView.Write(cmd.Context(), outstream, &CmdOptions.OutputOptions)
+	}
+	return nil
+}
+
+// initializeOutputOptions sets the colors, the obfuscation key, the redaction profile, and the time location from the flags and the configuration
+func initializeOutputOptions(cmd *cobra.Command) (err error) {
+	log := logger.Must(logger.FromContext(cmd.Context()))
+
+	CmdOptions.UseColors = isStdoutTTY() || viper.GetBool("color")
+	if cmd.Flags().Changed("no-color") {
+		CmdOptions.UseColors = false
+	}
+	CmdOptions.OutputOptions.Output = viper.GetString("output")
+	CmdOptions.KubernetesColumn = viper.GetBool("k8s.column")
+
+	if CmdOptions.KeepObfuscated {
+		log.Infof("Keeping the obfuscated strings encrypted")
+		CmdOptions.Keyring = nil
+	} else if CmdOptions.Keyring, err = LoadKeyring(cmd.Context()); err != nil {
+		log.Fatalf("Failed to load the obfuscation keys: %s", err)
+		return err
+	}
+	CmdOptions.Redactor = nil
+	if len(CmdOptions.Redact) > 0 {
+		if CmdOptions.Redactor, err = NewRedactor(CmdOptions.Redact); err != nil {
+			log.Fatalf("Failed to load the redaction profile %s: %s", CmdOptions.Redact, err)
 			return err
 		}
-		log.SetObfuscationKey(cipherBlock)
+		log.Infof("Redacting the log entries with profile %s", CmdOptions.Redact)
 	}
 
 	if cmd.Flags().Changed("local") {
@@ -157,38 +399,183 @@ func runRootCommand(cmd *cobra.Command, args []string) (err error) {
 	}
 	viper.Set("timezone", CmdOptions.Location.String())
 	log.Infof("Displaying time at location: %s", CmdOptions.Location)
+	return nil
+}
 
-	// If some of the Kubectl Logs flags are set, we should execute kubectl logs command and read from its output
+// openInput opens the reader from Loki, HTTP(S) or S3 URLs, Kubernetes, stdin, a bundle recorded with --record, or the file given in args (followed or not)
+//
+// The returned close func must be called when the reader is not needed anymore
+func openInput(cmd *cobra.Command, args []string) (reader *bufio.Reader, close func(), err error) {
+	log := logger.Must(logger.FromContext(cmd.Context()))
+
+	// With --loki, the argument is a LogQL query and the --since, --since-time, and --tail flags apply to it
+	if len(CmdOptions.Loki) > 0 {
+		if len(args) == 0 {
+			return nil, nil, errors.ArgumentMissing.With("selector")
+		}
+		pipeReader, pipeWriter, err := os.Pipe()
+		if err != nil {
+			log.Fatalf("Failed to create pipe: %s", err)
+			return nil, nil, err
+		}
+		reader = bufio.NewReader(pipeReader)
+
+		log.Infof("Querying Loki at %s", CmdOptions.Loki)
+		go func() {
+			defer func() { _ = pipeWriter.Close() }()
+			if err := queryLoki(cmd.Context(), CmdOptions.Loki, args[0], CmdOptions.LogsOptions, viper.GetBool("follow"), pipeWriter); err != nil {
+				log.Fatalf("Failed to query Loki at %s: %s", CmdOptions.Loki, err)
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}()
+		return reader, func() { _ = pipeReader.Close() }, nil
+	}
+	// With an HTTP(S) or S3 URL, the --since and --since-time flags seek in the remote objects
+	if len(args) > 0 && remote.IsRemote(args[0]) {
+		var since time.Time
+		if CmdOptions.LogsOptions.Since > 0 {
+			since = time.Now().Add(-CmdOptions.LogsOptions.Since)
+		} else {
+			since = CmdOptions.LogsOptions.SinceTime
+		}
+		pipeReader, pipeWriter, err := os.Pipe()
+		if err != nil {
+			log.Fatalf("Failed to create pipe: %s", err)
+			return nil, nil, err
+		}
+		reader = bufio.NewReader(pipeReader)
+
+		log.Infof("Reading remote objects at %s", args[0])
+		go func() {
+			defer func() { _ = pipeWriter.Close() }()
+			if err := streamRemote(cmd.Context(), args[0], since, pipeWriter); err != nil {
+				log.Fatalf("Failed to read %s: %s", args[0], err)
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}()
+		return reader, func() { _ = pipeReader.Close() }, nil
+	}
+	// With a Docker container or a Compose service, the --since, --since-time, --tail, and --timestamps flags apply to its logs
+	if len(args) > 0 && docker.IsTarget(args[0]) {
+		streamer, err := docker.NewStreamer(args[0])
+		if err != nil {
+			log.Fatalf("Failed to create Docker log streamer: %s", err)
+			return nil, nil, err
+		}
+		streamer.Follow = viper.GetBool("follow")
+		streamer.Tail = CmdOptions.LogsOptions.Tail
+		streamer.Timestamps = CmdOptions.LogsOptions.Timestamps
+		if CmdOptions.LogsOptions.Since > 0 {
+			streamer.Since = time.Now().Add(-CmdOptions.LogsOptions.Since)
+		} else {
+			streamer.Since = CmdOptions.LogsOptions.SinceTime
+		}
+		pipeReader, pipeWriter, err := os.Pipe()
+		if err != nil {
+			log.Fatalf("Failed to create pipe: %s", err)
+			return nil, nil, err
+		}
+		reader = bufio.NewReader(pipeReader)
+
+		log.Infof("Streaming Docker logs from %s", streamer)
+		go func() {
+			defer func() { _ = pipeWriter.Close() }()
+			if err := streamDocker(cmd.Context(), streamer, pipeWriter, &CmdOptions.OutputOptions); err != nil {
+				log.Fatalf("Failed to stream Docker logs from %s: %s", streamer, err)
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}()
+		return reader, func() { _ = pipeReader.Close() }, nil
+	}
+	// A bundle is replayed even with kubectl flags, only --since and --since-time are used
+	if len(args) > 0 && kubectl.IsBundle(args[0]) {
+		var since time.Time
+		if CmdOptions.LogsOptions.Since > 0 {
+			since = time.Now().Add(-CmdOptions.LogsOptions.Since)
+		} else {
+			since = CmdOptions.LogsOptions.SinceTime
+		}
+		log.Infof("Replaying bundle %s", args[0])
+		pipeReader, pipeWriter, err := os.Pipe()
+		if err != nil {
+			log.Fatalf("Failed to create pipe: %s", err)
+			return nil, nil, err
+		}
+		reader = bufio.NewReader(pipeReader)
+
+		go func() {
+			defer func() { _ = pipeWriter.Close() }()
+			if err := replayKubernetes(cmd.Context(), args[0], since, pipeWriter, &CmdOptions.OutputOptions); err != nil {
+				log.Fatalf("Failed to replay bundle %s: %s", args[0], err)
+				fmt.Fprintln(os.Stderr, err.Error())
+			}
+		}()
+		return reader, func() { _ = pipeReader.Close() }, nil
+	}
+	// If some of the Kubectl Logs flags are set, we should stream the logs from Kubernetes
 	if kubectl.HasLogsFlags(cmd) {
+		streamers, failures := kubectl.NewStreamers(cmd, CmdOptions.LogsOptions, args)
+		if len(streamers) == 0 {
+			log.Fatalf("Failed to create Kubernetes log streamer: %s", failures)
+			return nil, nil, failures
+		} else if failures != nil {
+			log.Errorf("Some contexts or namespaces cannot be streamed", failures)
+		}
+		var recorder *kubectl.Recorder
+		if len(CmdOptions.LogsOptions.Record) > 0 {
+			prefix := len(streamers) > 1 || streamers[0].Prefix
+			if recorder, err = kubectl.NewRecorder(CmdOptions.LogsOptions.Record, streamers, prefix, len(streamers) > 1); err != nil {
+				log.Fatalf("Failed to create bundle %s: %s", CmdOptions.LogsOptions.Record, err)
+				return nil, nil, err
+			}
+		}
 		pipeReader, pipeWriter, err := os.Pipe()
 		if err != nil {
 			log.Fatalf("Failed to create pipe: %s", err)
-			return err
+			return nil, nil, err
 		}
 		reader = bufio.NewReader(pipeReader)
 
-		log.Infof("Executing kubectl logs command with the given flags")
+		log.Infof("Streaming Kubernetes logs with the given flags")
 		go func() {
 			defer func() { _ = pipeWriter.Close() }()
-			params := kubectl.BuildLogsParameters(cmd)
-			params = append(params, args...)
-			if err := kubectl.NewKubectl().Exec(cmd.Context(), params, pipeWriter, pipeWriter); err != nil {
-				log.Fatalf("Failed to execute kubectl logs command: %s", err)
+			ctx := cmd.Context()
+			if recorder != nil {
+				// the bundle must be completed when the session is interrupted
+				var stop context.CancelFunc
+				ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				defer func() {
+					if err := recorder.Close(); err != nil {
+						log.Errorf("Failed to write bundle %s", recorder.Path, err)
+						fmt.Fprintln(os.Stderr, err.Error())
+					}
+				}()
+			}
+			if failures != nil {
+				writeKubernetesFailures(pipeWriter, failures, &CmdOptions.OutputOptions)
+			}
+			if err := streamKubernetes(ctx, streamers, pipeWriter, recorder, &CmdOptions.OutputOptions); err != nil {
+				log.Fatalf("Failed to stream Kubernetes logs: %s", err)
 				fmt.Fprintln(os.Stderr, err.Error())
 			}
 		}()
+		return reader, func() { _ = pipeReader.Close() }, nil
 	} else if len(args) == 0 {
 		log.Infof("Reading from stdin")
 		reader = bufio.NewReader(os.Stdin)
+		if isJournalExport(reader) {
+			log.Infof("Converting the journal export format")
+			journalReader := newJournalExportReader(reader)
+			return bufio.NewReader(journalReader), func() { _ = journalReader.Close() }, nil
+		}
+		return reader, func() {}, nil
 	} else if viper.GetBool("follow") {
 		log.Infof("Following file %s", args[0])
-		if err != nil {
-			return errors.Join(fmt.Errorf("Failed to tail file %s", args[0]), err)
-		}
 		pipeReader, pipeWriter, err := os.Pipe()
 		if err != nil {
 			log.Fatalf("Failed to create pipe: %s", err)
-			return err
+			return nil, nil, err
 		}
 		reader = bufio.NewReader(pipeReader)
 
@@ -201,80 +588,127 @@ func runRootCommand(cmd *cobra.Command, args []string) (err error) {
 				fmt.Fprintln(os.Stderr, err.Error())
 			}
 		}()
-	} else {
-		file, err := os.Open(args[0])
-		if err != nil {
-			log.Fatalf("Failed to open file %s: %s", args[0], err)
-			return err
-		}
-		defer func() { _ = file.Close() }()
-		reader = bufio.NewReader(file)
+		return reader, func() { _ = pipeReader.Close() }, nil
 	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Fatalf("Failed to open file %s: %s", args[0], err)
+		return nil, nil, errors.Join(fmt.Errorf("Failed to open file %s", args[0]), err)
+	}
+	reader = bufio.NewReader(file)
+	if isJournalExport(reader) {
+		log.Infof("Converting the journal export format of %s", args[0])
+		journalReader := newJournalExportReader(reader)
+		return bufio.NewReader(journalReader), func() { _ = journalReader.Close(); _ = file.Close() }, nil
+	}
+	return reader, func() { _ = file.Close() }, nil
+}
 
-	var outstream io.WriteCloser = os.Stdout
-
-	if CmdOptions.UsePager {
-		var closer func()
-
-		if outstream, closer, err = GetPager(cmd.Context()); err != nil {
-			log.Fatalf("Failed to get pager", err)
-			return err
+// openInputs opens the inputs given as arguments (see openInput)
+//
+// The lines of several inputs are merged as they are read, the lines without a source are tagged with their input (e.g. "[file:api.log] ")
+func openInputs(cmd *cobra.Command, args []string) (reader *bufio.Reader, close func(), err error) {
+	if len(args) < 2 {
+		return openInput(cmd, args)
+	}
+	readers := make([]*bufio.Reader, 0, len(args))
+	closers := make([]func(), 0, len(args))
+	closeAll := func() {
+		for _, close := range closers {
+			close()
 		}
-		defer closer()
+	}
+	for _, arg := range args {
+		reader, close, err := openInput(cmd, []string{arg})
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		readers = append(readers, reader)
+		closers = append(closers, close)
+	}
+	pipeReader, pipeWriter, err := os.Pipe()
+	if err != nil {
+		closeAll()
+		return nil, nil, err
 	}
 
-	filters := MultiLogFilter{}
+	var lock sync.Mutex
+	var waiter sync.WaitGroup
+	for index, input := range readers {
+		source := inputSource(args[index])
+		waiter.Add(1)
+		go func() {
+			defer waiter.Done()
+			for {
+				line, err := ReadLine(input)
+				if len(line) > 0 {
+					if prefix, _ := SplitSourcePrefix(line); len(prefix) == 0 {
+						line = append([]byte("["+source+"] "), line...)
+					}
+					lock.Lock()
+					_, werr := pipeWriter.Write(append(line, '\n'))
+					lock.Unlock()
+					if werr != nil {
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		waiter.Wait()
+		_ = pipeWriter.Close()
+	}()
+	return bufio.NewReader(pipeReader), func() { _ = pipeReader.Close(); closeAll() }, nil
+}
 
-	if len(CmdOptions.LogLevel) > 0 {
-		log.Infof("Adding log level filter at %s", CmdOptions.LogLevel)
-		filters.Add(NewLevelLogFilter(CmdOptions.LogLevel))
+// inputSource gets the source of the lines of the given input, as written before them (e.g. "file:api.log", "https:example.com/api.log")
+func inputSource(input string) string {
+	source := "file:" + input
+	if scheme, rest, found := strings.Cut(input, "://"); found {
+		source = strings.ToLower(scheme) + ":" + rest
 	}
-	if len(CmdOptions.Filter) > 0 {
-		log.Infof("Adding filter: %s", CmdOptions.Filter)
-		filter, err := NewConditionFilter(CmdOptions.Filter)
-		if err != nil {
-			log.Fatalf("Failed to create filter: %s", err)
-			return err
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == ']' {
+			return '_'
 		}
-		filters.Add(filter)
-		log.Infof("Added Filter: %#v", filter)
-	}
-	var filter = filters.AsFilter()
+		return r
+	}, source)
+}
 
-	for {
-		var line []byte
+// readEntries reads all the log entries from the reader and calls process for each of them
+//
+// Lines that cannot be parsed as log entries are ignored
+func readEntries(context context.Context, reader io.Reader, process func(entry LogEntry)) error {
+	log := logger.Must(logger.FromContext(context))
 
-		line, err = ReadLine(reader)
+	for {
+		line, err := ReadLine(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
 		if err != nil {
-			if !errors.Is(err, io.EOF) {
-				log.Errorf("Failed to read line: %s", err)
-			}
-			break
+			log.Errorf("Failed to read line: %s", err)
+			return err
 		}
-
 		if len(line) == 0 {
 			continue
 		}
-		log.Infof("%s", string(line))
 		var entry LogEntry
 
-		if err := json.Unmarshal(line, &entry); err != nil {
-			log.Errorf("Failed to parse JSON: %s", err)
-			_, _ = fmt.Fprintln(outstream, string(line))
+		_, payload := SplitSourcePrefix(line)
+		if err := json.Unmarshal(payload, &entry); err != nil {
+			log.Debugf("Ignoring line that is not a log entry: %s", err)
 			continue
 		}
-		if filter.Filter(cmd.Context(), entry) {
-			output := strings.Builder{}
-
-			entry.Write(cmd.Context(), &output, &CmdOptions.OutputOptions)
-			if output.Len() > 0 {
-				_, _ = fmt.Fprintln(outstream, output.String())
-			}
+		if err := entry.Unobfuscate(CmdOptions.Keyring); err != nil {
+			log.Warnf("Failed to unobfuscate the entry: %s", err)
 		}
+		CmdOptions.Redactor.Redact(&entry)
+		process(entry)
 	}
-	if err != nil && !errors.Is(err, io.EOF) {
-		log.Fatalf("Failed to read from input", err)
-		return err
-	}
-	return nil
 }
@@ -8,7 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
+	"github.com/gildas/go-core"
 	"github.com/gildas/go-logger"
 	"golang.org/x/term"
 )
@@ -95,3 +97,15 @@ func ReadLine(reader io.Reader) (line []byte, err error) {
 		_ = buffer.WriteByte(b[0])
 	}
 }
+
+// ParseTime parses the given value as an RFC3339 time or as a duration before now (like 5m, 2h)
+func ParseTime(value string) (time.Time, error) {
+	if timestamp, err := time.Parse(time.RFC3339, value); err == nil {
+		return timestamp, nil
+	}
+	duration, err := core.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, errors.Join(errors.New("invalid time or duration: "+value), err)
+	}
+	return time.Now().Add(-duration), nil
+}
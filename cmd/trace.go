@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/gildas/lv/cmd/kubectl"
+	"github.com/spf13/cobra"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace [flags] <id> [input...]",
+	Short: "show the log entries of a request/trace as a timeline",
+	Long: `Gathers every log entry that shares the given request/trace id and shows them as a timeline.
+The entries are gathered across all the inputs (files, URLs, bundles, or the Kubernetes pods given with the kubectl flags), each entry is shown with its source.
+The fields used as correlation keys are configured with trace.keys, entries are indented by their span when trace.span and trace.parent are found.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runTraceCommand,
+}
+
+func init() {
+	RootCmd.AddCommand(traceCmd)
+	kubectl.AddLogsFlags(traceCmd, RootCmd)
+}
+
+// runTraceCommand executes the trace Command
+func runTraceCommand(cmd *cobra.Command, args []string) (err error) {
+	CmdOptions.Trace = args[0]
+	return runRootCommand(cmd, args[1:])
+}
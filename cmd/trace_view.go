@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TraceView displays the log entries of a request/trace as a timeline
+//
+// When span information is available, entries are indented by their span parent/child relationship
+type TraceView struct {
+	SpanKey   string
+	ParentKey string
+	entries   []traceEntry
+	parents   map[string]string
+	previous  time.Time
+}
+
+// traceEntry is a log entry of the timeline with its source (e.g. the pod that logged it)
+type traceEntry struct {
+	source string
+	entry  LogEntry
+}
+
+// NewTraceView creates a new TraceView
+func NewTraceView(spanKey, parentKey string) *TraceView {
+	return &TraceView{
+		SpanKey:   spanKey,
+		ParentKey: parentKey,
+		parents:   map[string]string{},
+	}
+}
+
+// Add adds the given LogEntry read from the given source to the timeline
+//
+// The source can be empty
+func (view *TraceView) Add(source string, entry LogEntry) {
+	view.learn(entry)
+	view.entries = append(view.entries, traceEntry{source: source, entry: entry})
+}
+
+// Write writes the whole timeline sorted by time to the given io.Writer output
+func (view *TraceView) Write(context context.Context, output io.Writer, options *OutputOptions) {
+	sort.SliceStable(view.entries, func(i, j int) bool {
+		return view.entries[i].entry.Time.Before(view.entries[j].entry.Time)
+	})
+	for _, traced := range view.entries {
+		view.WriteEntry(context, output, options, traced.source, traced.entry)
+		_, _ = output.Write([]byte("\n"))
+	}
+}
+
+// WriteEntry writes the given LogEntry as the next hop of the timeline to the given io.Writer output
+//
+// The elapsed time since the previous hop and the source of the entry, if any, are written before the entry
+func (view *TraceView) WriteEntry(context context.Context, output io.Writer, options *OutputOptions, source string, entry LogEntry) {
+	view.learn(entry)
+	elapsed := "start"
+	if !view.previous.IsZero() {
+		elapsed = "+" + entry.Time.Sub(view.previous).Round(time.Millisecond).String()
+	}
+	view.previous = entry.Time
+
+	if options.UseColors {
+		_, _ = output.Write([]byte(Gray))
+	}
+	_, _ = fmt.Fprintf(output, "%10s ", elapsed)
+	if options.UseColors {
+		_, _ = output.Write([]byte(Reset))
+	}
+	if len(source) > 0 {
+		_, _ = output.Write([]byte("[" + source + "] "))
+	}
+	if depth := view.depth(entry.GetField(view.SpanKey)); depth > 0 {
+		_, _ = output.Write([]byte(strings.Repeat("  ", depth-1) + "└─ "))
+	}
+	entry.Write(context, output, options)
+}
+
+// learn records the parent of the span of the given LogEntry
+func (view *TraceView) learn(entry LogEntry) {
+	span := entry.GetField(view.SpanKey)
+	parent := entry.GetField(view.ParentKey)
+	if len(span) > 0 && len(parent) > 0 && span != parent {
+		view.parents[span] = parent
+	}
+}
+
+// depth computes the depth of the given span in the span tree
+func (view TraceView) depth(span string) (depth int) {
+	visited := map[string]bool{}
+	for len(span) > 0 && !visited[span] {
+		visited[span] = true
+		parent, found := view.parents[span]
+		if !found {
+			break
+		}
+		depth++
+		span = parent
+	}
+	return depth
+}